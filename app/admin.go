@@ -0,0 +1,100 @@
+package app
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/observiq/tracing/chaos"
+)
+
+// startTime is when the process started, reported by the runtime stats
+var startTime = time.Now()
+
+// newAdminServer creates the admin server exposing pprof, expvar, and runtime
+// stats, the faults of injector, the state of telemetry, the traces of the
+// in process receiver, and the live stream of request spans when set. It
+// listens separately from the API so it is never exposed publicly by
+// accident.
+func newAdminServer(addr string, injector *chaos.Injector, telemetryStatus, traces, spanStream http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/runtime", runtimeStats)
+	if injector != nil {
+		mux.Handle("/debug/chaos", chaosFaults(injector))
+	}
+	if telemetryStatus != nil {
+		mux.Handle("/debug/telemetry", telemetryStatus)
+	}
+	if traces != nil {
+		traces = http.StripPrefix("/debug/traces", traces)
+		mux.Handle("/debug/traces", traces)
+		mux.Handle("/debug/traces/", traces)
+	}
+	if spanStream != nil {
+		mux.Handle("/debug/stream", spanStream)
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// runtimeStats writes a snapshot of the Go runtime as JSON
+func runtimeStats(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"go_version":     runtime.Version(),
+		"uptime":         time.Since(startTime).String(),
+		"num_cpu":        runtime.NumCPU(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     m.HeapAlloc,
+		"heap_inuse":     m.HeapInuse,
+		"heap_objects":   m.HeapObjects,
+		"total_alloc":    m.TotalAlloc,
+		"sys":            m.Sys,
+		"num_gc":         m.NumGC,
+		"gc_pause_total": time.Duration(m.PauseTotalNs).String(),
+		"next_gc":        m.NextGC,
+	})
+}
+
+// chaosFaults serves the faults injected on GET and replaces them with the
+// JSON body of a PUT
+func chaosFaults(injector *chaos.Injector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			faults := injector.Faults()
+			if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := injector.Set(faults); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(injector.Faults())
+	}
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/customers"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (s *Server) getCustomer(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("customer.id", id))
+
+	customer, err := s.customers.Get(ctx, id)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer": customer,
+	})
+}
+
+func (s *Server) listCustomers(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	cursor, limit, err := parsePage(c)
+	if err != nil {
+		handleErrorResponse(c, span, http.StatusBadRequest, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int64("page.cursor", int64(cursor)),
+		attribute.Int64("page.size", limit),
+	)
+
+	page, next, err := s.customers.List(ctx, cursor, limit)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("page.count", len(page)),
+		attribute.Int64("page.next_cursor", int64(next)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"customers":   page,
+		"next_cursor": strconv.FormatUint(next, 10),
+	})
+}
+
+func (s *Server) createCustomer(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	var req customers.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+
+	customer, err := s.customers.Create(ctx, req)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(attribute.String("customer.id", customer.ID))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":       customer.ID,
+		"customer": customer,
+	})
+}
+
+func (s *Server) updateCustomer(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("customer.id", id))
+
+	var req customers.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+
+	customer, err := s.customers.Update(ctx, id, req)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer": customer,
+	})
+}
+
+func (s *Server) deleteCustomer(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("customer.id", id))
+
+	if err := s.customers.Delete(ctx, id); err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listCustomerOrders lists the orders of a customer, fetching the customer
+// first so an unknown customer is a 404 rather than an empty page
+func (s *Server) listCustomerOrders(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("customer.id", id))
+
+	cursor, limit, err := parsePage(c)
+	if err != nil {
+		handleErrorResponse(c, span, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := s.customers.Get(ctx, id); err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	page, next, err := s.orders.Search(ctx, db.Query{Customer: id}, cursor, limit)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(attribute.Int("page.count", len(page)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":      page,
+		"next_cursor": strconv.FormatUint(next, 10),
+	})
+}
+
+// respondWithCustomer responds with the order along with the customer it
+// references. Orders whose customer field is not a known customer ID are
+// returned without one.
+func (s *Server) respondWithCustomer(ctx context.Context, c *gin.Context, span trace.Span, order *db.Order) {
+	customer, err := s.customers.Get(ctx, order.Customer)
+	if err != nil && !errors.Is(err, db.ErrCustomerNotFound) {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(attribute.Bool("order.customer_found", customer != nil))
+
+	c.JSON(http.StatusOK, gin.H{
+		"order":    order,
+		"customer": customer,
+	})
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+)
+
+const validCustomer = `{"name": "Customer", "email": "customer@example.com"}`
+
+func TestCustomerHandlers(t *testing.T) {
+	t.Run("list", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers", []handlerTest{
+			{name: "ok", method: http.MethodGet, target: "/v1/customers", status: http.StatusOK},
+			{name: "invalid cursor", method: http.MethodGet, target: "/v1/customers?cursor=-1", status: http.StatusBadRequest},
+			{name: "store down", method: http.MethodGet, target: "/v1/customers", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("get", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers/:id", []handlerTest{
+			{name: "ok", method: http.MethodGet, target: "/v1/customers/customer-1", status: http.StatusOK},
+			{name: "not found", method: http.MethodGet, target: "/v1/customers/missing", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodGet, target: "/v1/customers/customer-1", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("list orders", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers/:id/orders", []handlerTest{
+			{name: "ok", method: http.MethodGet, target: "/v1/customers/customer-1/orders", status: http.StatusOK},
+			{name: "invalid limit", method: http.MethodGet, target: "/v1/customers/customer-1/orders?limit=x", status: http.StatusBadRequest},
+			{name: "not found", method: http.MethodGet, target: "/v1/customers/missing/orders", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodGet, target: "/v1/customers/customer-1/orders", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("create", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers", []handlerTest{
+			{name: "ok", method: http.MethodPost, target: "/v1/customers", body: validCustomer, status: http.StatusCreated},
+			{name: "invalid", method: http.MethodPost, target: "/v1/customers", body: `{"name": "Customer", "email": "nowhere"}`, status: http.StatusBadRequest},
+			{name: "store down", method: http.MethodPost, target: "/v1/customers", body: validCustomer, err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("update", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers/:id", []handlerTest{
+			{name: "ok", method: http.MethodPut, target: "/v1/customers/customer-1", body: validCustomer, status: http.StatusOK},
+			{name: "invalid", method: http.MethodPut, target: "/v1/customers/customer-1", body: `{}`, status: http.StatusBadRequest},
+			{name: "not found", method: http.MethodPut, target: "/v1/customers/missing", body: validCustomer, status: http.StatusNotFound},
+			{name: "store down", method: http.MethodPut, target: "/v1/customers/customer-1", body: validCustomer, err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("delete", func(t *testing.T) {
+		runHandlerTests(t, "/v1/customers/:id", []handlerTest{
+			{name: "ok", method: http.MethodDelete, target: "/v1/customers/customer-1", status: http.StatusNoContent},
+			{name: "not found", method: http.MethodDelete, target: "/v1/customers/missing", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodDelete, target: "/v1/customers/customer-1", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/problem"
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Record an error on the span and abort the request with a problem+json body
+// for the given status code and error. Only server errors fail the span. The
+// error of a server error is kept on the span and in the access log, and
+// the client only gets a generic detail along with the trace ID.
+func handleErrorResponse(c *gin.Context, s trace.Span, statusCode int, err error) {
+	span.RecordHTTPError(s, statusCode, err)
+	c.Error(err)
+	problem.Abort(c, problem.New(statusCode, clientDetail(statusCode, err)))
+}
+
+// clientDetail returns the detail of err the client may see, none for a
+// server error
+func clientDetail(statusCode int, err error) string {
+	if statusCode >= http.StatusInternalServerError {
+		return ""
+	}
+	return err.Error()
+}
+
+// handleBindError records why the request body was rejected on the span and
+// aborts the request with a problem+json body listing the invalid fields
+func handleBindError(c *gin.Context, s trace.Span, err error) {
+	fields := validation.FieldErrors(err)
+	for _, f := range fields {
+		s.AddEvent("validation failed", trace.WithAttributes(
+			attribute.String("validation.field", f.Field),
+			attribute.String("validation.rule", f.Rule),
+			attribute.String("validation.message", f.Message),
+		))
+	}
+	span.RecordHTTPError(s, http.StatusBadRequest, err)
+	c.Error(err)
+
+	detail := err.Error()
+	if len(fields) > 0 {
+		detail = fmt.Sprintf("%d field(s) failed validation", len(fields))
+	}
+	problem.Abort(c, problem.Validation(detail, fields))
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/store"
+)
+
+// fakeStore keeps orders and customers in memory like store.Memory, but
+// fails every call with err when it is set, standing in for a backend that
+// is down
+type fakeStore struct {
+	*store.Memory
+	err error
+}
+
+var (
+	_ store.OrderStore    = (*fakeStore)(nil)
+	_ store.CustomerStore = (*fakeStore)(nil)
+)
+
+// newFakeStore creates a fake store holding order-1 of customer-1, and the
+// customer
+func newFakeStore(t testing.TB, err error) *fakeStore {
+	ctx := context.Background()
+	m := store.NewMemory()
+	now := time.Now().UTC()
+	order := &db.Order{ID: "order-1", Customer: "customer-1", Currency: "USD", Status: db.StatusCreated, CreatedAt: now, UpdatedAt: now}
+	order.SetItems([]db.Item{{SKU: "ABC-1234", Quantity: 2, Price: 5}})
+	if err := m.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	customer := &db.Customer{ID: "customer-1", Name: "Customer", Email: "customer@example.com", CreatedAt: now, UpdatedAt: now}
+	if err := m.CreateCustomer(ctx, customer); err != nil {
+		t.Fatal(err)
+	}
+	return &fakeStore{Memory: m, err: err}
+}
+
+func (f *fakeStore) GetOrder(ctx context.Context, id string) (*db.Order, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Memory.GetOrder(ctx, id)
+}
+
+func (f *fakeStore) PutOrder(ctx context.Context, o *db.Order) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.PutOrder(ctx, o)
+}
+
+func (f *fakeStore) CreateOrder(ctx context.Context, o *db.Order) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.CreateOrder(ctx, o)
+}
+
+func (f *fakeStore) UpdateOrder(ctx context.Context, id string, fn func(*db.Order) error) (*db.Order, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Memory.UpdateOrder(ctx, id, fn)
+}
+
+func (f *fakeStore) Exists(ctx context.Context, id string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.Memory.Exists(ctx, id)
+}
+
+func (f *fakeStore) Delete(ctx context.Context, id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.Delete(ctx, id)
+}
+
+func (f *fakeStore) List(ctx context.Context, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	return f.Memory.List(ctx, cursor, limit)
+}
+
+func (f *fakeStore) WithLock(ctx context.Context, key string, fn func(context.Context) error) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.WithLock(ctx, key, fn)
+}
+
+func (f *fakeStore) Ping(ctx context.Context) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.Ping(ctx)
+}
+
+func (f *fakeStore) GetCustomer(ctx context.Context, id string) (*db.Customer, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Memory.GetCustomer(ctx, id)
+}
+
+func (f *fakeStore) GetCustomers(ctx context.Context, ids []string) (map[string]*db.Customer, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Memory.GetCustomers(ctx, ids)
+}
+
+func (f *fakeStore) CreateCustomer(ctx context.Context, c *db.Customer) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.CreateCustomer(ctx, c)
+}
+
+func (f *fakeStore) UpdateCustomer(ctx context.Context, id string, fn func(*db.Customer) error) (*db.Customer, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Memory.UpdateCustomer(ctx, id, fn)
+}
+
+func (f *fakeStore) DeleteCustomer(ctx context.Context, id string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.Memory.DeleteCustomer(ctx, id)
+}
+
+func (f *fakeStore) ListCustomers(ctx context.Context, cursor uint64, limit int64) ([]*db.Customer, uint64, error) {
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	return f.Memory.ListCustomers(ctx, cursor, limit)
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+const ordersQuery = `{"query": "query Orders { orders { orders { id customer { name } } } }", "operationName": "Orders"}`
+
+func TestGraphQLHandler(t *testing.T) {
+	runHandlerTests(t, "/graphql", []handlerTest{
+		{name: "ok", method: http.MethodPost, target: "/graphql", body: ordersQuery, status: http.StatusOK},
+		{name: "get", method: http.MethodGet, target: "/graphql?query=" + url.QueryEscape(`{ order(id: "order-1") { id } }`), status: http.StatusOK},
+		// failing validation is reported like any error of a GraphQL query
+		{name: "invalid query", method: http.MethodPost, target: "/graphql", body: `{"query": "{ orders { missing } }"}`, status: http.StatusOK},
+		{name: "no query", method: http.MethodPost, target: "/graphql", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, target: "/graphql", body: `{`, status: http.StatusBadRequest},
+		{name: "too large", method: http.MethodPost, target: "/graphql", body: `{"query": "` + strings.Repeat(" ", 1<<20) + `{ orders { nextCursor } }"}`, status: http.StatusBadRequest},
+	})
+}
+
+// graphQLResponse is the body of a GraphQL response listing orders
+type graphQLResponse struct {
+	Data struct {
+		Orders struct {
+			Orders []struct {
+				ID       string `json:"id"`
+				Customer *struct {
+					Name string `json:"name"`
+				} `json:"customer"`
+			} `json:"orders"`
+		} `json:"orders"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func TestGraphQLSpans(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	fake := newFakeStore(t, nil)
+	// three orders of two customers, and one of a customer that is not
+	// known
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if err := fake.CreateCustomer(ctx, &db.Customer{ID: "customer-2", Name: "Other", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for id, customer := range map[string]string{"order-2": "customer-1", "order-3": "customer-2", "order-4": "guest"} {
+		if err := fake.CreateOrder(ctx, &db.Order{ID: id, Customer: customer, Currency: "USD", Status: db.StatusCreated, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := newServer(t, tp, fake, fake)
+
+	rec := serve(srv, http.MethodPost, "/graphql", ordersQuery)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp graphQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) > 0 || len(resp.Data.Orders.Orders) != 4 {
+		t.Fatalf("got %s, want the four orders", rec.Body)
+	}
+	for _, o := range resp.Data.Orders.Orders {
+		if (o.Customer == nil) != (o.ID == "order-4") {
+			t.Errorf("order %s has customer %v", o.ID, o.Customer)
+		}
+	}
+
+	server := tracetest.RequireSpan(t, exporter, "/graphql",
+		semconv.HTTPStatusCodeKey.Int(http.StatusOK),
+		attribute.String("graphql.operation.name", "Orders"),
+	)
+	operation := tracetest.RequireSpan(t, exporter, "graphql Orders")
+	tracetest.RequireParentChild(t, server, operation)
+	list := tracetest.RequireSpan(t, exporter, "resolve Query.orders", attribute.Int("page.count", 4))
+	tracetest.RequireParentChild(t, operation, list)
+
+	var fields int
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "resolve Order.customer" {
+			fields++
+			tracetest.RequireDescendant(t, exporter, list, span)
+		}
+		// trivial fields are not traced
+		if span.Name == "resolve Order.id" {
+			t.Error("got a span for Order.id")
+		}
+	}
+	if fields != 4 {
+		t.Errorf("%d spans resolving Order.customer, want 4", fields)
+	}
+
+	// the customers of every order are loaded in a single batch, each once
+	batch := tracetest.RequireSpan(t, exporter, "dataloader customers",
+		attribute.Int("dataloader.batch_size", 3),
+		attribute.Int("dataloader.found", 2),
+	)
+	tracetest.RequireDescendant(t, exporter, list, batch)
+	tracetest.RequireNoSpan(t, exporter, "dataloader customers", attribute.Int("dataloader.batch_size", 1))
+	if len(batch.Links) != 3 {
+		t.Errorf("batch span has %d links, want one to each field it loaded a customer for", len(batch.Links))
+	}
+}
+
+func TestGraphQLStoreDown(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	fake := newFakeStore(t, errStore)
+	srv := newServer(t, tp, fake, fake)
+
+	rec := serve(srv, http.MethodPost, "/graphql", ordersQuery)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp graphQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 {
+		t.Fatalf("got %s, want the error of the store", rec.Body)
+	}
+
+	// the response is OK, but a failing resolver fails the spans up to the
+	// request
+	for _, name := range []string{"/graphql", "graphql Orders", "resolve Query.orders"} {
+		tracetest.RequireStatus(t, tracetest.RequireSpan(t, exporter, name), codes.Error)
+	}
+}
+
+func TestGraphQLInvalidArguments(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	fake := newFakeStore(t, nil)
+	srv := newServer(t, tp, fake, fake)
+
+	rec := serve(srv, http.MethodPost, "/graphql", `{"query": "{ orders(first: 1000) { nextCursor } }"}`)
+	var resp graphQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 {
+		t.Fatalf("got %s, want the first argument rejected", rec.Body)
+	}
+
+	// a query asking for too much is the fault of the client
+	field := tracetest.RequireSpan(t, exporter, "resolve Query.orders", attribute.StringSlice("graphql.field.arguments", []string{"first"}))
+	tracetest.RequireEvent(t, field, "exception")
+	for _, name := range []string{"/graphql", "graphql", "resolve Query.orders"} {
+		tracetest.RequireStatus(t, tracetest.RequireSpan(t, exporter, name), codes.Unset)
+	}
+}
+
+func TestGraphQLMaxDepth(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	fake := newFakeStore(t, nil)
+	srv := newServer(t, tp, fake, fake)
+
+	// customers and their orders refer to each other, so a query can nest
+	// them only so deep
+	rec := serve(srv, http.MethodPost, "/graphql",
+		`{"query": "{ customers { customers { orders { orders { customer { orders { nextCursor } } } } } } }"}`)
+	var resp graphQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "max depth") {
+		t.Fatalf("got %s, want the query rejected for its depth", rec.Body)
+	}
+	tracetest.RequireNoSpan(t, exporter, "resolve Query.customers")
+	tracetest.RequireEvent(t, tracetest.RequireSpan(t, exporter, "/graphql"), "validation failed")
+}
+
+func TestWithGraphQLScopes(t *testing.T) {
+	scopes := withGraphQLScopes(map[string][]string{
+		"GET /v1/orders":     {"orders:read"},
+		"GET /v1/orders/:id": {"orders:read"},
+		"GET /v1/customers":  {"customers:read"},
+		"POST /v1/orders":    {"orders:write"},
+		"POST /graphql":      {"graphql"},
+	})
+	if got := scopes["GET /graphql"]; !slices.Equal(got, []string{"orders:read", "customers:read"}) {
+		t.Errorf("GET /graphql needs %v, want the scopes of the routes it mirrors", got)
+	}
+	if got := scopes["POST /graphql"]; !slices.Equal(got, []string{"graphql"}) {
+		t.Errorf("POST /graphql needs %v, want the scopes configured for it", got)
+	}
+	if got := scopes["POST /v1/orders"]; !slices.Equal(got, []string{"orders:write"}) {
+		t.Errorf("POST /v1/orders needs %v, want its own scopes", got)
+	}
+}
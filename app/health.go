@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/buildinfo"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// readinessTimeout bounds how long the readiness checks may take together
+const readinessTimeout = 2 * time.Second
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// checkResult is the outcome of one readiness check
+type checkResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// healthz reports that the process is alive. It deliberately checks nothing
+// else so that a failing dependency does not get the process restarted.
+func (s *Server) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// version reports the build of the running binary, so a response can be
+// tied to a deploy
+func (s *Server) version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
+
+// readyz runs every readiness check concurrently and reports the status of
+// each dependency. It responds 503 if any check fails, other than an optional
+// one, whose failure is reported as degraded.
+func (s *Server) readyz(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]checkResult, len(s.checks))
+	ready, degraded := true, false
+	for name, check := range s.checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			res := s.runCheck(ctx, name, check)
+			mu.Lock()
+			defer mu.Unlock()
+			if res.Error != "" && s.optional[name] {
+				res.Status, degraded = "degraded", true
+			} else if res.Error != "" {
+				ready = false
+			}
+			results[name] = res
+		}(name, check)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	if degraded {
+		status = "degraded"
+	}
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+		span.SetStatus(codes.Error, "not ready")
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+	})
+}
+
+func (s *Server) runCheck(ctx context.Context, name string, check CheckFunc) checkResult {
+	ctx, span := s.tracer.Start(ctx, "check "+name, trace.WithAttributes(attribute.String("health.check", name)))
+	defer span.End()
+
+	start := time.Now()
+	err := check(ctx)
+	res := checkResult{Status: "ok", Duration: time.Since(start).String()}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		res.Status, res.Error = "error", err.Error()
+	}
+	return res
+}
@@ -0,0 +1,354 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/problem"
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (s *Server) getOrder(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	if id == "" {
+		handleErrorResponse(c, span, http.StatusBadRequest, errors.New("id is empty"))
+		return
+	}
+	span.SetAttributes(attribute.String("order.id", id))
+
+	order, err := s.orders.Get(ctx, id)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	if c.Query("expand") == "customer" {
+		s.respondWithCustomer(ctx, c, span, order)
+		return
+	}
+
+	etag := order.ETag()
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		revalidated := etagMatches(match, etag)
+		span.SetAttributes(attribute.Bool("http.cache.revalidated", revalidated))
+		if revalidated {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order": order,
+	})
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// headOrder reports whether an order exists without fetching it
+func (s *Server) headOrder(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("order.id", id))
+
+	exists, err := s.orders.Exists(ctx, id)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(attribute.Bool("order.exists", exists))
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// parsePage reads the cursor and limit query parameters of list requests
+func parsePage(c *gin.Context) (uint64, int64, error) {
+	cursor, err := strconv.ParseUint(c.DefaultQuery("cursor", "0"), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(orders.DefaultPageSize)), 10, 64)
+	if err != nil || limit < 1 || limit > orders.MaxPageSize {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", orders.MaxPageSize)
+	}
+	return cursor, limit, nil
+}
+
+// searchQuery are the filters of a list request. Orders are searched when
+// any is set. Text searches the customer and SKUs of orders in full text,
+// and cannot be combined with the other filters.
+type searchQuery struct {
+	Text      string    `form:"q" binding:"excluded_with=Customer Status CreatedOn"`
+	Customer  string    `form:"customer"`
+	Status    db.Status `form:"status" binding:"omitempty,oneof=created paid shipped delivered cancelled"`
+	CreatedOn string    `form:"created_on" binding:"omitempty,datetime=2006-01-02"`
+}
+
+func (s *Server) listOrders(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	cursor, limit, err := parsePage(c)
+	if err != nil {
+		handleErrorResponse(c, span, http.StatusBadRequest, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int64("page.cursor", int64(cursor)),
+		attribute.Int64("page.size", limit),
+	)
+
+	var query searchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+	q := db.Query{Customer: query.Customer, Status: query.Status, CreatedOn: query.CreatedOn}
+
+	var (
+		page []*db.Order
+		next uint64
+	)
+	switch {
+	case query.Text != "":
+		page, next, err = s.orders.SearchText(ctx, query.Text, cursor, limit)
+	case q.Empty():
+		page, next, err = s.orders.List(ctx, cursor, limit)
+	default:
+		span.SetAttributes(
+			attribute.String("query.customer", q.Customer),
+			attribute.String("query.status", string(q.Status)),
+			attribute.String("query.created_on", q.CreatedOn),
+		)
+		page, next, err = s.orders.Search(ctx, q, cursor, limit)
+	}
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("page.count", len(page)),
+		attribute.Int64("page.next_cursor", int64(next)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders":      page,
+		"next_cursor": strconv.FormatUint(next, 10),
+	})
+}
+
+func (s *Server) createOrder(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	var req orders.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+
+	order, err := s.orders.Create(ctx, req)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.SetAttributes(attribute.String("order.id", order.ID))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":    order.ID,
+		"order": order,
+	})
+}
+
+// batchRequest is the body of a batch order creation. The max matches
+// orders.MaxBatchSize.
+type batchRequest struct {
+	Orders []orders.Request `json:"orders" binding:"required,min=1,max=100"`
+}
+
+// batchResult reports the outcome of one order of a batch by its index in
+// the request
+type batchResult struct {
+	Index  int              `json:"index"`
+	Status int              `json:"status"`
+	Order  *db.Order        `json:"order,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// createOrderBatch creates up to orders.MaxBatchSize orders, answering with a
+// 207 that reports the outcome of each. Orders that fail validation are
+// reported without failing the rest. As with the status of a request, only
+// orders failing with a server error fail the span.
+func (s *Server) createOrderBatch(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	var req batchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("batch.size", len(req.Orders)))
+
+	results := make([]batchResult, len(req.Orders))
+	var failed, serverErrors int
+	for i, result := range s.orders.CreateBatch(ctx, req.Orders) {
+		results[i].Index = i
+		if result.Err == nil {
+			results[i].Status, results[i].Order = http.StatusCreated, result.Order
+			continue
+		}
+		failed++
+		var p problem.Problem
+		if fields := validation.FieldErrors(result.Err); len(fields) > 0 {
+			p = problem.Validation(fmt.Sprintf("%d field(s) failed validation", len(fields)), fields)
+		} else {
+			status := statusForError(result.Err)
+			if status >= http.StatusInternalServerError {
+				serverErrors++
+			}
+			p = problem.New(status, clientDetail(status, result.Err))
+		}
+		p = problem.WithTraceID(ctx, p)
+		results[i].Status, results[i].Error = p.Status, &p
+	}
+	span.SetAttributes(attribute.Int("batch.failed", failed))
+	if serverErrors > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d orders failed", serverErrors, len(results)))
+	}
+
+	c.JSON(http.StatusMultiStatus, gin.H{
+		"results": results,
+	})
+}
+
+func (s *Server) updateOrder(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("order.id", id))
+
+	var req orders.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+
+	order, err := s.orders.Update(ctx, id, req)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order": order,
+	})
+}
+
+// statusRequest is the body accepted when changing the status of an order
+type statusRequest struct {
+	Status db.Status `json:"status" binding:"required"`
+}
+
+func (s *Server) updateOrderStatus(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("order.id", id))
+
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleBindError(c, span, err)
+		return
+	}
+
+	order, from, err := s.orders.UpdateStatus(ctx, id, req.Status)
+	span.SetAttributes(
+		attribute.String("order.status.from", string(from)),
+		attribute.String("order.status.to", string(req.Status)),
+	)
+	if err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+	span.AddEvent("order status changed", trace.WithAttributes(
+		attribute.String("order.status.from", string(from)),
+		attribute.String("order.status.to", string(order.Status)),
+	))
+
+	c.JSON(http.StatusOK, gin.H{
+		"order": order,
+	})
+}
+
+func (s *Server) deleteOrder(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer span.End()
+
+	id := c.Param("id")
+	span.SetAttributes(attribute.String("order.id", id))
+
+	if err := s.orders.Delete(ctx, id); err != nil {
+		handleErrorResponse(c, span, statusForError(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// statusForError maps errors returned by the db package to HTTP status codes.
+// A deadline exceeded error means the request timeout elapsed mid call.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound), errors.Is(err, db.ErrCustomerNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrConflict), errors.Is(err, db.ErrOrderExists), errors.Is(err, db.ErrCustomerExists), errors.Is(err, db.ErrInvalidTransition),
+		errors.Is(err, db.ErrOutOfStock), errors.Is(err, inventory.ErrUnavailable):
+		return http.StatusConflict
+	case errors.Is(err, payments.ErrDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, orders.ErrDownstream):
+		return http.StatusBadGateway
+	case errors.Is(err, db.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, db.ErrSearchUnsupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,311 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/store"
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	sdktracetest "go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requireRequestSpan checks that the request answered by rec was traced by a
+// single SERVER span recording its status as the semantic conventions ask:
+// the status code in http.status_code, and the error of a rejected request
+// as an exception that only fails the span for a server error. It returns
+// the span.
+func requireRequestSpan(t *testing.T, exporter *sdktracetest.InMemoryExporter, rec *httptest.ResponseRecorder) sdktracetest.SpanStub {
+	t.Helper()
+	var servers []sdktracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.SpanKind == trace.SpanKindServer {
+			servers = append(servers, span)
+		}
+	}
+	if len(servers) != 1 {
+		t.Fatalf("got %d server spans, want 1", len(servers))
+	}
+	server := servers[0]
+	if code, _ := tracetest.Attribute(server, semconv.HTTPStatusCodeKey); code.AsInt64() != int64(rec.Code) {
+		t.Errorf("server span http.status_code %d, want the status %d of the response", code.AsInt64(), rec.Code)
+	}
+	if rec.Code >= http.StatusInternalServerError {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	tracetest.RequireStatus(t, server, codes.Unset)
+	return server
+}
+
+// exceptions counts the exception events of span
+func exceptions(span sdktracetest.SpanStub) int {
+	var n int
+	for _, event := range span.Events {
+		if event.Name == semconv.ExceptionEventName {
+			n++
+		}
+	}
+	return n
+}
+
+// FuzzCreateOrder sends arbitrary bodies to POST /v1/orders. Whatever the
+// body, the request must be answered without a panic, as a created order or
+// a client error recorded on its span.
+func FuzzCreateOrder(f *testing.F) {
+	for _, body := range []string{
+		validOrder,
+		`{"customer": "customer-1", "currency": "XXX", "items": [{"sku": "ABC-1234", "quantity": 2}]}`,
+		`{"customer": "customer-1", "currency": "USD", "items": []}`,
+		`{"customer": "customer-1", "currency": "USD", "items": [{"sku": "abc", "quantity": -1, "price": -5}]}`,
+		`{"customer": "customer-1", "currency": "USD", "items": [{"sku": "ABC-1234", "quantity": 1e400}]}`,
+		`{"customer": null, "items": [null]}`,
+		`{"customer": "customer-1"`,
+		`[]`,
+		`null`,
+		``,
+	} {
+		f.Add(body)
+	}
+	srv, exporter := newTestServer(f)
+	f.Fuzz(func(t *testing.T, body string) {
+		exporter.Reset()
+		rec := serve(srv, http.MethodPost, "/v1/orders", body)
+		server := requireRequestSpan(t, exporter, rec)
+
+		switch rec.Code {
+		case http.StatusCreated:
+			if id, ok := tracetest.Attribute(server, "order.id"); !ok || id.AsString() == "" {
+				t.Error("created order has no order.id on its span")
+			}
+			if n := exceptions(server); n != 0 {
+				t.Errorf("created order has %d exception events, want 0", n)
+			}
+		case http.StatusBadRequest:
+			if n := exceptions(server); n != 1 {
+				t.Errorf("rejected body has %d exception events, want 1", n)
+			}
+		default:
+			t.Errorf("status %d, want %d or %d: %s", rec.Code, http.StatusCreated, http.StatusBadRequest, rec.Body)
+		}
+	})
+}
+
+// FuzzGetOrder requests orders by arbitrary IDs. Every ID must be recorded
+// as it is in order.id, and answered as not found.
+func FuzzGetOrder(f *testing.F) {
+	for _, id := range []string{"missing", "order-1", " ", "%", "a/b", "..", "ünïcödé", "\x00", "?expand=customer"} {
+		f.Add(id)
+	}
+	srv, exporter := newTestServer(f)
+	f.Fuzz(func(t *testing.T, id string) {
+		if id == "" || strings.Contains(id, "/") {
+			// the path then leads to another route, or none
+			t.Skip()
+		}
+		exporter.Reset()
+		rec := serve(srv, http.MethodGet, "/v1/orders/"+url.PathEscape(id), "")
+		server := requireRequestSpan(t, exporter, rec)
+		if server.Name != "/v1/orders/:id" {
+			t.Fatalf("request traced as %q, want /v1/orders/:id", server.Name)
+		}
+		if got, _ := tracetest.Attribute(server, "order.id"); got.AsString() != id {
+			t.Errorf("server span order.id %q, want %q", got.AsString(), id)
+		}
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+		}
+		if n := exceptions(server); n != 1 {
+			t.Errorf("missing order has %d exception events, want 1", n)
+		}
+	})
+}
+
+// BenchmarkGetOrder measures the overhead of tracing on the hot path of
+// getOrder: the otelgin middleware, the handler annotating its span, and an
+// in-memory store that adds no spans of its own. Compare the sub-benchmarks
+// with
+//
+//	go test -run '^$' -bench GetOrder -benchmem ./app
+func BenchmarkGetOrder(b *testing.B) {
+	providers := []struct {
+		name string
+		tp   trace.TracerProvider
+	}{
+		// every span is sampled and batched to an exporter discarding it
+		{name: "traced", tp: sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(sdktracetest.NewNoopExporter()),
+		)},
+		// the sampler drops every trace, so spans are started but never
+		// recorded
+		{name: "sampled out", tp: sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.NeverSample()),
+			sdktrace.WithBatcher(sdktracetest.NewNoopExporter()),
+		)},
+		{name: "disabled", tp: trace.NewNoopTracerProvider()},
+	}
+	for _, p := range providers {
+		b.Run(p.name, func(b *testing.B) {
+			if tp, ok := p.tp.(*sdktrace.TracerProvider); ok {
+				b.Cleanup(func() { tp.Shutdown(context.Background()) })
+			}
+			router := newOrderRouter(b, p.tp)
+			req := httptest.NewRequest(http.MethodGet, "/v1/orders/order-1", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					b.Fatalf("status %d, want %d", rec.Code, http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+// newOrderRouter routes GET /v1/orders/:id to getOrder, traced by tp, with
+// a single order stored in memory
+func newOrderRouter(b *testing.B, tp trace.TracerProvider) *gin.Engine {
+	b.Helper()
+	orderStore := store.NewMemory()
+	now := time.Now().UTC()
+	order := &db.Order{ID: "order-1", Customer: "customer-1", Currency: "USD", Status: db.StatusCreated, CreatedAt: now, UpdatedAt: now}
+	order.SetItems([]db.Item{{SKU: "ABC-1234", Quantity: 2, Price: 5}})
+	if err := orderStore.CreateOrder(context.Background(), order); err != nil {
+		b.Fatal(err)
+	}
+
+	s := &Server{
+		orders: orders.NewService(orderStore, nil, nil, nil, nil, nil),
+		tracer: tp.Tracer(instrumentationName),
+	}
+	router := gin.New()
+	router.Use(otelgin.Middleware(instrumentationName, otelgin.WithTracerProvider(tp)))
+	router.GET("/v1/orders/:id", s.getOrder)
+	return router
+}
+
+func TestOrderHandlers(t *testing.T) {
+	t.Run("list", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders", []handlerTest{
+			{name: "ok", method: http.MethodGet, target: "/v1/orders", status: http.StatusOK},
+			{name: "search", method: http.MethodGet, target: "/v1/orders?customer=customer-1&status=created", status: http.StatusOK},
+			{name: "invalid limit", method: http.MethodGet, target: "/v1/orders?limit=0", status: http.StatusBadRequest},
+			{name: "invalid status", method: http.MethodGet, target: "/v1/orders?status=lost", status: http.StatusBadRequest},
+			{name: "store down", method: http.MethodGet, target: "/v1/orders", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("get", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/:id", []handlerTest{
+			{name: "ok", method: http.MethodGet, target: "/v1/orders/order-1", status: http.StatusOK},
+			{name: "with customer", method: http.MethodGet, target: "/v1/orders/order-1?expand=customer", status: http.StatusOK},
+			{name: "not found", method: http.MethodGet, target: "/v1/orders/missing", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodGet, target: "/v1/orders/order-1", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("head", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/:id", []handlerTest{
+			{name: "ok", method: http.MethodHead, target: "/v1/orders/order-1", status: http.StatusOK},
+			{name: "not found", method: http.MethodHead, target: "/v1/orders/missing", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodHead, target: "/v1/orders/order-1", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("create", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders", []handlerTest{
+			{name: "ok", method: http.MethodPost, target: "/v1/orders", body: validOrder, status: http.StatusCreated},
+			{name: "invalid", method: http.MethodPost, target: "/v1/orders", body: `{"customer": "customer-1"}`, status: http.StatusBadRequest},
+			{name: "malformed", method: http.MethodPost, target: "/v1/orders", body: `{`, status: http.StatusBadRequest},
+			{name: "store down", method: http.MethodPost, target: "/v1/orders", body: validOrder, err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("create batch", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/batch", []handlerTest{
+			{name: "ok", method: http.MethodPost, target: "/v1/orders/batch", body: `{"orders": [` + validOrder + `]}`, status: http.StatusMultiStatus},
+			{name: "empty", method: http.MethodPost, target: "/v1/orders/batch", body: `{"orders": []}`, status: http.StatusBadRequest},
+			// an invalid order is the fault of the client, like a 400
+			{name: "invalid order", method: http.MethodPost, target: "/v1/orders/batch", body: `{"orders": [` + validOrder + `, {"customer": "customer-1"}]}`, status: http.StatusMultiStatus},
+		})
+	})
+	t.Run("update", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/:id", []handlerTest{
+			{name: "ok", method: http.MethodPut, target: "/v1/orders/order-1", body: validOrder, status: http.StatusOK},
+			{name: "invalid", method: http.MethodPut, target: "/v1/orders/order-1", body: `{"currency": "XXX"}`, status: http.StatusBadRequest},
+			{name: "not found", method: http.MethodPut, target: "/v1/orders/missing", body: validOrder, status: http.StatusNotFound},
+			{name: "store down", method: http.MethodPut, target: "/v1/orders/order-1", body: validOrder, err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("update status", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/:id/status", []handlerTest{
+			{name: "ok", method: http.MethodPost, target: "/v1/orders/order-1/status", body: `{"status": "paid"}`, status: http.StatusOK},
+			{name: "invalid", method: http.MethodPost, target: "/v1/orders/order-1/status", body: `{}`, status: http.StatusBadRequest},
+			{name: "not found", method: http.MethodPost, target: "/v1/orders/missing/status", body: `{"status": "paid"}`, status: http.StatusNotFound},
+			{name: "invalid transition", method: http.MethodPost, target: "/v1/orders/order-1/status", body: `{"status": "delivered"}`, status: http.StatusConflict},
+			{name: "store down", method: http.MethodPost, target: "/v1/orders/order-1/status", body: `{"status": "paid"}`, err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+	t.Run("delete", func(t *testing.T) {
+		runHandlerTests(t, "/v1/orders/:id", []handlerTest{
+			{name: "ok", method: http.MethodDelete, target: "/v1/orders/order-1", status: http.StatusNoContent},
+			{name: "not found", method: http.MethodDelete, target: "/v1/orders/missing", status: http.StatusNotFound},
+			{name: "store down", method: http.MethodDelete, target: "/v1/orders/order-1", err: errStore, status: http.StatusInternalServerError},
+		})
+	})
+}
+
+func TestCreateOrderBatchSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		spanStatus codes.Code
+	}{
+		{name: "invalid", status: http.StatusBadRequest, spanStatus: codes.Unset},
+		{name: "store down", err: errStore, status: http.StatusInternalServerError, spanStatus: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := tracetest.Install(t)
+			fake := newFakeStore(t, tt.err)
+			srv := newServer(t, tp, fake, fake)
+
+			order := validOrder
+			if tt.err == nil {
+				order = `{"customer": "customer-1"}`
+			}
+			rec := serve(srv, http.MethodPost, "/v1/orders/batch", `{"orders": [`+order+`]}`)
+			var resp struct {
+				Results []batchResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusMultiStatus || len(resp.Results) != 1 || resp.Results[0].Status != tt.status {
+				t.Fatalf("got %d: %s, want the order failing with %d", rec.Code, rec.Body, tt.status)
+			}
+
+			server := tracetest.RequireSpan(t, exporter, "/v1/orders/batch", attribute.Int("batch.failed", 1))
+			tracetest.RequireStatus(t, server, tt.spanStatus)
+			// every order has a span of its own, linked to the request
+			item := tracetest.RequireSpan(t, exporter, "create batch order", attribute.Int("batch.index", 0))
+			if len(item.Links) != 1 || item.Links[0].SpanContext.SpanID() != server.SpanContext.SpanID() {
+				t.Errorf("order span has links %v, want one to the request", item.Links)
+			}
+			tracetest.RequireStatus(t, item, tt.spanStatus)
+		})
+	}
+}
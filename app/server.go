@@ -0,0 +1,412 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/auth"
+	"github.com/observiq/tracing/chaos"
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/customers"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/graphapi"
+	"github.com/observiq/tracing/grpcapi"
+	"github.com/observiq/tracing/idempotency"
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/jobs"
+	"github.com/observiq/tracing/middleware"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/pricing"
+	"github.com/observiq/tracing/ratelimit"
+	"github.com/observiq/tracing/scheduler"
+	"github.com/observiq/tracing/store"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// instrumentationName names the tracer and meter of the orders API
+const instrumentationName = "ordersAPI"
+
+// Deps are the dependencies a Server is constructed with
+type Deps struct {
+	// Store keeps the orders and is closed when the server stops
+	Store store.OrderStore
+	// Customers keeps the customers, usually in the same backend as Store
+	Customers store.CustomerStore
+	// Inventory checks stock before orders are created when set
+	Inventory *inventory.Client
+	// Pricing prices the items of orders when set
+	Pricing *pricing.Client
+	// Payments charges orders as they are created when set
+	Payments *payments.Client
+	// Events announces changes to orders when set
+	Events events.Publisher
+	// Jobs queues the fulfillment of paid orders when set
+	Jobs jobs.Queue
+	// Idempotency stores the responses to order creations retried with an
+	// Idempotency-Key when set
+	Idempotency idempotency.Store
+	// RateLimiter limits the requests of each client when set
+	RateLimiter *ratelimit.Limiter
+	// Chaos injects faults into requests when set. Its faults can be read
+	// and changed at /debug/chaos on the admin listener.
+	Chaos *chaos.Injector
+	// Verifier authenticates the bearer tokens of API requests when set
+	Verifier       *auth.Verifier
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	Logger         *slog.Logger
+	// MetricsHandler serves /metrics when set
+	MetricsHandler http.Handler
+	// Exemplars records request durations with an example trace when set
+	Exemplars middleware.ExemplarRecorder
+	// ExporterCheck verifies the span exporter is reachable. It is added to
+	// the readiness checks when set, but only degrades readiness, since the
+	// API keeps serving without its telemetry.
+	ExporterCheck CheckFunc
+	// TelemetryStatus serves /debug/telemetry on the admin listener when set
+	TelemetryStatus http.Handler
+	// Traces serves the spans of the in process OTLP receiver at
+	// /debug/traces on the admin listener when set
+	Traces http.Handler
+	// SpanStream streams a summary of each request span as it ends at
+	// /debug/stream on the admin listener when set
+	SpanStream http.Handler
+	// Watcher streams the status changes of orders to WebSocket clients at
+	// /v1/orders/:id/watch when set
+	Watcher events.Watcher
+}
+
+// Server owns the HTTP server, its router, and the resources its handlers
+// depend on, and tears them down in order on shutdown
+type Server struct {
+	router     *gin.Engine
+	httpServer *http.Server
+	// grpcServer serves the gRPC API, or is nil when disabled
+	grpcServer *grpc.Server
+	grpcAddr   string
+	// adminServer serves the debug endpoints, or is nil when disabled
+	adminServer    *http.Server
+	store          store.OrderStore
+	orders         *orders.Service
+	customers      *customers.Service
+	scheduler      *scheduler.Scheduler
+	watcher        events.Watcher
+	tracerProvider *sdktrace.TracerProvider
+	tracer         trace.Tracer
+	logger         *slog.Logger
+	checks         map[string]CheckFunc
+	// optional names the checks whose failure degrades readiness without
+	// failing it
+	optional map[string]bool
+
+	shutdownTimeout          time.Duration
+	telemetryShutdownTimeout time.Duration
+
+	// closing is cancelled when the HTTP server shuts down, ending the
+	// WebSocket sessions its shutdown does not wait for, which sessions
+	// tracks
+	closing  context.Context
+	sessions sync.WaitGroup
+}
+
+// New creates a server for the config with its routes registered
+func New(cfg config.Config, deps Deps) (*Server, error) {
+	s := &Server{
+		router:                   gin.New(),
+		store:                    deps.Store,
+		orders:                   orders.NewService(deps.Store, deps.Inventory, deps.Pricing, deps.Payments, deps.Events, deps.Jobs),
+		customers:                customers.NewService(deps.Customers),
+		watcher:                  deps.Watcher,
+		tracerProvider:           deps.TracerProvider,
+		tracer:                   deps.TracerProvider.Tracer(instrumentationName),
+		logger:                   deps.Logger,
+		checks:                   map[string]CheckFunc{"store": deps.Store.Ping},
+		optional:                 make(map[string]bool),
+		shutdownTimeout:          cfg.Server.ShutdownTimeout,
+		telemetryShutdownTimeout: cfg.Telemetry.ShutdownTimeout,
+	}
+	s.httpServer = &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      s.router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	var stopSessions context.CancelFunc
+	s.closing, stopSessions = context.WithCancel(context.Background())
+	s.httpServer.RegisterOnShutdown(stopSessions)
+
+	tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+	if err != nil {
+		return nil, err
+	}
+	s.httpServer.TLSConfig = tlsConfig
+
+	if cfg.Server.GRPCAddr != "" {
+		s.grpcServer = grpcapi.NewServer(s.orders, deps.TracerProvider, grpcapi.Access{
+			RateLimiter: deps.RateLimiter,
+			Verifier:    deps.Verifier,
+			RouteScopes: cfg.Auth.RouteScopes,
+			RBAC:        cfg.Auth.RBAC,
+			Roles:       cfg.Auth.Roles,
+			APIKeys:     cfg.Auth.APIKeys,
+			Logger:      deps.Logger,
+		})
+		s.grpcAddr = cfg.Server.GRPCAddr
+	}
+	if cfg.Server.AdminAddr != "" {
+		s.adminServer = newAdminServer(cfg.Server.AdminAddr, deps.Chaos, deps.TelemetryStatus, deps.Traces, deps.SpanStream)
+	}
+	s.scheduler, err = newScheduler(cfg.Scheduler, s.orders)
+	if err != nil {
+		return nil, fmt.Errorf("create scheduler: %w", err)
+	}
+
+	metrics, err := middleware.Metrics(deps.MeterProvider.Meter(instrumentationName), deps.Exemplars)
+	if err != nil {
+		return nil, err
+	}
+	s.router.Use(metrics, middleware.Recovery(deps.Logger))
+	if deps.ExporterCheck != nil {
+		s.checks["exporter"] = deps.ExporterCheck
+		s.optional["exporter"] = true
+	}
+	s.router.GET("/healthz", s.healthz)
+	s.router.GET("/readyz", s.readyz)
+	s.router.GET("/version", s.version)
+	if deps.MetricsHandler != nil {
+		s.router.GET("/metrics", gin.WrapH(deps.MetricsHandler))
+	}
+
+	// the versioned REST API and GraphQL share their middleware
+	api := s.router.Group("")
+	api.Use(
+		otelgin.Middleware(instrumentationName, otelgin.WithTracerProvider(deps.TracerProvider)),
+		middleware.Baggage(map[string]string{
+			"X-Customer-Id": "customer.id",
+			"X-Tenant-Id":   "tenant.id",
+		}),
+		middleware.TraceHeaders(),
+		middleware.AccessLog(deps.Logger),
+	)
+	if compression := cfg.Server.Compression; compression.Enabled {
+		api.Use(middleware.Compress(compression.MinSize, compression.ContentTypes))
+	}
+	api.Use(
+		middleware.Recovery(deps.Logger),
+		middleware.Timeout(cfg.Server.RequestTimeout, cfg.Server.RouteTimeouts),
+	)
+	if deps.Chaos != nil {
+		api.Use(middleware.Chaos(deps.Chaos))
+	}
+	if deps.RateLimiter != nil {
+		limit, err := middleware.RateLimit(deps.RateLimiter, cfg.Auth.APIKeys, deps.MeterProvider.Meter(instrumentationName), deps.Logger)
+		if err != nil {
+			return nil, err
+		}
+		api.Use(limit)
+	}
+	if deps.Verifier != nil {
+		api.Use(middleware.Auth(deps.Verifier, withGraphQLScopes(cfg.Auth.RouteScopes)))
+	}
+	graphql, err := graphapi.NewHandler(s.orders, s.customers, deps.TracerProvider)
+	if err != nil {
+		return nil, err
+	}
+	api.GET("/graphql", gin.WrapH(graphql))
+	api.POST("/graphql", gin.WrapH(graphql))
+
+	v1 := api.Group("/v1")
+	v1.GET("/orders", s.listOrders)
+	v1.GET("/orders/:id", s.getOrder)
+	v1.HEAD("/orders/:id", s.headOrder)
+	if deps.Watcher != nil {
+		v1.GET("/orders/:id/watch", s.watchOrder)
+	}
+
+	// mutations are checked against the roles of the client when RBAC is
+	// enabled
+	writes := v1.Group("")
+	if cfg.Auth.RBAC {
+		writes.Use(middleware.Authorize(cfg.Auth.Roles, cfg.Auth.APIKeys, auth.PermOrdersWrite))
+	}
+	var idempotent []gin.HandlerFunc
+	if deps.Idempotency != nil {
+		idempotent = []gin.HandlerFunc{
+			middleware.Idempotency(deps.Idempotency, cfg.Idempotency.TTL, cfg.Idempotency.LockTTL, deps.Logger),
+		}
+	}
+	writes.POST("/orders", append(idempotent, s.createOrder)...)
+	// rather than the custom method /orders:batch, which gin reads as a
+	// path parameter matching any suffix of /orders
+	writes.POST("/orders/batch", append(idempotent, s.createOrderBatch)...)
+	writes.PUT("/orders/:id", s.updateOrder)
+	writes.DELETE("/orders/:id", s.deleteOrder)
+	writes.POST("/orders/:id/status", s.updateOrderStatus)
+
+	v1.GET("/customers", s.listCustomers)
+	v1.GET("/customers/:id", s.getCustomer)
+	v1.GET("/customers/:id/orders", s.listCustomerOrders)
+	customerWrites := v1.Group("")
+	if cfg.Auth.RBAC {
+		customerWrites.Use(middleware.Authorize(cfg.Auth.Roles, cfg.Auth.APIKeys, auth.PermCustomersWrite))
+	}
+	customerWrites.POST("/customers", s.createCustomer)
+	customerWrites.PUT("/customers/:id", s.updateCustomer)
+	customerWrites.DELETE("/customers/:id", s.deleteCustomer)
+	return s, nil
+}
+
+// withGraphQLScopes returns a copy of the scopes of the REST routes in
+// which /graphql needs every scope of the routes whose data it serves, as a
+// query may read any of it. Scopes configured for /graphql itself are kept.
+func withGraphQLScopes(routeScopes map[string][]string) map[string][]string {
+	var union []string
+	seen := make(map[string]bool)
+	for _, route := range graphapi.Routes {
+		for _, scope := range routeScopes[route] {
+			if !seen[scope] {
+				seen[scope] = true
+				union = append(union, scope)
+			}
+		}
+	}
+	scopes := make(map[string][]string, len(routeScopes)+2)
+	for route, s := range routeScopes {
+		scopes[route] = s
+	}
+	for _, route := range []string{"GET /graphql", "POST /graphql"} {
+		if _, ok := scopes[route]; !ok {
+			scopes[route] = union
+		}
+	}
+	return scopes
+}
+
+// Handler returns the router serving every route of the server
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Start serves HTTP, and the gRPC API and admin endpoints when enabled, until
+// the server is stopped. Failures of the gRPC and admin servers are logged
+// rather than returned. The scheduled tasks run alongside.
+func (s *Server) Start() error {
+	s.scheduler.Start()
+	if s.grpcServer != nil {
+		go func() {
+			s.logger.Info("serving grpc", "addr", s.grpcAddr)
+			if err := s.serveGRPC(); err != nil {
+				s.logger.Error("serve grpc", "error", err)
+			}
+		}()
+	}
+	if s.adminServer != nil {
+		go func() {
+			s.logger.Info("serving admin endpoints", "addr", s.adminServer.Addr)
+			if err := s.adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("serve admin", "error", err)
+			}
+		}()
+	}
+
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		// the certificate is already loaded into the TLS config
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop stops accepting connections and drains in-flight requests, then
+// closes the store and flushes buffered spans. Each phase has its own timeout so
+// a slow drain cannot prevent the spans describing it from being exported.
+func (s *Server) Stop() error {
+	ctx, span := s.tracer.Start(context.Background(), "shutdown")
+	s.logger.InfoContext(ctx, "shutting down", "drain_timeout", s.shutdownTimeout)
+
+	var errs []error
+	start := time.Now()
+	drainCtx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
+	grpcStopped := make(chan struct{})
+	go func() {
+		defer close(grpcStopped)
+		if s.grpcServer != nil {
+			s.stopGRPC(drainCtx)
+		}
+	}()
+	err := s.httpServer.Shutdown(drainCtx)
+	<-grpcStopped
+	s.sessions.Wait()
+	cancel()
+	if err != nil {
+		err = fmt.Errorf("drain http server: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		errs = append(errs, err, s.httpServer.Close())
+	}
+	span.AddEvent("http server drained", trace.WithAttributes(
+		attribute.Int64("shutdown.drain_ms", time.Since(start).Milliseconds()),
+	))
+	if s.adminServer != nil {
+		errs = append(errs, s.adminServer.Close())
+	}
+	errs = append(errs, s.scheduler.Close())
+	// the store is closed before the spans are flushed, so the spans of its
+	// last writes, like the final flush of write behind, are exported
+	if err := s.store.Close(); err != nil {
+		err = fmt.Errorf("close store: %w", err)
+		span.RecordError(err)
+		errs = append(errs, err)
+	}
+	span.End()
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), s.telemetryShutdownTimeout)
+	defer cancel()
+	if err := s.tracerProvider.Shutdown(flushCtx); err != nil {
+		errs = append(errs, fmt.Errorf("flush spans: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) serveGRPC() error {
+	lis, err := net.Listen("tcp", s.grpcAddr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return s.grpcServer.Serve(lis)
+}
+
+// stopGRPC waits for in-flight calls to finish, cancelling them once ctx is
+// done
+func (s *Server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
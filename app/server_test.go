@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/store"
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	sdktracetest "go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := validation.Register(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer creates a server storing orders in SQLite whose spans, and
+// those of the database, are recorded in the returned exporter
+func newTestServer(t testing.TB) (*Server, *sdktracetest.InMemoryExporter) {
+	t.Helper()
+	tp, exporter := tracetest.Install(t)
+
+	s, err := store.NewSQLite(context.Background(), filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	srv := newServer(t, tp, s, s)
+	// leave out the spans of the schema migration
+	exporter.Reset()
+	return srv, exporter
+}
+
+// newServer creates a server with the default config, less the gRPC and
+// admin listeners, keeping orders and customers in the given stores. Each of
+// opts sets more of its dependencies.
+func newServer(t testing.TB, tp *sdktrace.TracerProvider, orders store.OrderStore, customers store.CustomerStore, opts ...func(*Deps)) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Server.GRPCAddr = ""
+	cfg.Server.AdminAddr = ""
+	deps := Deps{
+		Store:          orders,
+		Customers:      customers,
+		TracerProvider: tp,
+		MeterProvider:  metric.NewNoopMeterProvider(),
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, opt := range opts {
+		opt(&deps)
+	}
+	srv, err := New(cfg, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// serve sends a request to the server and returns its response
+func serve(srv *Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// errStore is the failure of a store that is down
+var errStore = errors.New("connection refused")
+
+// handlerTest is a request to a route and the response it should get from
+// a server whose store holds order-1 of customer-1
+type handlerTest struct {
+	name   string
+	method string
+	target string
+	body   string
+	// err fails every call to the store when set
+	err    error
+	status int
+}
+
+// runHandlerTests sends the request of each test to a server backed by a
+// fake store, and checks the status of the response and that its span,
+// named route, recorded it. Only server errors fail the span.
+func runHandlerTests(t *testing.T, route string, tests []handlerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := tracetest.Install(t)
+			fake := newFakeStore(t, tt.err)
+			srv := newServer(t, tp, fake, fake)
+
+			rec := serve(srv, tt.method, tt.target, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.err != nil && strings.Contains(rec.Body.String(), tt.err.Error()) {
+				t.Errorf("the body leaks the error of the store: %s", rec.Body)
+			}
+			server := tracetest.RequireSpan(t, exporter, route, semconv.HTTPStatusCodeKey.Int(tt.status))
+			want := codes.Unset
+			if tt.status >= http.StatusInternalServerError {
+				want = codes.Error
+			}
+			tracetest.RequireStatus(t, server, want)
+		})
+	}
+}
+
+const validOrder = `{"customer": "customer-1", "currency": "USD", "items": [{"sku": "ABC-1234", "quantity": 2, "price": 5}]}`
+
+func TestCreateOrderSpans(t *testing.T) {
+	srv, exporter := newTestServer(t)
+
+	rec := serve(srv, http.MethodPost, "/v1/orders", validOrder)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	server := tracetest.RequireSpan(t, exporter, "/v1/orders",
+		semconv.HTTPMethodKey.String(http.MethodPost),
+		semconv.HTTPRouteKey.String("/v1/orders"),
+		semconv.HTTPStatusCodeKey.Int(http.StatusCreated),
+	)
+	if server.Parent.IsValid() {
+		t.Errorf("server span has parent %s, want a root span", server.Parent.SpanID())
+	}
+	tracetest.RequireStatus(t, server, codes.Unset)
+	if id, ok := tracetest.Attribute(server, "order.id"); !ok || id.AsString() == "" {
+		t.Error("server span has no order.id, the handler should annotate the span of the request")
+	}
+
+	var servers, inserts int
+	for _, span := range exporter.GetSpans() {
+		if span.SpanKind == trace.SpanKindServer {
+			servers++
+		}
+		statement, ok := tracetest.Attribute(span, semconv.DBStatementKey)
+		if !ok {
+			continue
+		}
+		tracetest.RequireDescendant(t, exporter, server, span)
+		if strings.HasPrefix(statement.AsString(), "INSERT INTO orders") {
+			inserts++
+		}
+	}
+	if servers != 1 {
+		t.Errorf("got %d server spans, want the handler to annotate the one of otelgin", servers)
+	}
+	if inserts != 1 {
+		t.Errorf("got %d order inserts traced, want 1", inserts)
+	}
+}
+
+func TestGetOrderSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		spanStatus codes.Code
+		exceptions int
+	}{
+		{name: "found", status: http.StatusOK, spanStatus: codes.Unset},
+		// a client error is recorded without failing the span
+		{name: "not found", status: http.StatusNotFound, spanStatus: codes.Unset, exceptions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, exporter := newTestServer(t)
+			id := "missing"
+			if tt.status == http.StatusOK {
+				rec := serve(srv, http.MethodPost, "/v1/orders", validOrder)
+				if rec.Code != http.StatusCreated {
+					t.Fatalf("create order: status %d: %s", rec.Code, rec.Body)
+				}
+				created, _ := tracetest.Attribute(tracetest.RequireSpan(t, exporter, "/v1/orders"), "order.id")
+				id = created.AsString()
+				exporter.Reset()
+			}
+
+			rec := serve(srv, http.MethodGet, "/v1/orders/"+id, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			server := tracetest.RequireSpan(t, exporter, "/v1/orders/:id",
+				attribute.String("order.id", id),
+				semconv.HTTPStatusCodeKey.Int(tt.status),
+			)
+			tracetest.RequireStatus(t, server, tt.spanStatus)
+			var exceptions int
+			for _, event := range server.Events {
+				if event.Name == semconv.ExceptionEventName {
+					exceptions++
+				}
+			}
+			if exceptions != tt.exceptions {
+				t.Errorf("server span has %d exception events, want %d", exceptions, tt.exceptions)
+			}
+		})
+	}
+}
+
+func TestCreateOrderValidationSpans(t *testing.T) {
+	srv, exporter := newTestServer(t)
+
+	rec := serve(srv, http.MethodPost, "/v1/orders", `{"customer": "customer-1", "currency": "XXX", "items": [{"sku": "ABC-1234", "quantity": 2}]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	server := tracetest.RequireSpan(t, exporter, "/v1/orders", semconv.HTTPStatusCodeKey.Int(http.StatusBadRequest))
+	tracetest.RequireEvent(t, server, "validation failed")
+	var fields []string
+	for _, event := range server.Events {
+		if event.Name != "validation failed" {
+			continue
+		}
+		for _, kv := range event.Attributes {
+			if kv.Key == "validation.field" {
+				fields = append(fields, kv.Value.AsString())
+			}
+		}
+	}
+	if len(fields) != 1 || fields[0] != "currency" {
+		t.Errorf("validation events for fields %q, want currency", fields)
+	}
+	for _, span := range exporter.GetSpans() {
+		if _, ok := tracetest.Attribute(span, semconv.DBStatementKey); ok {
+			t.Errorf("rejected request reached the database: %s", span.Name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/scheduler"
+)
+
+// newScheduler creates the scheduler of the periodic tasks enabled by the
+// config. Each run is bounded by the interval of its task, so a stuck run
+// cannot hold up the next.
+func newScheduler(cfg config.SchedulerConfig, svc *orders.Service) (*scheduler.Scheduler, error) {
+	var tasks []scheduler.Task
+	if cfg.ExpireInterval > 0 {
+		tasks = append(tasks, scheduler.Task{
+			Name:     "expire stale orders",
+			Interval: cfg.ExpireInterval,
+			Timeout:  cfg.ExpireInterval,
+			Run: func(ctx context.Context) error {
+				_, err := svc.ExpireStale(ctx, cfg.ExpireAfter)
+				return err
+			},
+		})
+	}
+	if cfg.StatsInterval > 0 {
+		stats, err := orders.NewStatsReporter(svc)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, scheduler.Task{
+			Name:     "recompute order stats",
+			Interval: cfg.StatsInterval,
+			Timeout:  cfg.StatsInterval,
+			Run:      stats.Recompute,
+		})
+	}
+	return scheduler.New(tasks...)
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/websocket"
+)
+
+// watchSnapshot is the type of the first message of a watch, describing the
+// order as it is when the watch starts
+const watchSnapshot = "order.snapshot"
+
+// watchMessage is a message sent to the client watching an order
+type watchMessage struct {
+	Type    string    `json:"type"`
+	OrderID string    `json:"order_id"`
+	Status  db.Status `json:"status,omitempty"`
+	Time    time.Time `json:"time"`
+	// TraceID is the trace of the request that changed the order
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// watchOrder upgrades the request to a WebSocket and sends the order as it
+// is, then each change of its status, until the client disconnects, the
+// order is deleted, or the server shuts down. The SERVER span of the
+// request lasts as long as the session, with an event for each message
+// sent.
+func (s *Server) watchOrder(c *gin.Context) {
+	// counted from the start, so the span has ended once the session is done
+	s.sessions.Add(1)
+	defer s.sessions.Done()
+	ctx, sp := span.Handler(c.Request, s.tracer, c.FullPath())
+	defer sp.End()
+
+	id := c.Param("id")
+	sp.SetAttributes(attribute.String("order.id", id))
+	// the WebSocket server takes over the connection before checking the
+	// handshake, so a handshake it would reject is rejected first, while its
+	// status can still be set
+	if err := checkHandshake(c.Request); err != nil {
+		if errors.Is(err, errWebSocketVersion) {
+			c.Header("Sec-WebSocket-Version", websocket.SupportedProtocolVersion)
+		}
+		handleErrorResponse(c, sp, http.StatusBadRequest, err)
+		return
+	}
+	// watch before reading the order, so no change is missed in between
+	changes, stop := s.watcher.Watch(id)
+	defer stop()
+	order, err := s.orders.Get(ctx, id)
+	if err != nil {
+		handleErrorResponse(c, sp, statusForError(err), err)
+		return
+	}
+
+	// the HTTP server neither drains nor cancels a hijacked connection, so
+	// the session ends when the server starts shutting down instead
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stopped := context.AfterFunc(s.closing, cancel)
+	defer stopped()
+
+	// the handshake writes its response itself, over the connection it took
+	// over, so the status is only recorded for the instrumentation and
+	// cannot be replaced afterwards. Having passed checkHandshake, it fails
+	// only when its response cannot be written to a client that is gone.
+	c.Writer.WriteHeader(http.StatusSwitchingProtocols)
+	var opened bool
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		opened = true
+		s.watchSession(ctx, sp, conn, order, changes)
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+	if !opened {
+		span.RecordHTTPError(sp, http.StatusBadRequest, errHandshake)
+	}
+}
+
+var (
+	errNotWebSocket     = errors.New("watching an order needs a WebSocket")
+	errWebSocketVersion = errors.New("unsupported WebSocket version, want " + websocket.SupportedProtocolVersion)
+	errHandshake        = errors.New("websocket handshake failed")
+)
+
+// checkHandshake returns an error unless r is a WebSocket handshake the
+// WebSocket server accepts
+func checkHandshake(r *http.Request) error {
+	if !isWebSocketUpgrade(r) || r.Header.Get("Sec-WebSocket-Key") == "" {
+		return errNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != websocket.SupportedProtocolVersion {
+		return errWebSocketVersion
+	}
+	return nil
+}
+
+// isWebSocketUpgrade reports whether r asks to upgrade to a WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, token := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchSession sends the messages of a watch to conn
+func (s *Server) watchSession(ctx context.Context, sp trace.Span, conn *websocket.Conn, order *db.Order, changes <-chan events.Event) {
+	defer conn.Close()
+	// the deadlines the HTTP server set for the request would end the session
+	conn.SetDeadline(time.Time{})
+	start := time.Now()
+	sp.AddEvent("websocket opened")
+
+	// the client sends nothing, but reading notices it disconnecting
+	disconnected := make(chan error, 1)
+	go func() {
+		var discard []byte
+		for {
+			if err := websocket.Message.Receive(conn, &discard); err != nil {
+				disconnected <- err
+				return
+			}
+		}
+	}()
+
+	var sent int
+	send := func(m watchMessage) error {
+		sent++
+		sp.AddEvent("message", trace.WithAttributes(
+			semconv.MessageTypeSent,
+			semconv.MessageIDKey.Int(sent),
+			attribute.String("event.type", m.Type),
+			attribute.String("order.status", string(m.Status)),
+		))
+		return websocket.JSON.Send(conn, m)
+	}
+
+	var reason string
+	err := send(watchMessage{
+		Type:    watchSnapshot,
+		OrderID: order.ID,
+		Status:  order.Status,
+		Time:    order.UpdatedAt,
+	})
+	for err == nil && reason == "" {
+		select {
+		case <-ctx.Done():
+			reason = "server shutdown"
+		case readErr := <-disconnected:
+			reason = "client disconnected"
+			s.logger.DebugContext(ctx, "watch client disconnected", "order_id", order.ID, "error", readErr)
+		case e := <-changes:
+			if e.Type != events.OrderStatusChanged && e.Type != events.OrderDeleted {
+				continue
+			}
+			m := watchMessage{Type: string(e.Type), OrderID: e.OrderID, Status: e.Status, Time: e.Time}
+			if sc := e.SpanContext(); sc.IsValid() {
+				m.TraceID = sc.TraceID().String()
+			}
+			err = send(m)
+			if e.Type == events.OrderDeleted {
+				reason = "order deleted"
+			}
+		}
+	}
+	if err != nil {
+		reason = "send failed"
+		sp.RecordError(err)
+		sp.SetStatus(codes.Error, err.Error())
+	}
+	sp.AddEvent("websocket closed", trace.WithAttributes(
+		attribute.String("websocket.close_reason", reason),
+	))
+	sp.SetAttributes(
+		attribute.Int("websocket.messages_sent", sent),
+		attribute.Int64("websocket.session_ms", time.Since(start).Milliseconds()),
+	)
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"golang.org/x/net/websocket"
+)
+
+// fakeWatcher hands the events sent on its channel to the watch of any order
+type fakeWatcher struct {
+	events  chan events.Event
+	stopped chan struct{}
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{events: make(chan events.Event), stopped: make(chan struct{})}
+}
+
+func (w *fakeWatcher) Watch(string) (<-chan events.Event, func()) {
+	return w.events, func() { close(w.stopped) }
+}
+
+func TestWatchOrder(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	fake := newFakeStore(t, nil)
+	watcher := newFakeWatcher()
+	srv := newServer(t, tp, fake, fake, func(d *Deps) { d.Watcher = watcher })
+	api := httptest.NewServer(srv.Handler())
+	defer api.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(api.URL, "http")+"/v1/orders/order-1/watch", "", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	receive := func(wantType string, wantStatus db.Status) {
+		t.Helper()
+		var m watchMessage
+		if err := websocket.JSON.Receive(conn, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != wantType || m.OrderID != "order-1" || m.Status != wantStatus {
+			t.Fatalf("got message %+v, want a %s of order-1 %s", m, wantType, wantStatus)
+		}
+	}
+	receive(watchSnapshot, db.StatusCreated)
+	// changes other than of the status are not sent
+	watcher.events <- events.Event{Type: events.OrderUpdated, OrderID: "order-1", Status: db.StatusCreated}
+	watcher.events <- events.Event{Type: events.OrderStatusChanged, OrderID: "order-1", Status: db.StatusPaid}
+	receive(string(events.OrderStatusChanged), db.StatusPaid)
+	watcher.events <- events.Event{Type: events.OrderDeleted, OrderID: "order-1", Status: db.StatusPaid}
+	receive(string(events.OrderDeleted), db.StatusPaid)
+
+	// the session ends with the deletion of the order
+	var discard []byte
+	if err := websocket.Message.Receive(conn, &discard); err != io.EOF {
+		t.Fatalf("got %v once the order was deleted, want the connection closed", err)
+	}
+	<-watcher.stopped
+	srv.sessions.Wait()
+
+	span := tracetest.RequireSpan(t, exporter, "/v1/orders/:id/watch",
+		semconv.HTTPStatusCodeKey.Int(http.StatusSwitchingProtocols),
+		attribute.String("order.id", "order-1"),
+		attribute.Int("websocket.messages_sent", 3),
+	)
+	tracetest.RequireStatus(t, span, codes.Unset)
+	tracetest.RequireEvent(t, span, "websocket opened")
+	var messages int
+	for _, e := range span.Events {
+		if e.Name == "message" {
+			messages++
+		}
+	}
+	if messages != 3 {
+		t.Errorf("%d message events, want 3", messages)
+	}
+	closed := tracetest.RequireEvent(t, span, "websocket closed")
+	if len(closed.Attributes) != 1 || closed.Attributes[0].Value.AsString() != "order deleted" {
+		t.Errorf("websocket closed with %v, want the order deleted", closed.Attributes)
+	}
+}
+
+func TestWatchOrderEndsOnShutdown(t *testing.T) {
+	tp, _ := tracetest.Install(t)
+	fake := newFakeStore(t, nil)
+	srv := newServer(t, tp, fake, fake, func(d *Deps) { d.Watcher = newFakeWatcher() })
+	api := httptest.NewServer(srv.Handler())
+	defer api.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(api.URL, "http")+"/v1/orders/order-1/watch", "", api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	var m watchMessage
+	if err := websocket.JSON.Receive(conn, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := srv.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	var discard []byte
+	if err := websocket.Message.Receive(conn, &discard); err != io.EOF {
+		t.Fatalf("got %v once the server stopped, want the connection closed", err)
+	}
+}
+
+func TestWatchOrderHandler(t *testing.T) {
+	route := "/v1/orders/:id/watch"
+	for _, tt := range []struct {
+		name    string
+		target  string
+		upgrade bool
+		version string
+		status  int
+	}{
+		{name: "not found", target: "/v1/orders/missing/watch", upgrade: true, status: http.StatusNotFound},
+		{name: "not websocket", target: "/v1/orders/order-1/watch", status: http.StatusBadRequest},
+		// rejected before the handshake takes over the connection, so the
+		// status is recorded
+		{name: "unsupported version", target: "/v1/orders/order-1/watch", upgrade: true, version: "8", status: http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := tracetest.Install(t)
+			fake := newFakeStore(t, nil)
+			srv := newServer(t, tp, fake, fake, func(d *Deps) { d.Watcher = newFakeWatcher() })
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+				req.Header.Set("Sec-WebSocket-Version", "13")
+			}
+			if tt.version != "" {
+				req.Header.Set("Sec-WebSocket-Version", tt.version)
+			}
+			rec := httptest.NewRecorder()
+			srv.router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			tracetest.RequireSpan(t, exporter, route, semconv.HTTPStatusCodeKey.Int(tt.status))
+		})
+	}
+}
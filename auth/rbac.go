@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+)
+
+// Permissions checked by the API
+const (
+	// PermOrdersWrite allows creating, updating, and deleting orders, and
+	// changing their status
+	PermOrdersWrite = "orders:write"
+	// PermCustomersWrite allows creating, updating, and deleting customers
+	PermCustomersWrite = "customers:write"
+)
+
+// Policy grants permissions to roles, mapping each role to its permissions
+type Policy map[string][]string
+
+// Allows reports whether any of roles is granted permission
+func (p Policy) Allows(roles []string, permission string) bool {
+	for _, role := range roles {
+		if slices.Contains(p[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey describes the client an API key belongs to
+type APIKey struct {
+	Subject string   `yaml:"subject"`
+	Roles   []string `yaml:"roles"`
+}
+
+// APIKeys maps the hashes of API keys, see HashAPIKey, to their clients, so
+// the keys themselves need not be stored
+type APIKeys map[string]APIKey
+
+// Lookup returns the client of key
+func (k APIKeys) Lookup(key string) (APIKey, bool) {
+	if key == "" {
+		return APIKey{}, false
+	}
+	client, ok := k[HashAPIKey(key)]
+	return client, ok
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
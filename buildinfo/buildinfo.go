@@ -0,0 +1,73 @@
+// Package buildinfo describes the build of the running binary, so traces and
+// metrics can be correlated to deploys. The version, commit, and build time
+// are set at link time:
+//
+//	go build -ldflags "-X github.com/observiq/tracing/buildinfo.Version=v1.2.3
+//	  -X github.com/observiq/tracing/buildinfo.Commit=$(git rev-parse HEAD)
+//	  -X github.com/observiq/tracing/buildinfo.Time=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When they are not, the commit and time recorded by the go tool from the
+// VCS are used instead.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags -X
+var (
+	// Version is the release version
+	Version = "dev"
+	// Commit is the git SHA the binary was built from
+	Commit = ""
+	// Time is when the binary was built, in RFC 3339
+	Time = ""
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Time      string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Modified is set when the working tree had uncommitted changes
+	Modified bool `json:"modified,omitempty"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build of the running binary
+func Get() Info {
+	once.Do(func() {
+		info = Info{
+			Version:   Version,
+			Commit:    Commit,
+			Time:      Time,
+			GoVersion: runtime.Version(),
+		}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Time == "" {
+					info.Time = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	})
+	return info
+}
@@ -0,0 +1,177 @@
+// Package chaos injects faults into requests and redis commands at random,
+// so the example produces slow and failing traces on demand
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Faults are the faults to inject and how often. Rates are probabilities
+// between 0 and 1. In JSON the latency is written as a duration.
+type Faults struct {
+	// Latency is added to requests at LatencyRate
+	Latency     time.Duration `json:"-"`
+	LatencyRate float64       `json:"latency_rate"`
+	// ErrorStatus is the status requests fail with at ErrorRate
+	ErrorStatus int     `json:"error_status"`
+	ErrorRate   float64 `json:"error_rate"`
+	// RedisTimeoutRate is how often redis commands time out without being
+	// sent
+	RedisTimeoutRate float64 `json:"redis_timeout_rate"`
+}
+
+// faultsJSON is Faults with the latency written as a duration, e.g. "500ms"
+type faultsJSON struct {
+	Latency string `json:"latency"`
+	*faultsAlias
+}
+
+// faultsAlias has the fields of Faults without its JSON methods
+type faultsAlias Faults
+
+func (f Faults) MarshalJSON() ([]byte, error) {
+	return json.Marshal(faultsJSON{Latency: f.Latency.String(), faultsAlias: (*faultsAlias)(&f)})
+}
+
+func (f *Faults) UnmarshalJSON(data []byte) error {
+	v := faultsJSON{Latency: f.Latency.String(), faultsAlias: (*faultsAlias)(f)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	latency, err := time.ParseDuration(v.Latency)
+	if err != nil {
+		return fmt.Errorf("latency: %w", err)
+	}
+	f.Latency = latency
+	return nil
+}
+
+// Validate reports whether the faults can be injected
+func (f Faults) Validate() error {
+	for _, rate := range []float64{f.LatencyRate, f.ErrorRate, f.RedisTimeoutRate} {
+		if rate < 0 || rate > 1 {
+			return errors.New("fault rates must be between 0 and 1")
+		}
+	}
+	if f.Latency < 0 {
+		return errors.New("fault latency must not be negative")
+	}
+	if f.ErrorRate > 0 && (f.ErrorStatus < 400 || f.ErrorStatus > 599) {
+		return errors.New("fault error status must be a 4xx or 5xx status")
+	}
+	return nil
+}
+
+// ErrRedisTimeout is the error of redis commands failed by the injector. It
+// is a net.Error that timed out, so it is handled like a real timeout.
+var ErrRedisTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "chaos: injected redis timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Injector decides which requests and commands get faults. Its faults can
+// be replaced while it is in use.
+type Injector struct {
+	faults atomic.Pointer[Faults]
+}
+
+// NewInjector creates an injector for the faults
+func NewInjector(f Faults) (*Injector, error) {
+	i := &Injector{}
+	if err := i.Set(f); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Faults returns the faults currently injected
+func (i *Injector) Faults() Faults {
+	return *i.faults.Load()
+}
+
+// Set replaces the faults injected
+func (i *Injector) Set(f Faults) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	i.faults.Store(&f)
+	return nil
+}
+
+// Delay returns the latency to add to a request, or 0 for none
+func (i *Injector) Delay() time.Duration {
+	f := i.faults.Load()
+	if f.Latency > 0 && roll(f.LatencyRate) {
+		return f.Latency
+	}
+	return 0
+}
+
+// Error returns the status a request must fail with, or 0 to let it through
+func (i *Injector) Error() int {
+	f := i.faults.Load()
+	if roll(f.ErrorRate) {
+		return f.ErrorStatus
+	}
+	return 0
+}
+
+// redisTimeout returns ErrRedisTimeout when a command must time out,
+// recording the fault on the span of ctx
+func (i *Injector) redisTimeout(ctx context.Context) error {
+	if !roll(i.faults.Load().RedisTimeoutRate) {
+		return nil
+	}
+	Record(ctx, "redis_timeout")
+	return ErrRedisTimeout
+}
+
+// Record adds an event for an injected fault to the span of ctx
+func Record(ctx context.Context, fault string, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).AddEvent("chaos fault injected", trace.WithAttributes(
+		append([]attribute.KeyValue{attribute.String("chaos.fault", fault)}, attrs...)...,
+	))
+}
+
+func roll(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+func (i *Injector) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (i *Injector) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := i.redisTimeout(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (i *Injector) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := i.redisTimeout(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
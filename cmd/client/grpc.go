@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	ordersv1 "github.com/observiq/tracing/proto/orders/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// grpcClient calls the gRPC API. The otelgrpc interceptor starts a client
+// span for each call and injects its context into the request metadata.
+type grpcClient struct {
+	conn   *grpc.ClientConn
+	client ordersv1.OrderServiceClient
+}
+
+func newGRPCClient(ctx context.Context, addr string) (*grpcClient, error) {
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	return &grpcClient{
+		conn:   conn,
+		client: ordersv1.NewOrderServiceClient(conn),
+	}, nil
+}
+
+func (c *grpcClient) Get(ctx context.Context, id string) (any, error) {
+	return c.client.GetOrder(ctx, &ordersv1.GetOrderRequest{Id: id})
+}
+
+func (c *grpcClient) List(ctx context.Context) (any, error) {
+	return c.client.ListOrders(ctx, &ordersv1.ListOrdersRequest{})
+}
+
+func (c *grpcClient) Create(ctx context.Context, customer, currency string, items []item) (any, error) {
+	req := &ordersv1.CreateOrderRequest{Customer: customer, Currency: currency}
+	for _, item := range items {
+		req.Items = append(req.Items, &ordersv1.Item{
+			Sku:      item.SKU,
+			Quantity: int32(item.Quantity),
+			Price:    item.Price,
+		})
+	}
+	return c.client.CreateOrder(ctx, req)
+}
+
+func (c *grpcClient) Close() error {
+	return c.conn.Close()
+}
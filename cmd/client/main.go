@@ -0,0 +1,171 @@
+// Command client calls the orders API over gRPC or REST. Each invocation
+// starts its own root span, so the trace shows the call leaving the client
+// and continuing in the server.
+//
+// Usage:
+//
+//	client [flags] get ID
+//	client [flags] list
+//	client [flags] create CUSTOMER CURRENCY SKU:QUANTITY:PRICE...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/observiq/tracing/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// orderClient is implemented by the gRPC and REST transports
+type orderClient interface {
+	Get(ctx context.Context, id string) (any, error)
+	List(ctx context.Context) (any, error)
+	Create(ctx context.Context, customer, currency string, items []item) (any, error)
+	Close() error
+}
+
+type item struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+func main() {
+	cfg := telemetry.DefaultConfig()
+	cfg.ServiceName = "orders-client"
+	cfg.LogsExporter = telemetry.ExporterNone
+	cfg.MetricsExporter = telemetry.ExporterNone
+	transport := flag.String("transport", "grpc", "transport used to call the API: grpc or rest")
+	grpcAddr := flag.String("grpc-addr", "localhost:9913", "address of the gRPC API")
+	restURL := flag.String("rest-url", "http://localhost:9911", "base URL of the REST API")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of the call")
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	sampler, err := telemetry.NewReloadableSampler(cfg)
+	if err != nil {
+		fatal("create sampler", err)
+	}
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, cfg, sampler)
+	if err != nil {
+		fatal("create tracer provider", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		fatal("create propagator", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+	// flush the client's spans even if the call fails
+	defer tracerProvider.Shutdown(context.Background())
+
+	var client orderClient
+	switch *transport {
+	case "grpc":
+		client, err = newGRPCClient(ctx, *grpcAddr)
+	case "rest":
+		client = newRESTClient(*restURL)
+	default:
+		err = fmt.Errorf("unknown transport %q", *transport)
+	}
+	if err != nil {
+		fatal("create client", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	res, err := run(ctx, client, *transport, flag.Args())
+	if err != nil {
+		slog.Error("call failed", "error", err)
+		tracerProvider.Shutdown(context.Background())
+		os.Exit(1)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(res)
+}
+
+// run executes the command in args within a root span
+func run(ctx context.Context, client orderClient, transport string, args []string) (any, error) {
+	command := args[0]
+	ctx, span := otel.Tracer("ordersClient").Start(ctx, "client "+command,
+		trace.WithAttributes(attribute.String("client.transport", transport)),
+	)
+	defer span.End()
+	fmt.Fprintf(os.Stderr, "trace id: %s\n", span.SpanContext().TraceID())
+
+	res, err := dispatch(ctx, client, command, args[1:])
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+func dispatch(ctx context.Context, client orderClient, command string, args []string) (any, error) {
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return nil, errors.New("usage: get ID")
+		}
+		return client.Get(ctx, args[0])
+	case "list":
+		return client.List(ctx)
+	case "create":
+		if len(args) < 3 {
+			return nil, errors.New("usage: create CUSTOMER CURRENCY SKU:QUANTITY:PRICE...")
+		}
+		items, err := parseItems(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		return client.Create(ctx, args[0], args[1], items)
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parseItems parses items given as SKU:QUANTITY:PRICE
+func parseItems(args []string) ([]item, error) {
+	items := make([]item, 0, len(args))
+	for _, arg := range args {
+		parts := strings.Split(arg, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("item %q is not SKU:QUANTITY:PRICE", arg)
+		}
+		quantity, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("item %q: invalid quantity: %w", arg, err)
+		}
+		price, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("item %q: invalid price: %w", arg, err)
+		}
+		items = append(items, item{SKU: parts[0], Quantity: quantity, Price: price})
+	}
+	return items, nil
+}
+
+// fatal logs err with the default logger and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
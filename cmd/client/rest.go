@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/observiq/tracing/httpclient"
+)
+
+// restClient calls the REST API through the otelhttp instrumented client
+type restClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newRESTClient(baseURL string) *restClient {
+	return &restClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpclient.New(0),
+	}
+}
+
+func (c *restClient) Get(ctx context.Context, id string) (any, error) {
+	return c.do(ctx, http.MethodGet, "/v1/orders/"+id, nil)
+}
+
+func (c *restClient) List(ctx context.Context) (any, error) {
+	return c.do(ctx, http.MethodGet, "/v1/orders", nil)
+}
+
+func (c *restClient) Create(ctx context.Context, customer, currency string, items []item) (any, error) {
+	return c.do(ctx, http.MethodPost, "/v1/orders", map[string]any{
+		"customer": customer,
+		"currency": currency,
+		"items":    items,
+	})
+}
+
+func (c *restClient) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// do sends body as JSON and decodes the JSON response. Error responses are
+// returned as errors including the problem details.
+func (c *restClient) do(ctx context.Context, method, path string, body any) (any, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var res any
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return res, nil
+}
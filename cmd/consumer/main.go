@@ -0,0 +1,91 @@
+// Command consumer consumes the order events the API publishes to kafka. The
+// span handling each event is a child of the span that published it, so the
+// trace of the request continues across the broker.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+func main() {
+	cfg := telemetry.DefaultConfig()
+	cfg.ServiceName = "consumer"
+	brokers := flag.String("kafka-brokers", envOrDefault("KAFKA_BROKERS", "localhost:9092"), "comma separated kafka broker addresses")
+	topic := flag.String("kafka-topic", envOrDefault("KAFKA_TOPIC", "orders"), "kafka topic order events are published to")
+	group := flag.String("kafka-group", envOrDefault("KAFKA_GROUP", "consumer"), "consumer group the events are read with")
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	loggerProvider, err := telemetry.NewLoggerProvider(ctx, cfg)
+	if err != nil {
+		fatal("create logger", err)
+	}
+	slog.SetDefault(loggerProvider.Logger())
+	defer loggerProvider.Shutdown(context.Background())
+
+	sampler, err := telemetry.NewReloadableSampler(cfg)
+	if err != nil {
+		fatal("create sampler", err)
+	}
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, cfg, sampler)
+	if err != nil {
+		fatal("create tracer provider", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		fatal("create propagator", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	var addrs []string
+	for _, addr := range strings.Split(*brokers, ",") {
+		addrs = append(addrs, strings.TrimSpace(addr))
+	}
+	slog.Info("consuming order events", "topic", *topic, "group", *group)
+	if err := events.Consume(ctx, addrs, *topic, *group, handle); err != nil {
+		slog.Error("consume events", "error", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Error("flush spans", "error", err)
+	}
+}
+
+// handle logs the event in the span continuing the trace of the request
+// that changed the order
+func handle(ctx context.Context, e events.Event) error {
+	slog.InfoContext(ctx, "order event", "type", e.Type, "order_id", e.OrderID, "status", e.Status)
+	return nil
+}
+
+// fatal logs err with the default logger and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
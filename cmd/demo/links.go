@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// exampleTrace is a trace found in Jaeger, described by its root span
+type exampleTrace struct {
+	ID       string
+	Name     string
+	Duration time.Duration
+	Spans    int
+	Services int
+	Error    bool
+}
+
+// exampleTraces searches Jaeger for recent traces of service and returns up
+// to limit of them, the ones crossing the most services and spans first, as
+// they show the most of the example
+func exampleTraces(ctx context.Context, jaegerURL, service string, limit int) ([]exampleTrace, error) {
+	query := url.Values{
+		"service":  {service},
+		"lookback": {"1h"},
+		"limit":    {"100"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jaegerURL+"/api/traces?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search traces: status %d", res.StatusCode)
+	}
+
+	// the shape of the JSON served by the Jaeger UI's query API
+	var body struct {
+		Data []struct {
+			TraceID string `json:"traceID"`
+			Spans   []struct {
+				OperationName string `json:"operationName"`
+				References    []any  `json:"references"`
+				Duration      int64  `json:"duration"`
+				ProcessID     string `json:"processID"`
+				Tags          []struct {
+					Key   string `json:"key"`
+					Value any    `json:"value"`
+				} `json:"tags"`
+			} `json:"spans"`
+			Processes map[string]any `json:"processes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode traces: %w", err)
+	}
+
+	var traces []exampleTrace
+	for _, t := range body.Data {
+		example := exampleTrace{ID: t.TraceID, Spans: len(t.Spans), Services: len(t.Processes)}
+		for _, span := range t.Spans {
+			if len(span.References) == 0 {
+				example.Name = span.OperationName
+				example.Duration = time.Duration(span.Duration) * time.Microsecond
+			}
+			for _, tag := range span.Tags {
+				if tag.Key == "error" && tag.Value == true {
+					example.Error = true
+				}
+			}
+		}
+		traces = append(traces, example)
+	}
+	sort.SliceStable(traces, func(i, j int) bool {
+		if traces[i].Services != traces[j].Services {
+			return traces[i].Services > traces[j].Services
+		}
+		return traces[i].Spans > traces[j].Spans
+	})
+	if len(traces) > limit {
+		traces = traces[:limit]
+	}
+	return traces, nil
+}
+
+// printLinks prints a link to each example trace, and to the search of
+// every trace of the API
+func printLinks(w io.Writer, traces []exampleTrace) {
+	fmt.Fprintln(w, "\nExample traces:")
+	if len(traces) == 0 {
+		fmt.Fprintln(w, "  none found yet, search again in a few seconds")
+	}
+	for _, t := range traces {
+		status := ""
+		if t.Error {
+			status = ", failed"
+		}
+		fmt.Fprintf(w, "  %s (%s, %d spans across %d services%s)\n    %s/trace/%s\n",
+			t.Name, t.Duration.Round(time.Millisecond), t.Spans, t.Services, status, jaegerURL, t.ID)
+	}
+	fmt.Fprintf(w, "\nEvery trace of the API:\n  %s/search?service=%s\n", jaegerURL, serviceAPI)
+}
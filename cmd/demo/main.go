@@ -0,0 +1,91 @@
+// Command demo runs the whole example on one machine: redis, a collector,
+// and Jaeger in containers, and the orders API and worker built from this
+// module. It seeds the store, sends a short burst of load, and prints links
+// to example traces in Jaeger, then keeps the stack running until
+// interrupted.
+//
+// Usage, from the module:
+//
+//	go run ./cmd/demo [flags]
+//
+// The containers are driven with the docker CLI, which must be installed
+// and able to reach a daemon.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		orders   = flag.Int("orders", 50, "number of fake orders seeded")
+		duration = flag.Duration("duration", 30*time.Second, "how long load is generated for")
+		rps      = flag.Float64("rps", 10, "requests per second of the load")
+		traces   = flag.Int("traces", 5, "number of example traces linked")
+		keep     = flag.Bool("keep", true, "keep the stack running until interrupted, rather than stopping it once the links are printed")
+		dir      = flag.String("dir", "", "directory the binary, collector config, and process logs are written to, a temporary one when empty")
+	)
+	flag.Parse()
+	if *orders <= 0 || *traces <= 0 || *duration <= 0 || *rps <= 0 {
+		fatal("invalid flags", errors.New("orders, traces, duration, and rps must be positive"))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	if *dir == "" {
+		tmp, err := os.MkdirTemp("", "orders-demo-")
+		if err != nil {
+			fatal("create work directory", err)
+		}
+		*dir = tmp
+	}
+	s := &stack{dir: *dir}
+	if err := s.start(ctx); err != nil {
+		s.stop()
+		fatal("start stack", err)
+	}
+	defer s.stop()
+	slog.Info("stack started", "logs", s.dir)
+
+	if err := s.run(ctx, "seed", serviceSeed, os.Stdout, "seed", "-count", fmt.Sprint(*orders)); err != nil {
+		slog.Error("seed store", "error", err)
+		return
+	}
+	slog.Info("generating load", "duration", *duration, "rps", *rps)
+	if err := s.run(ctx, "loadgen", serviceLoadgen, os.Stdout, "loadgen", "-duration", duration.String(), "-rps", fmt.Sprint(*rps), "-url", apiURL); err != nil {
+		slog.Error("generate load", "error", err)
+		return
+	}
+
+	// the collector batches spans, and Jaeger indexes them, before they can
+	// be searched
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(10 * time.Second):
+	}
+	examples, err := exampleTraces(ctx, jaegerURL, serviceLoadgen, *traces)
+	if err != nil {
+		slog.Error("find example traces", "error", err)
+	}
+	printLinks(os.Stdout, examples)
+
+	if *keep {
+		fmt.Println("\nThe stack keeps running, press Ctrl-C to stop it.")
+		<-ctx.Done()
+	}
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
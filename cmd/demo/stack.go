@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	redisImage     = "redis:7"
+	collectorImage = "otel/opentelemetry-collector-contrib:0.75.0"
+	jaegerImage    = "jaegertracing/all-in-one:1.44"
+
+	// network is the docker network the containers reach each other on
+	network = "orders-demo"
+
+	apiURL    = "http://localhost:9911"
+	jaegerURL = "http://localhost:16686"
+)
+
+// Service names the processes report their telemetry under
+const (
+	serviceAPI     = "orders"
+	serviceWorker  = "orders-worker"
+	serviceLoadgen = "orders-loadgen"
+	serviceSeed    = "orders-seed"
+)
+
+// collectorConfig forwards spans to Jaeger over OTLP, and prints a summary
+// of the metrics and logs, which Jaeger does not store
+const collectorConfig = `
+receivers:
+  otlp:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:4317
+      http:
+        endpoint: 0.0.0.0:4318
+processors:
+  batch:
+exporters:
+  otlp/jaeger:
+    endpoint: jaeger:4317
+    tls:
+      insecure: true
+  logging:
+service:
+  pipelines:
+    traces:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [otlp/jaeger]
+    metrics:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [logging]
+    logs:
+      receivers: [otlp]
+      processors: [batch]
+      exporters: [logging]
+`
+
+// stack is the running demo: its containers, and the processes of the
+// orders binary built into dir, whose logs are written next to it
+type stack struct {
+	dir        string
+	binary     string
+	network    bool
+	containers []string
+	processes  []*exec.Cmd
+}
+
+// start builds the orders binary, then starts the containers and the API
+// and worker, returning once the API is ready
+func (s *stack) start(ctx context.Context) error {
+	s.binary = filepath.Join(s.dir, "orders")
+	slog.Info("building orders", "binary", s.binary)
+	build := exec.CommandContext(ctx, "go", "build", "-o", s.binary, "github.com/observiq/tracing")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("build orders: %w", err)
+	}
+
+	// containers left behind by a demo that was killed hold the names
+	for _, name := range []string{"redis", "collector", "jaeger"} {
+		docker(context.Background(), "rm", "-f", network+"-"+name)
+	}
+	docker(context.Background(), "network", "rm", network)
+	if _, err := docker(ctx, "network", "create", network); err != nil {
+		return err
+	}
+	s.network = true
+
+	config := filepath.Join(s.dir, "collector.yaml")
+	if err := os.WriteFile(config, []byte(collectorConfig), 0o644); err != nil {
+		return err
+	}
+	containers := []struct {
+		name  string
+		image string
+		ports []string
+		opts  []string
+		args  []string
+	}{
+		{name: "redis", image: redisImage, ports: []string{"6379"}},
+		{name: "jaeger", image: jaegerImage, ports: []string{"16686"}, opts: []string{"-e", "COLLECTOR_OTLP_ENABLED=true"}},
+		{name: "collector", image: collectorImage, ports: []string{"4317", "4318"},
+			opts: []string{"-v", config + ":/etc/otelcol-contrib/config.yaml:ro"}},
+	}
+	for _, c := range containers {
+		slog.Info("starting container", "name", c.name, "image", c.image)
+		if err := s.startContainer(ctx, c.name, c.image, c.ports, c.opts, c.args...); err != nil {
+			return err
+		}
+	}
+
+	if err := s.startProcess("api", serviceAPI, "serve"); err != nil {
+		return err
+	}
+	if err := s.startProcess("worker", serviceWorker, "worker", "-api-url", apiURL); err != nil {
+		return err
+	}
+	return waitReady(ctx, apiURL+"/readyz")
+}
+
+// stop stops the processes, then removes the containers and their network
+func (s *stack) stop() {
+	for i := len(s.processes) - 1; i >= 0; i-- {
+		p := s.processes[i]
+		p.Process.Signal(syscall.SIGTERM)
+		done := make(chan struct{})
+		go func() {
+			p.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			p.Process.Kill()
+		}
+	}
+	s.processes = nil
+	for _, id := range s.containers {
+		if _, err := docker(context.Background(), "rm", "-f", id); err != nil {
+			slog.Error("remove container", "id", id, "error", err)
+		}
+	}
+	s.containers = nil
+	if s.network {
+		if _, err := docker(context.Background(), "network", "rm", network); err != nil {
+			slog.Error("remove network", "error", err)
+		}
+		s.network = false
+	}
+}
+
+// startContainer runs image detached as name on the network of the stack,
+// with the docker run options opts and the command arguments args. Each of
+// ports is published on the same local port, and is waited on until it
+// accepts connections.
+func (s *stack) startContainer(ctx context.Context, name, image string, ports, opts []string, args ...string) error {
+	run := []string{"run", "-d", "--name", network + "-" + name, "--network", network, "--network-alias", name}
+	for _, port := range ports {
+		run = append(run, "-p", "127.0.0.1:"+port+":"+port)
+	}
+	run = append(run, opts...)
+	run = append(run, image)
+	run = append(run, args...)
+	id, err := docker(ctx, run...)
+	if err != nil {
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+	s.containers = append(s.containers, id)
+	for _, port := range ports {
+		if err := waitForPort(ctx, "127.0.0.1:"+port); err != nil {
+			return fmt.Errorf("start %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// env is the environment of the processes of the orders binary, pointing
+// them at the containers. The API publishes order events to redis for the
+// worker to consume.
+func env(service string) []string {
+	return append(os.Environ(),
+		"OTEL_SERVICE_NAME="+service,
+		"OTEL_EXPORTER_OTLP_ENDPOINT=localhost:4317",
+		"REDIS_ADDR=localhost:6379",
+		"EVENTS_PUBLISHER=redis",
+	)
+}
+
+// startProcess starts the orders binary with args in the background,
+// logging to name.log in the directory of the stack
+func (s *stack) startProcess(name, service string, args ...string) error {
+	log, err := os.Create(filepath.Join(s.dir, name+".log"))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(s.binary, args...)
+	cmd.Env = env(service)
+	cmd.Stdout, cmd.Stderr = log, log
+	slog.Info("starting process", "name", name, "log", log.Name())
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+	// the child holds its own descriptor
+	log.Close()
+	s.processes = append(s.processes, cmd)
+	return nil
+}
+
+// run runs the orders binary with args to completion as service, logging to
+// name.log in the directory of the stack and writing its output to stdout
+func (s *stack) run(ctx context.Context, name, service string, stdout io.Writer, args ...string) error {
+	log, err := os.Create(filepath.Join(s.dir, name+".log"))
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	cmd := exec.CommandContext(ctx, s.binary, args...)
+	cmd.Env = env(service)
+	cmd.Stdout, cmd.Stderr = stdout, log
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w, see %s", name, err, log.Name())
+	}
+	return nil
+}
+
+// docker runs the docker CLI with args and returns its output
+func docker(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// waitForPort waits until addr accepts connections
+func waitForPort(ctx context.Context, addr string) error {
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s never accepted connections: %w", addr, err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// waitReady waits for url to answer 200, for at most a minute
+func waitReady(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s never became ready", url)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Command inventory runs the inventory service that the orders API checks
+// stock against, so the two together produce traces spanning two services.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+func main() {
+	cfg := telemetry.DefaultConfig()
+	cfg.ServiceName = "inventory"
+	addr := flag.String("addr", envOrDefault("INVENTORY_ADDR", ":9912"), "address the HTTP server listens on")
+	redisAddr := flag.String("redis-addr", envOrDefault("REDIS_ADDR", "localhost:6379"), "redis address")
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	loggerProvider, err := telemetry.NewLoggerProvider(ctx, cfg)
+	if err != nil {
+		fatal("create logger", err)
+	}
+	slog.SetDefault(loggerProvider.Logger())
+	defer loggerProvider.Shutdown(context.Background())
+
+	sampler, err := telemetry.NewReloadableSampler(cfg)
+	if err != nil {
+		fatal("create sampler", err)
+	}
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, cfg, sampler)
+	if err != nil {
+		fatal("create tracer provider", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		fatal("create propagator", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	store, err := inventory.NewStore(ctx, *redisAddr)
+	if err != nil {
+		fatal("connect to redis", err)
+	}
+
+	s := &http.Server{
+		Addr:              *addr,
+		Handler:           inventory.NewHandler(store, tracerProvider),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		slog.Info("serving inventory", "addr", *addr)
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("serve http", err)
+		}
+	}()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		slog.Error("drain http server", "error", err)
+	}
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Error("flush spans", "error", err)
+	}
+	if err := store.Close(); err != nil {
+		slog.Error("close redis", "error", err)
+	}
+}
+
+// fatal logs err with the default logger and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
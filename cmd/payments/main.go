@@ -0,0 +1,117 @@
+// Command payments runs a stub of the payment service that the orders API
+// charges orders with. Its latency and failure rates are configurable so
+// demos show slow and failing hops in traces.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+func main() {
+	cfg := telemetry.DefaultConfig()
+	cfg.ServiceName = "payments"
+	var opts payments.Options
+	addr := flag.String("addr", envOrDefault("PAYMENTS_ADDR", ":9914"), "address the HTTP server listens on")
+	flag.DurationVar(&opts.Latency, "latency", envDurationOrDefault("PAYMENTS_LATENCY", 100*time.Millisecond), "least time a charge takes")
+	flag.DurationVar(&opts.Jitter, "jitter", envDurationOrDefault("PAYMENTS_JITTER", 200*time.Millisecond), "most time added at random to the latency of a charge")
+	flag.Float64Var(&opts.FailureRate, "failure-rate", envFloatOrDefault("PAYMENTS_FAILURE_RATE", 0.05), "fraction of charges that fail with a 503")
+	flag.Float64Var(&opts.DeclineRate, "decline-rate", envFloatOrDefault("PAYMENTS_DECLINE_RATE", 0.05), "fraction of charges that are declined with a 402")
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
+	if opts.Latency < 0 || opts.Jitter < 0 {
+		fatal("invalid config", errors.New("latency and jitter must not be negative"))
+	}
+	if opts.FailureRate < 0 || opts.DeclineRate < 0 || opts.FailureRate+opts.DeclineRate > 1 {
+		fatal("invalid config", errors.New("failure and decline rates must be between 0 and 1 together"))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	loggerProvider, err := telemetry.NewLoggerProvider(ctx, cfg)
+	if err != nil {
+		fatal("create logger", err)
+	}
+	slog.SetDefault(loggerProvider.Logger())
+	defer loggerProvider.Shutdown(context.Background())
+
+	sampler, err := telemetry.NewReloadableSampler(cfg)
+	if err != nil {
+		fatal("create sampler", err)
+	}
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, cfg, sampler)
+	if err != nil {
+		fatal("create tracer provider", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		fatal("create propagator", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	s := &http.Server{
+		Addr:              *addr,
+		Handler:           payments.NewHandler(opts, tracerProvider),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		slog.Info("serving payments", "addr", *addr, "latency", opts.Latency, "failure_rate", opts.FailureRate, "decline_rate", opts.DeclineRate)
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("serve http", err)
+		}
+	}()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		slog.Error("drain http server", "error", err)
+	}
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Error("flush spans", "error", err)
+	}
+}
+
+// fatal logs err with the default logger and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
+}
+
+func envFloatOrDefault(key string, def float64) float64 {
+	if f, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return f
+	}
+	return def
+}
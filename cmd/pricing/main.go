@@ -0,0 +1,95 @@
+// Command pricing runs the pricing service that the orders API asks for
+// quotes over NATS request/reply, so traces also cross a NATS hop.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats.go"
+	"github.com/observiq/tracing/pricing"
+	"github.com/observiq/tracing/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// catalog is the price list served by the example
+var catalog = pricing.Catalog{
+	"ABC-1234":  9.99,
+	"ABC-5678":  24.5,
+	"WIDGET-01": 3.25,
+	"GADGET-42": 129,
+}
+
+func main() {
+	cfg := telemetry.DefaultConfig()
+	cfg.ServiceName = "pricing"
+	natsURL := flag.String("nats-url", envOrDefault("NATS_URL", nats.DefaultURL), "URL of the NATS server")
+	subject := flag.String("subject", envOrDefault("PRICING_SUBJECT", pricing.DefaultSubject), "NATS subject quotes are requested on")
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	loggerProvider, err := telemetry.NewLoggerProvider(ctx, cfg)
+	if err != nil {
+		fatal("create logger", err)
+	}
+	slog.SetDefault(loggerProvider.Logger())
+	defer loggerProvider.Shutdown(context.Background())
+
+	sampler, err := telemetry.NewReloadableSampler(cfg)
+	if err != nil {
+		fatal("create sampler", err)
+	}
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, cfg, sampler)
+	if err != nil {
+		fatal("create tracer provider", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		fatal("create propagator", err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	nc, err := nats.Connect(*natsURL, nats.Name(cfg.ServiceName))
+	if err != nil {
+		fatal("connect to nats", err)
+	}
+	if _, err := pricing.Serve(nc, *subject, catalog); err != nil {
+		fatal("serve quotes", err)
+	}
+	slog.Info("serving quotes", "subject", *subject)
+	<-ctx.Done()
+
+	// drain answers the requests already received before closing
+	if err := nc.Drain(); err != nil {
+		slog.Error("drain nats", "error", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Error("flush spans", "error", err)
+	}
+}
+
+// fatal logs err with the default logger and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"sync/atomic"
+)
+
+// Holder holds the current config so it can be replaced while the process
+// runs. It is safe for concurrent use.
+type Holder struct {
+	args    []string
+	current atomic.Pointer[Config]
+}
+
+// NewHolder creates a holder for cfg, which was loaded from args
+func NewHolder(cfg Config, args []string) *Holder {
+	h := &Holder{args: args}
+	h.current.Store(&cfg)
+	return h
+}
+
+// Current returns the current config. It must not be modified.
+func (h *Holder) Current() *Config {
+	return h.current.Load()
+}
+
+// Reload loads the config again from the same arguments, re-reading the
+// config file. The new config is passed to apply and only becomes current if
+// it is valid and apply succeeds.
+func (h *Holder) Reload(apply func(cfg *Config) error) (*Config, error) {
+	cfg, err := Load(h.args)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(&cfg); err != nil {
+		return nil, err
+	}
+	h.current.Store(&cfg)
+	return &cfg, nil
+}
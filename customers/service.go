@@ -0,0 +1,89 @@
+// Package customers manages the customers orders are placed by
+package customers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/store"
+)
+
+// Request is the customer accepted when creating or updating a customer
+type Request struct {
+	Name  string `json:"name" binding:"required"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Service implements the operations on customers shared by the APIs
+type Service struct {
+	store store.CustomerStore
+}
+
+// NewService creates a service keeping customers in store
+func NewService(store store.CustomerStore) *Service {
+	return &Service{store: store}
+}
+
+// Get returns the customer with the given ID
+func (s *Service) Get(ctx context.Context, id string) (*db.Customer, error) {
+	return s.store.GetCustomer(ctx, id)
+}
+
+// GetMany returns the customers with the given IDs by ID, leaving out those
+// that do not exist, in one round trip when the store allows it
+func (s *Service) GetMany(ctx context.Context, ids []string) (map[string]*db.Customer, error) {
+	return store.GetCustomers(ctx, s.store, ids)
+}
+
+// List returns a page of customers starting at cursor and the cursor of the
+// next page, which is 0 once every customer has been listed
+func (s *Service) List(ctx context.Context, cursor uint64, limit int64) ([]*db.Customer, uint64, error) {
+	return s.store.ListCustomers(ctx, cursor, limit)
+}
+
+// Create stores a new customer
+func (s *Service) Create(ctx context.Context, req Request) (*db.Customer, error) {
+	id, err := newCustomerID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	c := &db.Customer{
+		ID:        id,
+		Name:      req.Name,
+		Email:     req.Email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.CreateCustomer(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the name and email of a customer
+func (s *Service) Update(ctx context.Context, id string, req Request) (*db.Customer, error) {
+	return s.store.UpdateCustomer(ctx, id, func(c *db.Customer) error {
+		c.Name = req.Name
+		c.Email = req.Email
+		return nil
+	})
+}
+
+// Delete removes the customer with the given ID. Its orders are kept.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.store.DeleteCustomer(ctx, id)
+}
+
+// newCustomerID returns a random 128 bit hex encoded customer ID
+func newCustomerID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate customer id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
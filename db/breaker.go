@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnavailable is returned without contacting redis while the circuit
+// breaker is open
+var ErrUnavailable = errors.New("redis unavailable")
+
+type breakerState int
+
+// Breaker states, in the order reported by the state gauge
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// breaker is a go-redis hook that stops sending commands to redis after
+// threshold consecutive failures. Once cooldown has passed a single probe
+// command is let through; the breaker closes if it succeeds and opens again
+// if it fails. Transitions are recorded as events on the span of the command
+// that caused them.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) (*breaker, error) {
+	b := &breaker{threshold: threshold, cooldown: cooldown}
+
+	meter := global.Meter("redis")
+	state, err := meter.Int64ObservableGauge("db.client.breaker.state",
+		instrument.WithDescription("State of the redis circuit breaker: 0 closed, 1 half-open, 2 open"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create breaker state gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		o.ObserveInt64(state, int64(b.state))
+		return nil
+	}, state)
+	if err != nil {
+		return nil, fmt.Errorf("register breaker state callback: %w", err)
+	}
+	return b, nil
+}
+
+func (b *breaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *breaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		probe, err := b.allow(ctx)
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err = next(ctx, cmd)
+		b.record(ctx, probe, err)
+		return err
+	}
+}
+
+func (b *breaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		probe, err := b.allow(ctx)
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err = next(ctx, cmds)
+		b.record(ctx, probe, err)
+		return err
+	}
+}
+
+// allow returns ErrUnavailable if the command must not be sent, and
+// otherwise whether it is the probe of a half-open breaker
+func (b *breaker) allow(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, ErrUnavailable
+		}
+		b.transition(ctx, breakerHalfOpen)
+		b.probing = true
+		return true, nil
+	case breakerHalfOpen:
+		if b.probing {
+			return false, ErrUnavailable
+		}
+		b.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// record updates the breaker with the outcome of a command. Once the
+// breaker has opened, only the outcome of its probe counts: commands sent
+// before it opened may still be completing, and must neither end the probe
+// nor close the breaker.
+func (b *breaker) record(ctx context.Context, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	} else if b.state != breakerClosed {
+		return
+	}
+	if !isConnectionFailure(err) {
+		b.failures = 0
+		if b.state == breakerHalfOpen {
+			b.transition(ctx, breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.transition(ctx, breakerOpen)
+	}
+}
+
+func (b *breaker) transition(ctx context.Context, to breakerState) {
+	if b.state == to {
+		return
+	}
+	trace.SpanFromContext(ctx).AddEvent("circuit breaker state change", trace.WithAttributes(
+		attribute.String("breaker.from", b.state.String()),
+		attribute.String("breaker.to", to.String()),
+		attribute.Int("breaker.failures", b.failures),
+	))
+	b.state = to
+}
+
+// isConnectionFailure reports whether err means redis could not be reached,
+// as opposed to redis answering with an error or a missing key
+func isConnectionFailure(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, redis.ErrClosed)
+}
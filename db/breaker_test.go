@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBreakerProbe(t *testing.T) {
+	ctx := context.Background()
+	b, err := newBreaker(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a command sent while closed, still in flight when the breaker opens
+	slow, err := b.allow(ctx)
+	if err != nil || slow {
+		t.Fatalf("allow = %v, %v while closed, want a command that is not a probe", slow, err)
+	}
+	if _, err := b.allow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.record(ctx, false, redis.ErrClosed)
+	if b.state != breakerOpen {
+		t.Fatalf("state %s after a failure, want open", b.state)
+	}
+
+	probe, err := b.allow(ctx)
+	if err != nil || !probe {
+		t.Fatalf("allow = %v, %v after the cooldown, want the probe", probe, err)
+	}
+	// the slow command completing neither ends the probe nor closes the
+	// breaker
+	b.record(ctx, slow, nil)
+	if b.state != breakerHalfOpen {
+		t.Errorf("state %s after a command sent before opening, want half-open", b.state)
+	}
+	if _, err := b.allow(ctx); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("allow = %v during the probe, want ErrUnavailable", err)
+	}
+
+	b.record(ctx, probe, nil)
+	if b.state != breakerClosed {
+		t.Errorf("state %s after the probe succeeded, want closed", b.state)
+	}
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrCustomerNotFound is returned when a customer does not exist
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrCustomerExists is returned when creating a customer whose ID is
+	// taken
+	ErrCustomerExists = errors.New("customer already exists")
+)
+
+// Customer places orders, which reference it by ID in their customer field
+type Customer struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// customerKeyPrefix namespaces customer keys apart from order keys
+const customerKeyPrefix = "customer:"
+
+func customerKey(id string) string {
+	return customerKeyPrefix + id
+}
+
+// GetCustomer returns the customer with the given ID
+func (c *Client) GetCustomer(ctx context.Context, id string) (*Customer, error) {
+	data, err := c.redisClient.Get(ctx, customerKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCustomer(data)
+}
+
+// GetCustomers returns the customers with the given IDs by ID, leaving out
+// those that do not exist. The keys are read in a pipeline rather than with
+// MGET, so they need not share a cluster slot.
+func (c *Client) GetCustomers(ctx context.Context, ids []string) (map[string]*Customer, error) {
+	customers := make(map[string]*Customer, len(ids))
+	if len(ids) == 0 {
+		return customers, nil
+	}
+	cmds := make([]*redis.StringCmd, len(ids))
+	pipe := c.redisClient.Pipeline()
+	for i, id := range ids {
+		cmds[i] = pipe.Get(ctx, customerKey(id))
+	}
+	// missing customers fail their command, which is checked below
+	_, _ = pipe.Exec(ctx)
+
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cu, err := decodeCustomer(data)
+		if err != nil {
+			return nil, err
+		}
+		customers[ids[i]] = cu
+	}
+	return customers, nil
+}
+
+// CreateCustomer stores a new customer, returning ErrCustomerExists if the
+// ID is taken
+func (c *Client) CreateCustomer(ctx context.Context, cu *Customer) error {
+	data, err := json.Marshal(cu)
+	if err != nil {
+		return fmt.Errorf("encode customer: %w", err)
+	}
+	ok, err := c.redisClient.SetNX(ctx, customerKey(cu.ID), data, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCustomerExists
+	}
+	return nil
+}
+
+// UpdateCustomer applies fn to the stored customer and writes the result
+// back, retrying like UpdateOrder if the customer changes meanwhile
+func (c *Client) UpdateCustomer(ctx context.Context, id string, fn func(*Customer) error) (*Customer, error) {
+	ctx, span := span.DB(ctx, c.tracer, "update customer", trace.WithAttributes(attribute.String("customer.id", id)))
+	defer span.End()
+
+	key := customerKey(id)
+	var customer *Customer
+	err := c.Tx(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrCustomerNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if customer, err = decodeCustomer(data); err != nil {
+			return err
+		}
+		if err := fn(customer); err != nil {
+			return err
+		}
+		customer.UpdatedAt = time.Now().UTC()
+		if data, err = json.Marshal(customer); err != nil {
+			return fmt.Errorf("encode customer: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// DeleteCustomer removes the customer with the given ID. Its orders are
+// kept.
+func (c *Client) DeleteCustomer(ctx context.Context, id string) error {
+	n, err := c.redisClient.Del(ctx, customerKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCustomerNotFound
+	}
+	return nil
+}
+
+// ListCustomers returns a page of customers like List returns orders
+func (c *Client) ListCustomers(ctx context.Context, cursor uint64, limit int64) ([]*Customer, uint64, error) {
+	ctx, span := span.DB(ctx, c.tracer, "list customers", trace.WithAttributes(
+		attribute.Int64("cursor", int64(cursor)),
+		attribute.Int64("limit", limit),
+	))
+	defer span.End()
+
+	keys, next, err := c.redisClient.Scan(ctx, cursor, customerKeyPrefix+"*", limit).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+	values, err := c.mget(ctx, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	customers := make([]*Customer, 0, len(values))
+	for _, v := range values {
+		// keys deleted since they were listed come back as nil
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		customer, err := decodeCustomer([]byte(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		customers = append(customers, customer)
+	}
+	return customers, next, nil
+}
+
+func decodeCustomer(data []byte) (*Customer, error) {
+	var cu Customer
+	if err := json.Unmarshal(data, &cu); err != nil {
+		return nil, fmt.Errorf("decode customer: %w", err)
+	}
+	return &cu, nil
+}
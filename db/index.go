@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// indexKeyPrefix namespaces the secondary index sets, which hold the IDs of
+// the orders with a customer, status, or creation day. The hash tag keeps
+// every set in one cluster slot so they can be intersected.
+const indexKeyPrefix = "{order-index}:"
+
+func customerIndexKey(customer string) string {
+	return indexKeyPrefix + "customer:" + customer
+}
+
+func statusIndexKey(status Status) string {
+	return indexKeyPrefix + "status:" + string(status)
+}
+
+func createdIndexKey(day string) string {
+	return indexKeyPrefix + "created:" + day
+}
+
+// indexKeys returns the keys of the index sets the order belongs in
+func indexKeys(o *Order) []string {
+	return []string{
+		customerIndexKey(o.Customer),
+		statusIndexKey(o.Status),
+		createdIndexKey(createdOn(o)),
+	}
+}
+
+// index adds the orders to the index sets they belong in, and refreshes
+// their full text search documents when search is enabled, in one pipeline.
+// A failure is recorded on the span rather than failing the write, which
+// has already been stored.
+// Sets the orders were in before are not cleaned up here; Search removes
+// the entries it finds to be stale.
+//
+// The indexes are written after the orders rather than with them, since a
+// cluster cannot change keys of several slots atomically. They may briefly
+// lag behind, so Search checks every order it reads against the query.
+func (c *Client) index(ctx context.Context, orders ...*Order) {
+	c.reindex(ctx, nil, orders...)
+}
+
+// reindex moves each order from the index sets of its previous version in
+// old, which may be nil, to those it belongs in now
+func (c *Client) reindex(ctx context.Context, old []*Order, orders ...*Order) {
+	ctx, span := span.DB(ctx, c.tracer, "index", trace.WithAttributes(attribute.Int("batch.size", len(orders))))
+	defer span.End()
+
+	_, err := c.redisClient.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, o := range orders {
+			keys := indexKeys(o)
+			if i < len(old) {
+				for _, key := range indexKeys(old[i]) {
+					if !slices.Contains(keys, key) {
+						p.SRem(ctx, key, o.ID)
+					}
+				}
+			}
+			for _, key := range keys {
+				p.SAdd(ctx, key, o.ID)
+			}
+			if c.searchIndex != "" {
+				p.HSet(ctx, searchDocKey(o.ID), searchDoc(o)...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Search returns a page of the orders selected by a non-empty query,
+// intersecting the index sets of its fields. Matches are ordered by ID, and
+// cursor is the offset of the page; the next cursor is 0 once every match
+// has been returned. Index entries of orders that were deleted or no longer
+// match are removed as they are found. Orders stored before they were
+// indexed are not found until they are next written.
+func (c *Client) Search(ctx context.Context, q Query, cursor uint64, limit int64) ([]*Order, uint64, error) {
+	ctx, span := span.DB(ctx, c.tracer, "search", trace.WithAttributes(
+		attribute.String("query.customer", q.Customer),
+		attribute.String("query.status", string(q.Status)),
+		attribute.String("query.created_on", q.CreatedOn),
+		attribute.Int64("cursor", int64(cursor)),
+		attribute.Int64("limit", limit),
+	))
+	defer span.End()
+
+	var keys []string
+	if q.Customer != "" {
+		keys = append(keys, customerIndexKey(q.Customer))
+	}
+	if q.Status != "" {
+		keys = append(keys, statusIndexKey(q.Status))
+	}
+	if q.CreatedOn != "" {
+		keys = append(keys, createdIndexKey(q.CreatedOn))
+	}
+	if len(keys) == 0 {
+		return nil, 0, errors.New("search needs at least one field")
+	}
+
+	ids, err := c.redisClient.SInter(ctx, keys...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	slices.Sort(ids)
+	span.SetAttributes(attribute.Int("search.matches", len(ids)))
+	if cursor >= uint64(len(ids)) {
+		return nil, 0, nil
+	}
+	end := cursor + uint64(limit)
+	next := end
+	if end >= uint64(len(ids)) {
+		end, next = uint64(len(ids)), 0
+	}
+	page := ids[cursor:end]
+
+	orderKeys := make([]string, len(page))
+	for i, id := range page {
+		orderKeys[i] = orderKey(id)
+	}
+	values, err := c.mget(ctx, orderKeys)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orders := make([]*Order, 0, len(values))
+	// stale maps index keys to the IDs found in them that do not belong
+	stale := map[string][]interface{}{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// the order was deleted
+			for _, key := range keys {
+				stale[key] = append(stale[key], page[i])
+			}
+			continue
+		}
+		order, err := decodeOrder([]byte(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		if q.Matches(order) {
+			orders = append(orders, order)
+			continue
+		}
+		current := indexKeys(order)
+		for _, key := range keys {
+			if !slices.Contains(current, key) {
+				stale[key] = append(stale[key], page[i])
+			}
+		}
+	}
+	if len(stale) > 0 {
+		c.unindex(ctx, stale)
+	}
+	return orders, next, nil
+}
+
+// unindex removes stale IDs from index sets. Failures are only recorded on
+// the span, since the next search finds the entries again.
+func (c *Client) unindex(ctx context.Context, stale map[string][]interface{}) {
+	_, err := c.redisClient.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for key, ids := range stale {
+			p.SRem(ctx, key, ids...)
+		}
+		return nil
+	})
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+}
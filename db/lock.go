@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// lockTTL is how long a lock outlives a holder that stops renewing it
+	lockTTL = 10 * time.Second
+	// lockWait bounds how long WithLock waits for a contended lock
+	lockWait = 5 * time.Second
+	// lockRetryDelay is the pause between attempts to take a contended lock
+	lockRetryDelay = 50 * time.Millisecond
+)
+
+// errLockLost cancels the context of a lock holder whose lock expired or was
+// taken over before it could be renewed
+var errLockLost = errors.New("lock lost")
+
+// renewLockScript extends the lock in KEYS[1] to ARGV[2] milliseconds if it
+// is still held with token ARGV[1]
+var renewLockScript = script{
+	name: "renew_lock",
+	Script: redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`),
+}
+
+// releaseLockScript deletes the lock in KEYS[1] if it is still held with
+// token ARGV[1], so a holder never releases a lock that expired and was
+// taken by someone else
+var releaseLockScript = script{
+	name: "release_lock",
+	Script: redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`),
+}
+
+// WithLock runs fn while holding an exclusive lock on key, shared by every
+// instance using the same redis. The lock is taken with SET NX PX and renewed
+// while fn runs; if renewal fails the context passed to fn is cancelled. If
+// the lock stays contended for lockWait, ErrConflict is returned without
+// running fn.
+func (c *Client) WithLock(ctx context.Context, key string, fn func(context.Context) error) error {
+	ctx, span := span.DB(ctx, c.tracer, "lock", trace.WithAttributes(attribute.String("lock.key", key)))
+	defer span.End()
+
+	token, err := lockToken()
+	if err != nil {
+		return err
+	}
+	lockKey := "lock:" + key
+	if err := c.acquireLock(ctx, span, lockKey, token); err != nil {
+		return err
+	}
+	defer func() {
+		// release even if ctx was cancelled, or the lock blocks others
+		// until it expires
+		releaseCtx := context.WithoutCancel(ctx)
+		if err := c.runScript(releaseCtx, releaseLockScript, []string{lockKey}, token).Err(); err != nil {
+			span.RecordError(fmt.Errorf("release lock: %w", err))
+		}
+	}()
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		c.renewLock(lockCtx, span, lockKey, token, cancel)
+	}()
+	defer func() {
+		cancel(nil)
+		<-renewed
+	}()
+
+	return fn(lockCtx)
+}
+
+// acquireLock retries SET NX until the lock is taken, recording contention
+// as span events
+func (c *Client) acquireLock(ctx context.Context, span trace.Span, lockKey, token string) error {
+	deadline := time.Now().Add(lockWait)
+	for attempt := 1; ; attempt++ {
+		ok, err := c.redisClient.SetNX(ctx, lockKey, token, lockTTL).Result()
+		if err != nil {
+			return fmt.Errorf("acquire lock: %w", err)
+		}
+		if ok {
+			span.AddEvent("lock acquired", trace.WithAttributes(attribute.Int("lock.attempts", attempt)))
+			return nil
+		}
+		span.AddEvent("lock contended", trace.WithAttributes(attribute.Int("lock.attempt", attempt)))
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: lock %s is held", ErrConflict, lockKey)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryDelay):
+		}
+	}
+}
+
+// renewLock extends the lock every third of its TTL until ctx is done,
+// cancelling ctx if the lock was lost
+func (c *Client) renewLock(ctx context.Context, span trace.Span, lockKey, token string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewed, err := c.runScript(ctx, renewLockScript, []string{lockKey}, token, lockTTL.Milliseconds()).Int()
+		if err == nil && renewed == 1 {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		span.AddEvent("lock lost")
+		cancel(errLockLost)
+		return
+	}
+}
+
+// lockToken returns a random value identifying the holder of a lock
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
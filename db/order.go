@@ -0,0 +1,77 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTransition is returned when an order cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// Status is the lifecycle state of an order
+type Status string
+
+// Order statuses. Orders move from created through paid and shipped to
+// delivered, and can be cancelled until they are delivered.
+const (
+	StatusCreated   Status = "created"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+)
+
+// transitions lists the statuses each status can move to
+var transitions = map[Status][]Status{
+	StatusCreated: {StatusPaid, StatusCancelled},
+	StatusPaid:    {StatusShipped, StatusCancelled},
+	StatusShipped: {StatusDelivered, StatusCancelled},
+}
+
+// TransitionTo moves the order to the next status, returning
+// ErrInvalidTransition if the state machine does not allow the move
+func (o *Order) TransitionTo(next Status) error {
+	for _, allowed := range transitions[o.Status] {
+		if allowed == next {
+			o.Status = next
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, o.Status, next)
+}
+
+// Item is a single line of an order
+type Item struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+// Order is an order as stored in redis
+type Order struct {
+	ID        string    `json:"id"`
+	Customer  string    `json:"customer"`
+	Currency  string    `json:"currency"`
+	Items     []Item    `json:"items"`
+	Total     float64   `json:"total"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ETag identifies the version of the order for conditional requests. Every
+// store moves UpdatedAt on each write, so it serves as the version; it is
+// truncated to microseconds, the precision of the postgres store.
+func (o *Order) ETag() string {
+	return fmt.Sprintf(`"%s-%x"`, o.ID, o.UpdatedAt.UnixMicro())
+}
+
+// SetItems replaces the items of the order and recomputes its total
+func (o *Order) SetItems(items []Item) {
+	o.Items = items
+	o.Total = 0
+	for _, item := range items {
+		o.Total += float64(item.Quantity) * item.Price
+	}
+}
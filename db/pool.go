@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+)
+
+// registerPoolMetrics reports the connection pool counters that redisotel
+// leaves out. redisotel already reports connections in use and idle, the
+// pool limits, and timeouts waiting for a connection. The stats are summed
+// over every node in cluster mode, and tagged with the name of the client.
+func registerPoolMetrics(rdb redis.UniversalClient, name string) error {
+	meter := global.Meter("redis")
+	attrs := []attribute.KeyValue{attribute.String("db.redis.client", name)}
+
+	total, err := meter.Int64ObservableUpDownCounter("db.client.connections.total",
+		instrument.WithUnit("{connection}"),
+		instrument.WithDescription("Number of open connections in the pool"),
+	)
+	if err != nil {
+		return fmt.Errorf("create total connections gauge: %w", err)
+	}
+	hits, err := meter.Int64ObservableCounter("db.client.connections.hits",
+		instrument.WithUnit("{acquire}"),
+		instrument.WithDescription("Number of times a free connection was found in the pool"),
+	)
+	if err != nil {
+		return fmt.Errorf("create pool hits counter: %w", err)
+	}
+	misses, err := meter.Int64ObservableCounter("db.client.connections.misses",
+		instrument.WithUnit("{acquire}"),
+		instrument.WithDescription("Number of times no free connection was found and a command waited for a new one"),
+	)
+	if err != nil {
+		return fmt.Errorf("create pool misses counter: %w", err)
+	}
+	stale, err := meter.Int64ObservableCounter("db.client.connections.stale",
+		instrument.WithUnit("{connection}"),
+		instrument.WithDescription("Number of stale connections removed from the pool"),
+	)
+	if err != nil {
+		return fmt.Errorf("create stale connections counter: %w", err)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := rdb.PoolStats()
+		o.ObserveInt64(total, int64(stats.TotalConns), attrs...)
+		o.ObserveInt64(hits, int64(stats.Hits), attrs...)
+		o.ObserveInt64(misses, int64(stats.Misses), attrs...)
+		o.ObserveInt64(stale, int64(stats.StaleConns), attrs...)
+		return nil
+	}, total, hits, misses, stale)
+	return err
+}
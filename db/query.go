@@ -0,0 +1,30 @@
+package db
+
+// DateLayout formats the creation day orders are searched by
+const DateLayout = "2006-01-02"
+
+// Query selects orders by their fields. Empty fields match every order.
+type Query struct {
+	Customer string
+	Status   Status
+	// CreatedOn matches orders created on the day, in UTC, formatted with
+	// DateLayout
+	CreatedOn string
+}
+
+// Empty reports whether the query matches every order
+func (q Query) Empty() bool {
+	return q == Query{}
+}
+
+// Matches reports whether the order is selected by the query
+func (q Query) Matches(o *Order) bool {
+	return (q.Customer == "" || o.Customer == q.Customer) &&
+		(q.Status == "" || o.Status == q.Status) &&
+		(q.CreatedOn == "" || createdOn(o) == q.CreatedOn)
+}
+
+// createdOn returns the day the order was created on
+func createdOn(o *Order) string {
+	return o.CreatedAt.UTC().Format(DateLayout)
+}
@@ -2,41 +2,538 @@ package db
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	// ErrNotFound is returned when the order does not exist
+	ErrNotFound = errors.New("order not found")
+	// ErrConflict is returned when the order was modified concurrently
+	ErrConflict = errors.New("order modified concurrently")
+)
+
+// orderKeyPrefix namespaces order keys so they can be scanned without
+// matching other keys in the database
+const orderKeyPrefix = "order:"
+
+func orderKey(id string) string {
+	return orderKeyPrefix + id
+}
+
+// Redis deployment modes
+const (
+	ModeStandalone = "standalone"
+	ModeCluster    = "cluster"
+	ModeSentinel   = "sentinel"
+)
+
 type Client struct {
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 	tracer      trace.Tracer
+	// cluster is set when keys may live on different nodes, so commands and
+	// scripts must not span several keys
+	cluster bool
+	// searchIndex is the RediSearch index of orders, or empty when full
+	// text search is disabled
+	searchIndex string
 }
 
-// NewClient creates a new redis client and verifies connectivity using PING
-func NewClient(ctx context.Context, addr string) (*Client, error) {
-	c := redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
+// Options configures the connection to redis
+type Options struct {
+	// Name tells apart the pool metrics of several clients. It defaults to
+	// the mode.
+	Name string
+	// Mode is one of ModeStandalone, ModeCluster, or ModeSentinel
+	Mode string
+	// Addrs holds the address of the server in standalone mode, or the
+	// cluster nodes or sentinels
+	Addrs []string
+	// MasterName is the name of the master monitored by the sentinels
+	MasterName string
+	// Username and Password authenticate with redis; Username selects an
+	// ACL user and may be empty
+	Username string
+	Password string
+	// TLSConfig encrypts connections when set
+	TLSConfig    *tls.Config
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Pool settings are passed to go-redis as is, where zero values select
+	// its defaults
+	PoolSize        int
+	MinIdleConns    int
+	MaxIdleConns    int
+	PoolTimeout     time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnMaxLifetime time.Duration
+	// BreakerThreshold is the number of consecutive connection failures
+	// after which commands fail fast with ErrUnavailable for BreakerCooldown.
+	// The breaker is disabled when it is 0.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Hooks are added after the tracing, metrics, and breaker hooks, so
+	// failures they inject are traced and counted by the breaker
+	Hooks []redis.Hook
+}
+
+// newUniversalClient creates a client for the deployment mode in opts
+func newUniversalClient(opts Options) (redis.UniversalClient, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("no redis address")
+	}
+	switch opts.Mode {
+	case ModeStandalone, "":
+		return redis.NewClient(&redis.Options{
+			Addr:            opts.Addrs[0],
+			Username:        opts.Username,
+			Password:        opts.Password,
+			TLSConfig:       opts.TLSConfig,
+			DialTimeout:     opts.DialTimeout,
+			ReadTimeout:     opts.ReadTimeout,
+			WriteTimeout:    opts.WriteTimeout,
+			PoolSize:        opts.PoolSize,
+			MinIdleConns:    opts.MinIdleConns,
+			MaxIdleConns:    opts.MaxIdleConns,
+			PoolTimeout:     opts.PoolTimeout,
+			ConnMaxIdleTime: opts.ConnMaxIdleTime,
+			ConnMaxLifetime: opts.ConnMaxLifetime,
+		}), nil
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           opts.Addrs,
+			Username:        opts.Username,
+			Password:        opts.Password,
+			TLSConfig:       opts.TLSConfig,
+			DialTimeout:     opts.DialTimeout,
+			ReadTimeout:     opts.ReadTimeout,
+			WriteTimeout:    opts.WriteTimeout,
+			PoolSize:        opts.PoolSize,
+			MinIdleConns:    opts.MinIdleConns,
+			MaxIdleConns:    opts.MaxIdleConns,
+			PoolTimeout:     opts.PoolTimeout,
+			ConnMaxIdleTime: opts.ConnMaxIdleTime,
+			ConnMaxLifetime: opts.ConnMaxLifetime,
+		}), nil
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:      opts.MasterName,
+			SentinelAddrs:   opts.Addrs,
+			Username:        opts.Username,
+			Password:        opts.Password,
+			TLSConfig:       opts.TLSConfig,
+			DialTimeout:     opts.DialTimeout,
+			ReadTimeout:     opts.ReadTimeout,
+			WriteTimeout:    opts.WriteTimeout,
+			PoolSize:        opts.PoolSize,
+			MinIdleConns:    opts.MinIdleConns,
+			MaxIdleConns:    opts.MaxIdleConns,
+			PoolTimeout:     opts.PoolTimeout,
+			ConnMaxIdleTime: opts.ConnMaxIdleTime,
+			ConnMaxLifetime: opts.ConnMaxLifetime,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", opts.Mode)
+	}
+}
+
+// Connect creates a redis client for the deployment in opts whose commands
+// are traced and measured by the redisotel hooks, and verifies connectivity
+// using PING. It is shared by everything that talks to redis, not just the
+// order store.
+func Connect(ctx context.Context, opts Options) (redis.UniversalClient, error) {
+	c, err := newUniversalClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := redisotel.InstrumentTracing(c); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("instrument tracing: %w", err)
+	}
+	if err := redisotel.InstrumentMetrics(c); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("instrument metrics: %w", err)
+	}
+	name := opts.Name
+	if name == "" {
+		name = opts.Mode
+	}
+	if err := registerPoolMetrics(c, name); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("register pool metrics: %w", err)
+	}
+	if opts.BreakerThreshold > 0 {
+		b, err := newBreaker(opts.BreakerThreshold, opts.BreakerCooldown)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		// added after the tracing hook, so fast failures still show up as
+		// failed command spans
+		c.AddHook(b)
+	}
+	for _, hook := range opts.Hooks {
+		c.AddHook(hook)
+	}
 	if _, err := c.Ping(ctx).Result(); err != nil {
+		c.Close()
 		return nil, fmt.Errorf("ping: %w", err)
 	}
+	return c, nil
+}
+
+// NewClient creates a new redis client and verifies connectivity using PING.
+// Every command is traced and measured by the redisotel hooks; the client
+// only adds spans of its own around operations spanning several commands.
+func NewClient(ctx context.Context, opts Options) (*Client, error) {
+	c, err := Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Client{
+	client := &Client{
 		redisClient: c,
 		tracer:      otel.Tracer("redis"),
-	}, nil
+		cluster:     opts.Mode == ModeCluster,
+	}
+	if err := client.loadScripts(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// GetOrder returns the order with the given ID. The wait for redis and the
+// decoding are marked as events on its span.
+func (c *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	ctx, span := span.DB(ctx, c.tracer, "get", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	steps := newStepTimer(span)
+	data, err := c.redisClient.Get(ctx, orderKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	steps.mark(eventReplied)
+	o, err := decodeOrder(data)
+	if err != nil {
+		return nil, err
+	}
+	steps.mark(eventDecoded, attribute.Int("size", len(data)))
+	return o, nil
+}
+
+// PutOrder stores the order under its ID without expiry
+func (c *Client) PutOrder(ctx context.Context, o *Order) error {
+	return c.Set(ctx, o, 0)
+}
+
+// Set stores the order under its ID. The order expires after ttl, or never
+// if ttl is 0. The encoding and the wait for redis are marked as events on
+// its span.
+func (c *Client) Set(ctx context.Context, o *Order, ttl time.Duration) error {
+	ctx, span := span.DB(ctx, c.tracer, "set", trace.WithAttributes(attribute.String("order.id", o.ID)))
+	defer span.End()
+
+	steps := newStepTimer(span)
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("encode order: %w", err)
+	}
+	steps.mark(eventEncoded, attribute.Int("size", len(data)))
+	if err := c.redisClient.Set(ctx, orderKey(o.ID), data, ttl).Err(); err != nil {
+		return err
+	}
+	steps.mark(eventReplied)
+	c.index(ctx, o)
+	return nil
+}
+
+// Exists reports whether the order with the given ID is stored
+func (c *Client) Exists(ctx context.Context, id string) (bool, error) {
+	ctx, span := span.DB(ctx, c.tracer, "exists", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	n, err := c.redisClient.Exists(ctx, orderKey(id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Expire makes the order with the given ID expire after ttl
+func (c *Client) Expire(ctx context.Context, id string, ttl time.Duration) error {
+	ctx, span := span.DB(ctx, c.tracer, "expire", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	ok, err := c.redisClient.Expire(ctx, orderKey(id), ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
 }
 
-// Get returns the order with the given ID
-func (c *Client) Get(ctx context.Context, id string) (string, error) {
-	ctx, span := c.tracer.Start(ctx, "get", trace.WithAttributes(attribute.String("id", id)))
+// maxTxAttempts bounds how often Tx runs a transaction whose watched keys
+// keep changing before giving up with ErrConflict
+const maxTxAttempts = 3
+
+// Tx runs fn as an optimistic transaction watching keys. Writes queued by fn
+// with TxPipelined are only applied if none of the keys changed since they
+// were watched; otherwise fn is run again, up to maxTxAttempts times. Each
+// retry is recorded as an event on the transaction span.
+func (c *Client) Tx(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	ctx, span := span.DB(ctx, c.tracer, "tx", trace.WithAttributes(attribute.StringSlice("keys", keys)))
+	defer span.End()
+
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err := c.redisClient.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			span.SetAttributes(attribute.Int("tx.attempts", attempt))
+			return err
+		}
+		span.AddEvent("tx retry", trace.WithAttributes(attribute.Int("tx.attempt", attempt)))
+	}
+	span.SetAttributes(attribute.Int("tx.attempts", maxTxAttempts))
+	return ErrConflict
+}
+
+// UpdateOrder applies fn to the stored order and writes the result back. If
+// the order changes while fn runs, fn is applied again to the new version;
+// ErrConflict is returned if it keeps changing.
+func (c *Client) UpdateOrder(ctx context.Context, id string, fn func(*Order) error) (*Order, error) {
+	ctx, span := span.DB(ctx, c.tracer, "update", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	key := orderKey(id)
+	var order, prev *Order
+	err := c.Tx(ctx, func(tx *redis.Tx) error {
+		steps := newStepTimer(span)
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		steps.mark(eventReplied)
+		if order, err = decodeOrder(data); err != nil {
+			return err
+		}
+		steps.mark(eventDecoded, attribute.Int("size", len(data)))
+		before := *order
+		prev = &before
+		if err := fn(order); err != nil {
+			return err
+		}
+		steps.skip()
+		order.UpdatedAt = time.Now().UTC()
+		if data, err = json.Marshal(order); err != nil {
+			return fmt.Errorf("encode order: %w", err)
+		}
+		steps.mark(eventEncoded, attribute.Int("size", len(data)))
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, data, 0)
+			return nil
+		})
+		if err == nil {
+			steps.mark(eventReplied)
+		}
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	c.reindex(ctx, []*Order{prev}, order)
+	return order, nil
+}
+
+// Delete removes the order with the given ID. Its index entries are left for
+// Search to clean up, as reading the order first would cost a round trip.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	ctx, span := span.DB(ctx, c.tracer, "delete", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	n, err := c.redisClient.Del(ctx, orderKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns a page of orders starting at cursor, along with the cursor of
+// the next page. A next cursor of 0 means the scan is complete. As with SCAN,
+// limit is a hint and pages may be smaller or larger. In cluster mode only
+// the orders on the node serving the scan are listed.
+func (c *Client) List(ctx context.Context, cursor uint64, limit int64) ([]*Order, uint64, error) {
+	ctx, span := span.DB(ctx, c.tracer, "list", trace.WithAttributes(
+		attribute.Int64("cursor", int64(cursor)),
+		attribute.Int64("limit", limit),
+	))
+	defer span.End()
+
+	keys, next, err := c.redisClient.Scan(ctx, cursor, orderKeyPrefix+"*", limit).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+
+	orders, err := c.getKeys(ctx, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	return orders, next, nil
+}
+
+// GetMany returns the orders with the given IDs in a single MGET. Orders that
+// do not exist are left out, so fewer orders than IDs may be returned.
+func (c *Client) GetMany(ctx context.Context, ids []string) ([]*Order, error) {
+	ctx, span := span.DB(ctx, c.tracer, "get many", trace.WithAttributes(attribute.Int("batch.size", len(ids))))
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, orderKey(id))
+	}
+	orders, err := c.getKeys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("batch.found", len(orders)))
+	return orders, nil
+}
+
+// SetMany stores the orders in a single pipelined round trip
+func (c *Client) SetMany(ctx context.Context, orders []*Order) error {
+	ctx, span := span.DB(ctx, c.tracer, "set many", trace.WithAttributes(attribute.Int("batch.size", len(orders))))
 	defer span.End()
-	return c.redisClient.Get(ctx, id).Result()
+
+	if len(orders) == 0 {
+		return nil
+	}
+	steps := newStepTimer(span)
+	_, err := c.redisClient.Pipelined(ctx, func(p redis.Pipeliner) error {
+		size := 0
+		for _, o := range orders {
+			data, err := json.Marshal(o)
+			if err != nil {
+				return fmt.Errorf("encode order: %w", err)
+			}
+			size += len(data)
+			p.Set(ctx, orderKey(o.ID), data, 0)
+		}
+		steps.mark(eventEncoded, attribute.Int("size", size))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	steps.mark(eventReplied)
+	c.index(ctx, orders...)
+	return nil
+}
+
+// getKeys reads the orders stored under keys with MGET, skipping keys that
+// no longer exist. The wait for redis and the decoding are marked as events
+// on the span of ctx.
+func (c *Client) getKeys(ctx context.Context, keys []string) ([]*Order, error) {
+	steps := newStepTimer(trace.SpanFromContext(ctx))
+	values, err := c.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	steps.mark(eventReplied)
+	orders := make([]*Order, 0, len(values))
+	size := 0
+	for _, v := range values {
+		// keys deleted since they were listed come back as nil
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		order, err := decodeOrder([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		size += len(data)
+		orders = append(orders, order)
+	}
+	steps.mark(eventDecoded, attribute.Int("size", size))
+	return orders, nil
+}
+
+// mget reads keys in one round trip. A cluster cannot MGET keys hashing to
+// different slots, so there the reads are pipelined instead, which the
+// cluster client splits by node.
+func (c *Client) mget(ctx context.Context, keys []string) ([]interface{}, error) {
+	if !c.cluster {
+		return c.redisClient.MGet(ctx, keys...).Result()
+	}
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	_, err := c.redisClient.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, p.Get(ctx, key))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	values := make([]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		v, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			values = append(values, nil)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func decodeOrder(data []byte) (*Order, error) {
+	var o Order
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("decode order: %w", err)
+	}
+	return &o, nil
+}
+
+// Ping verifies that redis is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
 }
 
-func (c *Client) Close() {
-	c.redisClient.Close()
+func (c *Client) Close() error {
+	return c.redisClient.Close()
 }
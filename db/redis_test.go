@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// replyHook answers every command in place of redis, replying to GET with
+// value, so the client can be measured without the network round trip
+type replyHook struct {
+	value string
+}
+
+func (h replyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		panic("replyHook: unexpected dial")
+	}
+}
+
+func (h replyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		switch cmd := cmd.(type) {
+		case *redis.StatusCmd:
+			cmd.SetVal("OK")
+		case *redis.StringCmd:
+			// GET and SCRIPT LOAD, whose SHA the client does not check
+			cmd.SetVal(h.value)
+		}
+		return nil
+	}
+}
+
+func (h replyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.ProcessHook(nil)(ctx, cmd)
+		}
+		return nil
+	}
+}
+
+// BenchmarkClientGetOrder measures the overhead of tracing the redis
+// wrapper, its own span and step events and the span of the redisotel hook,
+// with redis answered in process by replyHook
+func BenchmarkClientGetOrder(b *testing.B) {
+	now := time.Now().UTC()
+	order := &Order{ID: "order-1", Customer: "customer-1", Currency: "USD", Status: StatusCreated, CreatedAt: now, UpdatedAt: now}
+	order.SetItems([]Item{{SKU: "ABC-1234", Quantity: 2, Price: 5}})
+	data, err := json.Marshal(order)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	providers := []struct {
+		name string
+		tp   trace.TracerProvider
+	}{
+		{name: "traced", tp: sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(tracetest.NewNoopExporter()),
+		)},
+		{name: "sampled out", tp: sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.NeverSample()),
+			sdktrace.WithBatcher(tracetest.NewNoopExporter()),
+		)},
+		{name: "disabled", tp: trace.NewNoopTracerProvider()},
+	}
+	for _, p := range providers {
+		b.Run(p.name, func(b *testing.B) {
+			// the client and the redisotel hook trace with the global
+			// provider of the time they are created
+			prev := otel.GetTracerProvider()
+			otel.SetTracerProvider(p.tp)
+			b.Cleanup(func() { otel.SetTracerProvider(prev) })
+			if tp, ok := p.tp.(*sdktrace.TracerProvider); ok {
+				b.Cleanup(func() { tp.Shutdown(context.Background()) })
+			}
+
+			ctx := context.Background()
+			c, err := NewClient(ctx, Options{
+				Name:  "bench " + p.name,
+				Addrs: []string{"localhost:6379"},
+				Hooks: []redis.Hook{replyHook{value: string(data)}},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { c.Close() })
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetOrder(ctx, "order-1"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrOrderExists is returned when creating an order whose ID is taken
+	ErrOrderExists = errors.New("order already exists")
+	// ErrOutOfStock is returned when an order asks for more of a SKU than
+	// is in stock
+	ErrOutOfStock = errors.New("out of stock")
+)
+
+// stockKey is the hash the inventory service keeps stock levels in, one
+// field per SKU, so orders can reserve stock when both share a redis
+const stockKey = "stock"
+
+// script is a Lua script run with EVALSHA, named so its spans can be told
+// apart
+type script struct {
+	name string
+	*redis.Script
+}
+
+// createOrderScript stores an order and decrements the stock of its items in
+// one atomic step. KEYS[1] is the order key and KEYS[2], when set, the stock
+// hash; ARGV[1] is the encoded order followed by the SKU and quantity of each
+// item. SKUs without a stock field are not tracked and are left alone. The
+// quantities of items sharing a SKU are added up before they are checked
+// against its stock. Returns 0 if the order exists, minus the position of
+// the first item of a SKU out of stock, or else the positions of the items
+// whose stock was reserved once the order is stored.
+var createOrderScript = script{
+	name: "create_order",
+	Script: redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local reserved = {}
+if KEYS[2] then
+	local skus = {}
+	local wanted = {}
+	local first = {}
+	for i = 2, #ARGV, 2 do
+		local sku = ARGV[i]
+		if not wanted[sku] then
+			table.insert(skus, sku)
+			wanted[sku] = 0
+			first[sku] = i / 2
+		end
+		wanted[sku] = wanted[sku] + tonumber(ARGV[i + 1])
+	end
+	local tracked = {}
+	for _, sku in ipairs(skus) do
+		local stock = redis.call("HGET", KEYS[2], sku)
+		if stock then
+			if tonumber(stock) < wanted[sku] then
+				return -first[sku]
+			end
+			tracked[sku] = true
+		end
+	end
+	for _, sku in ipairs(skus) do
+		if tracked[sku] then
+			redis.call("HINCRBY", KEYS[2], sku, -wanted[sku])
+		end
+	end
+	for i = 2, #ARGV, 2 do
+		if tracked[ARGV[i]] then
+			table.insert(reserved, i / 2)
+		end
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return reserved
+`),
+}
+
+// scripts lists every script loaded into redis at startup
+var scripts = []script{createOrderScript, reserveStockScript, releaseStockScript, renewLockScript, releaseLockScript}
+
+// loadScripts loads every script into the redis script cache so later runs
+// only need to send its SHA
+func (c *Client) loadScripts(ctx context.Context) error {
+	for _, s := range scripts {
+		if err := s.Load(ctx, c.redisClient).Err(); err != nil {
+			return fmt.Errorf("load script %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// runScript runs the script with EVALSHA, falling back to EVAL if redis has
+// lost it from its cache, e.g. after a restart
+func (c *Client) runScript(ctx context.Context, s script, keys []string, args ...interface{}) *redis.Cmd {
+	ctx, span := span.DB(ctx, c.tracer, "script "+s.name, trace.WithAttributes(
+		attribute.String("db.redis.script", s.name),
+		attribute.Int("db.redis.script.keys", len(keys)),
+	))
+	defer span.End()
+
+	return s.Run(ctx, c.redisClient, keys, args...)
+}
+
+// CreateOrder stores a new order and reserves stock for its items
+// atomically. It returns ErrOrderExists if the ID is taken and
+// ErrOutOfStock if any item is short of stock, in which case nothing is
+// written. In cluster mode the stock hash lives in another slot than the
+// order, so no stock is reserved.
+func (c *Client) CreateOrder(ctx context.Context, o *Order) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("encode order: %w", err)
+	}
+	keys, args := c.createOrderArgs(o, data)
+	if err := createOrderResult(ctx, c.runScript(ctx, createOrderScript, keys, args...), o); err != nil {
+		return err
+	}
+	c.index(ctx, o)
+	return nil
+}
+
+// CreateOrders creates each order like CreateOrder, running the scripts in
+// a single pipeline. Each order is created atomically, but the batch is not:
+// the error of each order is returned by index. Orders whose script was
+// missing from the redis script cache are retried one at a time.
+func (c *Client) CreateOrders(ctx context.Context, orders []*Order) []error {
+	ctx, span := span.DB(ctx, c.tracer, "script "+createOrderScript.name+" pipeline", trace.WithAttributes(
+		attribute.String("db.redis.script", createOrderScript.name),
+		attribute.Int("db.redis.pipeline.size", len(orders)),
+	))
+	defer span.End()
+
+	errs := make([]error, len(orders))
+	cmds := make([]*redis.Cmd, len(orders))
+	pipe := c.redisClient.Pipeline()
+	for i, o := range orders {
+		data, err := json.Marshal(o)
+		if err != nil {
+			errs[i] = fmt.Errorf("encode order: %w", err)
+			continue
+		}
+		keys, args := c.createOrderArgs(o, data)
+		cmds[i] = createOrderScript.EvalSha(ctx, pipe, keys, args...)
+	}
+	// failed commands are reported per order below
+	_, _ = pipe.Exec(ctx)
+
+	var created []*Order
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			// CreateOrder indexes the order itself
+			errs[i] = c.CreateOrder(ctx, orders[i])
+			continue
+		}
+		if errs[i] = createOrderResult(ctx, cmd, orders[i]); errs[i] == nil {
+			created = append(created, orders[i])
+		}
+	}
+	if len(created) > 0 {
+		c.index(ctx, created...)
+	}
+	return errs
+}
+
+// createOrderArgs returns the keys and arguments of createOrderScript for
+// the order encoded as data
+func (c *Client) createOrderArgs(o *Order, data []byte) ([]string, []interface{}) {
+	keys := []string{orderKey(o.ID)}
+	args := []interface{}{data}
+	if !c.cluster {
+		keys = append(keys, stockKey)
+		for _, item := range o.Items {
+			args = append(args, item.SKU, item.Quantity)
+		}
+	}
+	return keys, args
+}
+
+// createOrderResult maps the result of createOrderScript for the order to an
+// error, recording the SKUs and quantities reserved, or the SKU out of stock,
+// on the span of ctx
+func createOrderResult(ctx context.Context, cmd *redis.Cmd, o *Order) error {
+	result, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+	span := trace.SpanFromContext(ctx)
+	switch result := result.(type) {
+	case int64:
+		if result == 0 {
+			return ErrOrderExists
+		}
+		if n := int(-result); n >= 1 && n <= len(o.Items) {
+			sku := o.Items[n-1].SKU
+			span.SetAttributes(attribute.String("inventory.unavailable_sku", sku))
+			return fmt.Errorf("%w: %s", ErrOutOfStock, sku)
+		}
+		return fmt.Errorf("unexpected %s result %d", createOrderScript.name, result)
+	case []interface{}:
+		skus := make([]string, 0, len(result))
+		quantities := make([]int, 0, len(result))
+		for _, v := range result {
+			if n, ok := v.(int64); ok && n >= 1 && int(n) <= len(o.Items) {
+				skus = append(skus, o.Items[n-1].SKU)
+				quantities = append(quantities, o.Items[n-1].Quantity)
+			}
+		}
+		span.SetAttributes(
+			attribute.StringSlice("inventory.reserved_skus", skus),
+			attribute.IntSlice("inventory.reserved_quantities", quantities),
+		)
+		return nil
+	}
+	return fmt.Errorf("unexpected %s result %v", createOrderScript.name, result)
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/observiq/tracing/telemetry/span"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrSearchUnsupported is returned by full text searches when the store has
+// no search index, e.g. because redis lacks the RediSearch module
+var ErrSearchUnsupported = errors.New("full text search is not available")
+
+// searchDocPrefix namespaces the hashes RediSearch indexes. Orders are
+// stored as JSON strings, which it cannot index, so the searchable fields
+// are copied to a hash alongside each order.
+const searchDocPrefix = "order-doc:"
+
+// maxSearchTerms bounds the terms of a full text query
+const maxSearchTerms = 10
+
+func searchDocKey(id string) string {
+	return searchDocPrefix + id
+}
+
+// EnableSearch indexes orders for full text search with RediSearch, creating
+// the index if it does not exist. It returns ErrSearchUnsupported if redis
+// does not have the module. Orders are indexed as they are written, so
+// orders stored before search was enabled are not found until they are next
+// written.
+func (c *Client) EnableSearch(ctx context.Context, index string) error {
+	err := c.redisClient.Do(ctx, "FT.INFO", index).Err()
+	switch {
+	case err == nil:
+	case isRedisError(err, "unknown command"):
+		return ErrSearchUnsupported
+	case isRedisError(err, "unknown index"), isRedisError(err, "no such index"):
+		err := c.redisClient.Do(ctx, "FT.CREATE", index,
+			"ON", "HASH", "PREFIX", "1", searchDocPrefix,
+			"SCHEMA",
+			"customer", "TEXT",
+			"skus", "TEXT",
+			"status", "TAG",
+			"currency", "TAG",
+			"created_at", "NUMERIC", "SORTABLE",
+		).Err()
+		if err != nil {
+			return fmt.Errorf("create search index: %w", err)
+		}
+	default:
+		return fmt.Errorf("inspect search index: %w", err)
+	}
+	c.searchIndex = index
+	return nil
+}
+
+// searchDoc returns the fields of the hash indexed for the order
+func searchDoc(o *Order) []interface{} {
+	skus := make([]string, 0, len(o.Items))
+	for _, item := range o.Items {
+		skus = append(skus, item.SKU)
+	}
+	return []interface{}{
+		"customer", o.Customer,
+		"skus", strings.Join(skus, " "),
+		"status", string(o.Status),
+		"currency", o.Currency,
+		"created_at", o.CreatedAt.Unix(),
+	}
+}
+
+// SearchText returns a page of the orders matching every term of text in
+// their customer or SKUs, newest first. cursor is the offset of the page and
+// the next cursor is 0 once every match has been returned. Only letters and
+// digits are kept from text, so the query sent to RediSearch, which is
+// recorded as the db.statement of the span, never carries query syntax
+// from the request.
+func (c *Client) SearchText(ctx context.Context, text string, cursor uint64, limit int64) ([]*Order, uint64, error) {
+	if c.searchIndex == "" {
+		return nil, 0, ErrSearchUnsupported
+	}
+	query := sanitizeSearch(text)
+	if query == "" {
+		return nil, 0, nil
+	}
+	args := []interface{}{"FT.SEARCH", c.searchIndex, query, "NOCONTENT",
+		"SORTBY", "created_at", "DESC", "LIMIT", cursor, limit}
+
+	ctx, span := span.DB(ctx, c.tracer, "search text", trace.WithAttributes(
+		semconv.DBOperationKey.String("FT.SEARCH"),
+		semconv.DBStatementKey.String(statement(args)),
+	))
+	defer span.End()
+
+	res, err := c.redisClient.Do(ctx, args...).Result()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	total, docKeys, err := parseSearchIDs(res)
+	if err != nil {
+		return nil, 0, err
+	}
+	span.SetAttributes(attribute.Int64("search.matches", total))
+
+	var next uint64
+	if end := cursor + uint64(limit); end < uint64(total) {
+		next = end
+	}
+	if len(docKeys) == 0 {
+		return nil, next, nil
+	}
+
+	keys := make([]string, len(docKeys))
+	for i, docKey := range docKeys {
+		keys[i] = orderKey(strings.TrimPrefix(docKey, searchDocPrefix))
+	}
+	values, err := c.mget(ctx, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	orders := make([]*Order, 0, len(values))
+	var stale []string
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// the order was deleted
+			stale = append(stale, docKeys[i])
+			continue
+		}
+		order, err := decodeOrder([]byte(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+	if len(stale) > 0 {
+		if err := c.redisClient.Del(ctx, stale...).Err(); err != nil {
+			span.RecordError(err)
+		}
+	}
+	return orders, next, nil
+}
+
+// sanitizeSearch reduces text to its words of letters and digits, lower
+// cased, dropping everything RediSearch would read as query syntax
+func sanitizeSearch(text string) string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return strings.Join(terms, " ")
+}
+
+// statement renders a command for the db.statement attribute
+func statement(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = fmt.Sprint(arg)
+		if s, ok := arg.(string); ok && strings.Contains(s, " ") {
+			parts[i] = strconv.Quote(s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSearchIDs reads the total and the document keys from an FT.SEARCH
+// NOCONTENT reply, which is an array in RESP2 and a map in RESP3
+func parseSearchIDs(res interface{}) (int64, []string, error) {
+	switch reply := res.(type) {
+	case []interface{}:
+		if len(reply) == 0 {
+			return 0, nil, errors.New("empty search reply")
+		}
+		total, ok := reply[0].(int64)
+		if !ok {
+			return 0, nil, fmt.Errorf("unexpected search total %T", reply[0])
+		}
+		ids := make([]string, 0, len(reply)-1)
+		for _, id := range reply[1:] {
+			if s, ok := id.(string); ok {
+				ids = append(ids, s)
+			}
+		}
+		return total, ids, nil
+	case map[interface{}]interface{}:
+		total, _ := reply["total_results"].(int64)
+		results, _ := reply["results"].([]interface{})
+		ids := make([]string, 0, len(results))
+		for _, r := range results {
+			doc, ok := r.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			if s, ok := doc["id"].(string); ok {
+				ids = append(ids, s)
+			}
+		}
+		return total, ids, nil
+	default:
+		return 0, nil, fmt.Errorf("unexpected search reply %T", res)
+	}
+}
+
+// isRedisError reports whether err is an error reply containing msg, which
+// is matched case insensitively as modules differ in capitalization
+func isRedisError(err error, msg string) bool {
+	return strings.Contains(strings.ToLower(err.Error()), msg)
+}
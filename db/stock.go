@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reserveStockScript reserves stock for more items of an existing order.
+// KEYS[1] is the stock hash and ARGV the SKU and quantity of each item. Like
+// createOrderScript, quantities are added up per SKU, SKUs without a stock
+// field are left alone, and nothing is reserved unless every SKU is in
+// stock. Returns 0, or minus the position of the first item of a SKU out of
+// stock.
+var reserveStockScript = script{
+	name: "reserve_stock",
+	Script: redis.NewScript(`
+local skus = {}
+local wanted = {}
+local first = {}
+for i = 1, #ARGV, 2 do
+	local sku = ARGV[i]
+	if not wanted[sku] then
+		table.insert(skus, sku)
+		wanted[sku] = 0
+		first[sku] = (i + 1) / 2
+	end
+	wanted[sku] = wanted[sku] + tonumber(ARGV[i + 1])
+end
+local tracked = {}
+for _, sku in ipairs(skus) do
+	local stock = redis.call("HGET", KEYS[1], sku)
+	if stock then
+		if tonumber(stock) < wanted[sku] then
+			return -first[sku]
+		end
+		table.insert(tracked, sku)
+	end
+end
+for _, sku in ipairs(tracked) do
+	redis.call("HINCRBY", KEYS[1], sku, -wanted[sku])
+end
+return 0
+`),
+}
+
+// releaseStockScript returns stock reserved by createOrderScript. KEYS[1]
+// is the stock hash and ARGV the SKU and quantity of each item. Like
+// reservations, SKUs without a stock field are left alone.
+var releaseStockScript = script{
+	name: "release_stock",
+	Script: redis.NewScript(`
+for i = 1, #ARGV, 2 do
+	if redis.call("HEXISTS", KEYS[1], ARGV[i]) == 1 then
+		redis.call("HINCRBY", KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+end
+return 1
+`),
+}
+
+// ReleaseStock returns the stock of the items to the stock hash, undoing the
+// reservation made as their order was created. In cluster mode no stock is
+// reserved, so none is released.
+func (c *Client) ReleaseStock(ctx context.Context, items []Item) error {
+	if c.cluster || len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(items)*2)
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		args = append(args, item.SKU, item.Quantity)
+		skus = append(skus, item.SKU)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("inventory.released_skus", skus))
+	return c.runScript(ctx, releaseStockScript, []string{stockKey}, args...).Err()
+}
+
+// ReserveStock reserves stock for the items, as CreateOrder does for the
+// items of a new order, when items are added to an existing one. It returns
+// ErrOutOfStock if any SKU is short of stock, in which case nothing is
+// reserved. In cluster mode no stock is reserved.
+func (c *Client) ReserveStock(ctx context.Context, items []Item) error {
+	if c.cluster || len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(items)*2)
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		args = append(args, item.SKU, item.Quantity)
+		skus = append(skus, item.SKU)
+	}
+	span := trace.SpanFromContext(ctx)
+	n, err := c.runScript(ctx, reserveStockScript, []string{stockKey}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if n < 0 && -n <= len(items) {
+		sku := items[-n-1].SKU
+		span.SetAttributes(attribute.String("inventory.unavailable_sku", sku))
+		return fmt.Errorf("%w: %s", ErrOutOfStock, sku)
+	}
+	span.SetAttributes(attribute.StringSlice("inventory.reserved_skus", skus))
+	return nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Events marking the steps of an operation on its span
+const (
+	// eventEncoded marks orders serialized to JSON
+	eventEncoded = "orders encoded"
+	// eventDecoded marks orders deserialized from JSON
+	eventDecoded = "orders decoded"
+	// eventReplied marks redis replying, after the network round trip and
+	// the time redis spent on the command
+	eventReplied = "redis replied"
+)
+
+// durationKey is how long the step marked by an event took
+const durationKey = attribute.Key("duration_ms")
+
+// stepTimer breaks the duration of a span down into its steps. Each step is
+// marked by an event carrying the time since the previous one, so the time
+// spent serializing can be told apart from the wait for redis.
+type stepTimer struct {
+	span trace.Span
+	last time.Time
+}
+
+func newStepTimer(span trace.Span) *stepTimer {
+	return &stepTimer{span: span, last: time.Now()}
+}
+
+// mark ends a step with the named event
+func (t *stepTimer) mark(event string, attrs ...attribute.KeyValue) {
+	now := time.Now()
+	attrs = append(attrs, durationKey.Float64(float64(now.Sub(t.last))/float64(time.Millisecond)))
+	t.span.AddEvent(event, trace.WithTimestamp(now), trace.WithAttributes(attrs...))
+	t.last = now
+}
+
+// skip starts the next step without marking the current one, leaving out
+// time that is not part of any step
+func (t *stepTimer) skip() {
+	t.last = time.Now()
+}
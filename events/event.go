@@ -0,0 +1,86 @@
+// Package events publishes changes to orders for other services to react to.
+// Events carry the trace context of the request that caused them, so the
+// spans of consumers join the trace of that request.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Type names what happened to an order
+type Type string
+
+// Event types
+const (
+	OrderCreated       Type = "order.created"
+	OrderUpdated       Type = "order.updated"
+	OrderStatusChanged Type = "order.status_changed"
+	OrderDeleted       Type = "order.deleted"
+)
+
+// Event describes a change to an order
+type Event struct {
+	Type    Type      `json:"type"`
+	OrderID string    `json:"order_id"`
+	Status  db.Status `json:"status,omitempty"`
+	Time    time.Time `json:"time"`
+	// TraceContext holds the propagation headers of the span that published
+	// the event
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// attrs describes the event on the spans publishing and processing it
+func (e Event) attrs() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("event.type", string(e.Type)),
+		attribute.String("order.id", e.OrderID),
+	}
+}
+
+// New returns an event of type t about the order
+func New(t Type, o *db.Order) Event {
+	return Event{
+		Type:    t,
+		OrderID: o.ID,
+		Status:  o.Status,
+		Time:    time.Now().UTC(),
+	}
+}
+
+// Publisher sends events to their consumers
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Watcher delivers the events about individual orders as they are
+// published
+type Watcher interface {
+	// Watch returns the events about the order published from now on,
+	// until stop is called
+	Watch(orderID string) (events <-chan Event, stop func())
+}
+
+// inject stores the trace context of ctx in the event
+func (e *Event) inject(ctx context.Context) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	e.TraceContext = carrier
+}
+
+// extract returns ctx with the trace context the event was published with
+func (e *Event) extract(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.TraceContext))
+}
+
+// SpanContext returns the span context the event was published from, which
+// is invalid when the event carries none
+func (e Event) SpanContext() trace.SpanContext {
+	return trace.SpanContextFromContext(e.extract(context.Background()))
+}
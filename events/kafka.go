@@ -0,0 +1,173 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KafkaPublisher publishes events to a kafka topic, keyed by order ID so the
+// events of an order keep their order. Unlike the JSON payload of the redis
+// publisher, the trace context travels in the message headers, where other
+// kafka instrumentations look for it.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+	topic  string
+	tracer trace.Tracer
+}
+
+// NewKafkaPublisher creates a publisher sending events to topic on brokers
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// publish right away rather than waiting up to a second for a
+			// batch to fill, since the request waits on the write
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		topic:  topic,
+		tracer: otel.Tracer("events"),
+	}
+}
+
+// Publish sends the event, injecting the trace context of a producer span
+// into the message headers
+func (p *KafkaPublisher) Publish(ctx context.Context, e Event) error {
+	attrs := append(e.attrs(), semconv.MessagingKafkaMessageKeyKey.String(e.OrderID))
+	ctx, span := span.Producer(ctx, p.tracer, span.Messaging{System: "kafka", Destination: p.topic},
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	msg := kafka.Message{
+		Key:   []byte(e.OrderID),
+		Value: data,
+	}
+	otel.GetTextMapPropagator().Inject(ctx, (*headerCarrier)(&msg.Headers))
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("publish event: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the connections to the brokers
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// Consume handles the events of topic as a member of the consumer group
+// until ctx is done. Each event is handled in a consumer span that is a child
+// of the producer span found in the message headers, so it joins the trace
+// of the request that published it. Offsets are committed once an event is
+// handled, whether or not handling it failed; failures are recorded on the
+// span and logged.
+func Consume(ctx context.Context, brokers []string, topic, group string, handle func(context.Context, Event) error) error {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: group,
+	})
+	defer r.Close()
+
+	tracer := otel.Tracer("events")
+	for {
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch message: %w", err)
+		}
+		consume(ctx, tracer, group, msg, handle)
+		if err := r.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit message: %w", err)
+		}
+	}
+}
+
+func consume(ctx context.Context, tracer trace.Tracer, group string, msg kafka.Message, handle func(context.Context, Event) error) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, (*headerCarrier)(&msg.Headers))
+
+	var e Event
+	decodeErr := json.Unmarshal(msg.Value, &e)
+	attrs := append(e.attrs(),
+		semconv.MessagingKafkaMessageKeyKey.String(string(msg.Key)),
+		semconv.MessagingKafkaConsumerGroupKey.String(group),
+		semconv.MessagingKafkaPartitionKey.Int(msg.Partition),
+		attribute.Int64("messaging.kafka.offset", msg.Offset),
+	)
+	ctx, span := span.Consumer(ctx, tracer, span.Messaging{System: "kafka", Destination: msg.Topic},
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	err := decodeErr
+	if err != nil {
+		err = fmt.Errorf("decode event: %w", err)
+	} else {
+		err = handle(ctx, e)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "handle event", "topic", msg.Topic, "offset", msg.Offset, "type", e.Type, "order_id", e.OrderID, "error", err)
+	}
+}
+
+// headerCarrier adapts kafka message headers to the propagation API
+type headerCarrier []kafka.Header
+
+var _ propagation.TextMapCarrier = (*headerCarrier)(nil)
+
+// Get returns the value of the first header with the key
+func (c *headerCarrier) Get(key string) string {
+	for _, h := range *c {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the headers with the key by one holding value
+func (c *headerCarrier) Set(key, value string) {
+	headers := (*c)[:0]
+	for _, h := range *c {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	*c = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys lists the keys of the headers
+func (c *headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Outbox is implemented by stores that record an event in the same
+// transaction as each change to an order, see store.SQL.EnableOutbox
+type Outbox interface {
+	// RelayOutbox hands up to limit recorded events to publish in the order
+	// they were recorded, stopping at the first that fails. Published events
+	// are removed from the outbox. It returns the number published.
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, Event) error) (int, error)
+}
+
+// NewRecorded returns an event like New that carries the trace context of
+// ctx, so the span relaying it from the outbox can link to the change
+func NewRecorded(ctx context.Context, t Type, o *db.Order) Event {
+	e := New(t, o)
+	e.inject(ctx)
+	return e
+}
+
+// Relay publishes the events recorded in an outbox from a background
+// worker. Since an event is only removed once published, an event is
+// published at least once, and more than once only if the relay dies between
+// publishing it and removing it.
+//
+// Each poll runs in a span, and each event is published in a child span
+// linked to the span of the change that recorded it.
+type Relay struct {
+	outbox    Outbox
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	tracer    trace.Tracer
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRelay publishes the events of outbox with publisher, polling every
+// interval for up to batchSize events at a time
+func NewRelay(outbox Outbox, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	r := &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+		tracer:    otel.Tracer("events"),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Close stops the relay after a last poll
+func (r *Relay) Close() error {
+	close(r.stop)
+	<-r.done
+	return nil
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			r.drain()
+			return
+		}
+		r.drain()
+	}
+}
+
+// drain relays batches until the outbox holds less than a full batch or a
+// publish fails
+func (r *Relay) drain() {
+	for {
+		if r.relay() < r.batchSize {
+			return
+		}
+	}
+}
+
+// relay publishes a batch of events, returning how many were published
+func (r *Relay) relay() int {
+	ctx, span := r.tracer.Start(context.Background(), "outbox relay",
+		trace.WithAttributes(attribute.Int("batch.limit", r.batchSize)),
+	)
+	defer span.End()
+
+	n, err := r.outbox.RelayOutbox(ctx, r.batchSize, r.publish)
+	span.SetAttributes(attribute.Int("batch.size", n))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		otel.Handle(fmt.Errorf("relay outbox: %w", err))
+		return 0
+	}
+	return n
+}
+
+// publish sends an event in a span linked to the change that recorded it
+func (r *Relay) publish(ctx context.Context, e Event) error {
+	link := trace.LinkFromContext(e.extract(context.Background()))
+	ctx, span := r.tracer.Start(ctx, "outbox publish",
+		trace.WithLinks(link),
+		trace.WithAttributes(
+			attribute.String("event.type", string(e.Type)),
+			attribute.String("order.id", e.OrderID),
+		),
+	)
+	defer span.End()
+
+	if err := r.publisher.Publish(ctx, e); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
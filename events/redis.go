@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisPublisher publishes events to a redis pub/sub channel. Events are
+// only delivered to subscribers connected at the time.
+type RedisPublisher struct {
+	client  redis.UniversalClient
+	channel string
+	tracer  trace.Tracer
+}
+
+// NewRedisPublisher creates a publisher sending events to channel
+func NewRedisPublisher(client redis.UniversalClient, channel string) *RedisPublisher {
+	return &RedisPublisher{
+		client:  client,
+		channel: channel,
+		tracer:  otel.Tracer("events"),
+	}
+}
+
+// Publish sends the event, injecting the trace context of a producer span
+func (p *RedisPublisher) Publish(ctx context.Context, e Event) error {
+	ctx, span := span.Producer(ctx, p.tracer, span.Messaging{System: "redis", Destination: p.channel},
+		trace.WithAttributes(e.attrs()...),
+	)
+	defer span.End()
+
+	e.inject(ctx)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if err := p.client.Publish(ctx, p.channel, data).Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("publish event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the redis connection
+func (p *RedisPublisher) Close() error {
+	return p.client.Close()
+}
+
+// Subscribe handles the events published to channel until ctx is done. Each
+// event is handled in a consumer span that continues the trace of the
+// request that published it. Events that fail to decode or to be handled are
+// logged and skipped.
+func Subscribe(ctx context.Context, client redis.UniversalClient, channel string, handle func(context.Context, Event) error) error {
+	sub := client.Subscribe(ctx, channel)
+	defer sub.Close()
+	// wait for the subscription to be confirmed, so a bad connection fails
+	// here rather than silently delivering nothing
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to %s: %w", channel, err)
+	}
+
+	tracer := otel.Tracer("events")
+	messages := sub.Channel()
+	for {
+		var msg *redis.Message
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg = <-messages:
+		}
+
+		var e Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			slog.ErrorContext(ctx, "decode event", "channel", channel, "error", err)
+			continue
+		}
+		process(e.extract(ctx), tracer, channel, e, handle)
+	}
+}
+
+func process(ctx context.Context, tracer trace.Tracer, channel string, e Event, handle func(context.Context, Event) error) {
+	ctx, span := span.Consumer(ctx, tracer, span.Messaging{System: "redis", Destination: channel},
+		trace.WithAttributes(e.attrs()...),
+	)
+	defer span.End()
+
+	if err := handle(ctx, e); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "handle event", "type", e.Type, "order_id", e.OrderID, "error", err)
+	}
+}
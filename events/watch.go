@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// watchBuffer is how many events wait for a slow watcher before the
+// following ones are dropped for it
+const watchBuffer = 16
+
+// RedisWatcher delivers the events published to a redis pub/sub channel to
+// the clients watching the orders they are about. Every watch shares a single
+// subscription, and events about orders nobody watches are skipped without
+// a span.
+type RedisWatcher struct {
+	client  redis.UniversalClient
+	channel string
+
+	mu      sync.Mutex
+	watches map[string]map[chan Event]struct{}
+}
+
+// NewRedisWatcher creates a watcher of the events published to channel,
+// which delivers them once Run is called
+func NewRedisWatcher(client redis.UniversalClient, channel string) *RedisWatcher {
+	return &RedisWatcher{
+		client:  client,
+		channel: channel,
+		watches: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// Run delivers the events published to the channel until ctx is done
+func (w *RedisWatcher) Run(ctx context.Context) error {
+	sub := w.client.Subscribe(ctx, w.channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to %s: %w", w.channel, err)
+	}
+
+	messages := sub.Channel()
+	for {
+		var msg *redis.Message
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg = <-messages:
+		}
+
+		var e Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			slog.ErrorContext(ctx, "decode event", "channel", w.channel, "error", err)
+			continue
+		}
+		w.deliver(e)
+	}
+}
+
+func (w *RedisWatcher) deliver(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c := range w.watches[e.OrderID] {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// Watch returns the events about the order published from now on, until
+// stop is called. A watcher too slow to take them misses events rather than
+// holding up the others.
+func (w *RedisWatcher) Watch(orderID string) (events <-chan Event, stop func()) {
+	c := make(chan Event, watchBuffer)
+	w.mu.Lock()
+	if w.watches[orderID] == nil {
+		w.watches[orderID] = make(map[chan Event]struct{})
+	}
+	w.watches[orderID][c] = struct{}{}
+	w.mu.Unlock()
+
+	return c, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.watches[orderID], c)
+		if len(w.watches[orderID]) == 0 {
+			delete(w.watches, orderID)
+		}
+	}
+}
+
+// Close closes the redis connection
+func (w *RedisWatcher) Close() error {
+	return w.client.Close()
+}
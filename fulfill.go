@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/jobs"
+	"github.com/observiq/tracing/middleware"
+)
+
+// fulfiller ships paid orders through the REST API, so the traces of
+// fulfillment jobs continue into the API
+type fulfiller struct {
+	baseURL    string
+	httpClient *http.Client
+	// apiKey authorizes the status changes when the API enforces RBAC
+	apiKey string
+}
+
+func newFulfiller(baseURL, apiKey string, httpClient *http.Client) *fulfiller {
+	return &fulfiller{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		apiKey:     apiKey,
+	}
+}
+
+// Fulfill moves the order of the job to shipped
+func (f *fulfiller) Fulfill(ctx context.Context, j jobs.Job) error {
+	if j.Type != jobs.FulfillOrder {
+		return fmt.Errorf("unknown job type %q", j.Type)
+	}
+	body, err := json.Marshal(map[string]db.Status{"status": db.StatusShipped})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/v1/orders/"+j.OrderID+"/status", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.apiKey != "" {
+		req.Header.Set(middleware.APIKeyHeader, f.apiKey)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ship order %s: %s: %s", j.OrderID, resp.Status, bytes.TrimSpace(data))
+	}
+	return nil
+}
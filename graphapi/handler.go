@@ -0,0 +1,122 @@
+package graphapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/observiq/tracing/customers"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the GraphQL API
+const instrumentationName = "graphapi"
+
+// maxDepth is how deeply queries may nest fields. Customers and their orders
+// refer to each other, so without a limit a single query could fan out to a
+// page of reads for every level it nests.
+const maxDepth = 6
+
+// maxBodySize is the largest request body read, in bytes
+const maxBodySize = 1 << 20
+
+// Handler serves GraphQL operations over HTTP, POSTed as a JSON body or in
+// the query string of a GET
+type Handler struct {
+	schema    *graphql.Schema
+	customers *customers.Service
+	tracer    trace.Tracer
+}
+
+// request is a GraphQL operation as sent over HTTP
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// NewHandler creates a handler serving the orders and customers of the
+// services over GraphQL
+func NewHandler(orders *orders.Service, customers *customers.Service, tracerProvider trace.TracerProvider) (*Handler, error) {
+	t := tracerProvider.Tracer(instrumentationName)
+	s, err := graphql.ParseSchema(schema, &resolver{orders: orders, customers: customers},
+		graphql.Tracer(tracer{tracer: t}),
+		// every order of a full page resolves its customer at once, so
+		// they are loaded in a single batch
+		graphql.MaxParallelism(maxBatch),
+		graphql.MaxDepth(maxDepth),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("parse graphql schema: %w", err)
+	}
+	return &Handler{schema: s, customers: customers, tracer: t}, nil
+}
+
+// ServeHTTP executes the operation of the request. As the GraphQL over HTTP
+// convention asks, the response is OK even when resolving fields fails,
+// listing the errors next to the data, but the SERVER span of the request
+// is failed when a resolver is at fault.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, sp := span.Handler(r, h.tracer, r.URL.Path)
+	defer sp.End()
+
+	req, err := decodeRequest(w, r)
+	if err != nil {
+		span.RecordHTTPError(sp, http.StatusBadRequest, err)
+		writeJSON(w, http.StatusBadRequest, &graphql.Response{
+			Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("%s", err)},
+		})
+		return
+	}
+	if req.OperationName != "" {
+		sp.SetAttributes(attribute.String("graphql.operation.name", req.OperationName))
+	}
+
+	ctx = withLoader(ctx, newCustomerLoader(h.customers, h.tracer))
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	for _, err := range resp.Errors {
+		if serverError(err) {
+			sp.SetStatus(codes.Error, err.Message)
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp *graphql.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// the status is sent, so a failing write only means the client left
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+var errNoQuery = errors.New("the request has no query")
+
+// decodeRequest reads the operation from the query string of a GET, or the
+// JSON body of a POST
+func decodeRequest(w http.ResponseWriter, r *http.Request) (request, error) {
+	var req request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Query == "" {
+		return req, errNoQuery
+	}
+	return req, nil
+}
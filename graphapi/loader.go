@@ -0,0 +1,131 @@
+package graphapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/customers"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/orders"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchWait is how long a loader collects the customers asked for before
+// fetching them. The resolvers of the orders of a list run concurrently, so
+// they all ask within it.
+const batchWait = 2 * time.Millisecond
+
+// maxBatch is the most customers fetched in one batch, a page of orders
+const maxBatch = orders.MaxPageSize
+
+// customerLoader fetches the customers asked for by the resolvers of a
+// request in batches, and each customer at most once. Each batch is traced
+// as a span linked to the span of every field it loads a customer for, as
+// it serves many of them but can only be the child of one.
+type customerLoader struct {
+	customers *customers.Service
+	tracer    trace.Tracer
+
+	mu    sync.Mutex
+	loads map[string]*customerLoad
+	// batch collects the customers asked for until it is dispatched, or
+	// is nil when none are waiting
+	batch *customerBatch
+}
+
+// customerLoad is the load of one customer, whose result is set once done
+// is closed
+type customerLoad struct {
+	done     chan struct{}
+	customer *db.Customer
+	err      error
+}
+
+type customerBatch struct {
+	// ctx is the context of the first field asking, which the span of the
+	// batch is a child of
+	ctx   context.Context
+	ids   []string
+	loads []*customerLoad
+	links []trace.Link
+}
+
+func newCustomerLoader(customers *customers.Service, tracer trace.Tracer) *customerLoader {
+	return &customerLoader{
+		customers: customers,
+		tracer:    tracer,
+		loads:     make(map[string]*customerLoad),
+	}
+}
+
+type loaderKey struct{}
+
+// withLoader returns a copy of ctx carrying the loader of a request
+func withLoader(ctx context.Context, l *customerLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+func loaderFrom(ctx context.Context) *customerLoader {
+	return ctx.Value(loaderKey{}).(*customerLoader)
+}
+
+// Load returns the customer with the given ID, or nil if there is none,
+// once the batch it is fetched in completes
+func (l *customerLoader) Load(ctx context.Context, id string) (*db.Customer, error) {
+	l.mu.Lock()
+	load, loaded := l.loads[id]
+	if !loaded {
+		load = &customerLoad{done: make(chan struct{})}
+		l.loads[id] = load
+		if l.batch == nil {
+			b := &customerBatch{ctx: ctx}
+			l.batch = b
+			time.AfterFunc(batchWait, func() { l.dispatch(b) })
+		}
+		l.batch.ids = append(l.batch.ids, id)
+		l.batch.loads = append(l.batch.loads, load)
+		l.batch.links = append(l.batch.links, trace.LinkFromContext(ctx))
+		if len(l.batch.ids) == maxBatch {
+			// the full batch is still dispatched when its wait is over,
+			// but customers asked for from now on go in the next
+			l.batch = nil
+		}
+	}
+	l.mu.Unlock()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("dataloader.cached", loaded))
+
+	select {
+	case <-load.done:
+		return load.customer, load.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dispatch fetches the customers of a batch in one round trip
+func (l *customerLoader) dispatch(b *customerBatch) {
+	l.mu.Lock()
+	if l.batch == b {
+		l.batch = nil
+	}
+	l.mu.Unlock()
+
+	ctx, span := l.tracer.Start(b.ctx, "dataloader customers",
+		trace.WithLinks(b.links...),
+		trace.WithAttributes(attribute.Int("dataloader.batch_size", len(b.ids))),
+	)
+	defer span.End()
+	found, err := l.customers.GetMany(ctx, b.ids)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("dataloader.found", len(found)))
+	for i, id := range b.ids {
+		b.loads[i].customer, b.loads[i].err = found[id], err
+		close(b.loads[i].done)
+	}
+}
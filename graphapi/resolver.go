@@ -0,0 +1,203 @@
+package graphapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/observiq/tracing/customers"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/orders"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// resolver resolves the fields of Query on top of the same services as the
+// REST API. Resolvers taking a context are traced, so those of fields that
+// only read what is already loaded do not take one.
+type resolver struct {
+	orders    *orders.Service
+	customers *customers.Service
+}
+
+// inputError is an error caused by the arguments of a query, the fault of
+// the client, so it does not fail the spans it is recorded on
+type inputError struct {
+	msg string
+}
+
+func (e inputError) Error() string { return e.msg }
+
+// pageArgs are the arguments of the fields listing a page
+type pageArgs struct {
+	First int32
+	After *string
+}
+
+// page returns the cursor and limit the arguments ask for
+func (a pageArgs) page() (uint64, int64, error) {
+	if a.First < 1 || a.First > orders.MaxPageSize {
+		return 0, 0, inputError{fmt.Sprintf("first must be between 1 and %d", orders.MaxPageSize)}
+	}
+	var cursor uint64
+	if a.After != nil {
+		var err error
+		if cursor, err = strconv.ParseUint(*a.After, 10, 64); err != nil {
+			return 0, 0, inputError{"invalid cursor " + strconv.Quote(*a.After)}
+		}
+	}
+	return cursor, int64(a.First), nil
+}
+
+func (r *resolver) Order(ctx context.Context, args struct{ ID graphql.ID }) (*orderResolver, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.id", string(args.ID)))
+	o, err := r.orders.Get(ctx, string(args.ID))
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &orderResolver{r: r, o: o}, nil
+}
+
+func (r *resolver) Orders(ctx context.Context, args pageArgs) (*orderPageResolver, error) {
+	cursor, limit, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	page, next, err := r.orders.List(ctx, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.orderPage(ctx, page, next), nil
+}
+
+func (r *resolver) Customer(ctx context.Context, args struct{ ID graphql.ID }) (*customerResolver, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("customer.id", string(args.ID)))
+	c, err := r.customers.Get(ctx, string(args.ID))
+	if errors.Is(err, db.ErrCustomerNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &customerResolver{r: r, c: c}, nil
+}
+
+func (r *resolver) Customers(ctx context.Context, args pageArgs) (*customerPageResolver, error) {
+	cursor, limit, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	page, next, err := r.customers.List(ctx, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("page.count", len(page)))
+
+	customers := make([]*customerResolver, len(page))
+	for i, c := range page {
+		customers[i] = &customerResolver{r: r, c: c}
+	}
+	return &customerPageResolver{customers: customers, next: next}, nil
+}
+
+func (r *resolver) orderPage(ctx context.Context, page []*db.Order, next uint64) *orderPageResolver {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("page.count", len(page)))
+	orders := make([]*orderResolver, len(page))
+	for i, o := range page {
+		orders[i] = &orderResolver{r: r, o: o}
+	}
+	return &orderPageResolver{orders: orders, next: next}
+}
+
+// nextCursor returns the cursor of the next page, or nil after the last
+func nextCursor(next uint64) *string {
+	if next == 0 {
+		return nil
+	}
+	s := strconv.FormatUint(next, 10)
+	return &s
+}
+
+type orderPageResolver struct {
+	orders []*orderResolver
+	next   uint64
+}
+
+func (p *orderPageResolver) Orders() []*orderResolver { return p.orders }
+func (p *orderPageResolver) NextCursor() *string      { return nextCursor(p.next) }
+
+type customerPageResolver struct {
+	customers []*customerResolver
+	next      uint64
+}
+
+func (p *customerPageResolver) Customers() []*customerResolver { return p.customers }
+func (p *customerPageResolver) NextCursor() *string            { return nextCursor(p.next) }
+
+type orderResolver struct {
+	r *resolver
+	o *db.Order
+}
+
+func (o *orderResolver) ID() graphql.ID          { return graphql.ID(o.o.ID) }
+func (o *orderResolver) CustomerID() string      { return o.o.Customer }
+func (o *orderResolver) Currency() string        { return o.o.Currency }
+func (o *orderResolver) Status() string          { return string(o.o.Status) }
+func (o *orderResolver) Total() float64          { return o.o.Total }
+func (o *orderResolver) CreatedAt() graphql.Time { return graphql.Time{Time: o.o.CreatedAt} }
+func (o *orderResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: o.o.UpdatedAt} }
+func (o *orderResolver) Items() []*itemResolver {
+	items := make([]*itemResolver, len(o.o.Items))
+	for i := range o.o.Items {
+		items[i] = &itemResolver{item: o.o.Items[i]}
+	}
+	return items
+}
+
+// Customer loads the customer of the order through the loader of the
+// request, so the customers of every order resolved together are fetched
+// in one batch
+func (o *orderResolver) Customer(ctx context.Context) (*customerResolver, error) {
+	c, err := loaderFrom(ctx).Load(ctx, o.o.Customer)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return &customerResolver{r: o.r, c: c}, nil
+}
+
+type itemResolver struct {
+	item db.Item
+}
+
+func (i *itemResolver) SKU() string     { return i.item.SKU }
+func (i *itemResolver) Quantity() int32 { return int32(i.item.Quantity) }
+func (i *itemResolver) Price() float64  { return i.item.Price }
+
+type customerResolver struct {
+	r *resolver
+	c *db.Customer
+}
+
+func (c *customerResolver) ID() graphql.ID          { return graphql.ID(c.c.ID) }
+func (c *customerResolver) Name() string            { return c.c.Name }
+func (c *customerResolver) Email() string           { return c.c.Email }
+func (c *customerResolver) CreatedAt() graphql.Time { return graphql.Time{Time: c.c.CreatedAt} }
+func (c *customerResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: c.c.UpdatedAt} }
+
+func (c *customerResolver) Orders(ctx context.Context, args pageArgs) (*orderPageResolver, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("customer.id", c.c.ID))
+	cursor, limit, err := args.page()
+	if err != nil {
+		return nil, err
+	}
+	page, next, err := c.r.orders.Search(ctx, db.Query{Customer: c.c.ID}, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return c.r.orderPage(ctx, page, next), nil
+}
@@ -0,0 +1,96 @@
+// Package graphapi serves the orders and customers over GraphQL. Every
+// operation is traced with a span for each field whose resolver does work,
+// and the customers of the orders a request returns are fetched in batches
+// rather than one round trip per order.
+package graphapi
+
+import (
+	"fmt"
+
+	"github.com/observiq/tracing/orders"
+)
+
+// Routes are the REST routes whose data the schema serves, keyed like
+// auth.route_scopes, so the scopes configured for them can be required of
+// GraphQL requests as well
+var Routes = []string{
+	"GET /v1/orders",
+	"GET /v1/orders/:id",
+	"GET /v1/customers",
+	"GET /v1/customers/:id",
+	"GET /v1/customers/:id/orders",
+}
+
+// schema is the GraphQL schema served. It is read only; orders and
+// customers are changed through the REST and gRPC APIs.
+var schema = fmt.Sprintf(`
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	# order returns the order with the given ID, or null if there is none
+	order(id: ID!): Order
+	# orders lists the orders a page at a time, resuming after the
+	# nextCursor of the previous page
+	orders(first: Int = %[1]d, after: String): OrderPage!
+	# customer returns the customer with the given ID, or null if there is
+	# none
+	customer(id: ID!): Customer
+	# customers lists the customers a page at a time, resuming after the
+	# nextCursor of the previous page
+	customers(first: Int = %[1]d, after: String): CustomerPage!
+}
+
+type OrderPage {
+	orders: [Order!]!
+	# nextCursor is null once every order has been listed
+	nextCursor: String
+}
+
+type CustomerPage {
+	customers: [Customer!]!
+	# nextCursor is null once every customer has been listed
+	nextCursor: String
+}
+
+enum OrderStatus {
+	created
+	paid
+	shipped
+	delivered
+	cancelled
+}
+
+type Order {
+	id: ID!
+	customerId: String!
+	# customer is null when the customer field of the order is no known
+	# customer ID
+	customer: Customer
+	currency: String!
+	status: OrderStatus!
+	total: Float!
+	items: [Item!]!
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+type Item {
+	sku: String!
+	quantity: Int!
+	price: Float!
+}
+
+type Customer {
+	id: ID!
+	name: String!
+	email: String!
+	createdAt: Time!
+	updatedAt: Time!
+	# orders lists the orders placed by the customer
+	orders(first: Int = %[1]d, after: String): OrderPage!
+}
+`, orders.DefaultPageSize)
@@ -0,0 +1,104 @@
+package graphapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces the execution of GraphQL operations: a span for the
+// operation, with a child for each field whose resolver takes a context or
+// returns an error. Fields only reading what their parent loaded are
+// resolved in no time, so they are left out rather than flood the trace.
+// Field spans nest like the fields of the query, down to the fields of
+// lists resolved concurrently, such as the customer of each order.
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// TraceValidation records the errors of a query failing validation on the
+// SERVER span of its request. It is a fault of the client, so the span is
+// not failed.
+func (t tracer) TraceValidation(ctx context.Context) func([]*gqlerrors.QueryError) {
+	return func(errs []*gqlerrors.QueryError) {
+		span := trace.SpanFromContext(ctx)
+		for _, err := range errs {
+			span.AddEvent("validation failed", trace.WithAttributes(
+				attribute.String("graphql.error.message", err.Message),
+			))
+		}
+	}
+}
+
+// TraceQuery starts the span of an operation. Its variables are left out,
+// as they may carry personal data.
+func (t tracer) TraceQuery(ctx context.Context, queryString, operationName string, _ map[string]interface{}, _ map[string]*introspection.Type) (context.Context, func([]*gqlerrors.QueryError)) {
+	name := "graphql"
+	if operationName != "" {
+		name += " " + operationName
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("graphql.operation.name", operationName),
+		attribute.String("graphql.document", queryString),
+	))
+	return ctx, func(errs []*gqlerrors.QueryError) {
+		for _, err := range errs {
+			recordError(span, err)
+		}
+		span.SetAttributes(attribute.Int("graphql.errors", len(errs)))
+		span.End()
+	}
+}
+
+// TraceField starts the span of a field resolved by a resolver that does
+// work, named after the type and field, such as resolve Order.customer. The
+// arguments arrive with the variables already filled in, so only their
+// names are recorded.
+func (t tracer) TraceField(ctx context.Context, _, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, func(*gqlerrors.QueryError)) {
+	if trivial {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("graphql.field.parent_type", typeName),
+		attribute.String("graphql.field.name", fieldName),
+	}
+	if len(args) > 0 {
+		names := make([]string, 0, len(args))
+		for name := range args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		attrs = append(attrs, attribute.StringSlice("graphql.field.arguments", names))
+	}
+	ctx, span := t.tracer.Start(ctx, "resolve "+typeName+"."+fieldName, trace.WithAttributes(attrs...))
+	return ctx, func(err *gqlerrors.QueryError) {
+		if err != nil {
+			recordError(span, err)
+		}
+		span.End()
+	}
+}
+
+// recordError records err on span, failing it unless the query is at fault
+func recordError(span trace.Span, err *gqlerrors.QueryError) {
+	span.RecordError(err)
+	if serverError(err) {
+		span.SetStatus(codes.Error, err.Message)
+	}
+}
+
+// serverError reports whether err is the fault of the server, a resolver
+// failing other than for the arguments it was given
+func serverError(err *gqlerrors.QueryError) bool {
+	if err.ResolverError == nil {
+		return false
+	}
+	var input inputError
+	return !errors.As(err.ResolverError, &input)
+}
@@ -0,0 +1,194 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/observiq/tracing/auth"
+	ordersv1 "github.com/observiq/tracing/proto/orders/v1"
+	"github.com/observiq/tracing/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyMetadata carries the API key of a call, as the X-Api-Key header
+// does for REST requests
+const apiKeyMetadata = "x-api-key"
+
+// routes maps the methods to the REST routes they mirror, so the scopes
+// configured for a route apply to its method as well
+var routes = map[string]string{
+	ordersv1.OrderService_GetOrder_FullMethodName:    "GET /v1/orders/:id",
+	ordersv1.OrderService_CreateOrder_FullMethodName: "POST /v1/orders",
+	ordersv1.OrderService_ListOrders_FullMethodName:  "GET /v1/orders",
+}
+
+// permissions are those the methods need when RBAC is enabled
+var permissions = map[string]string{
+	ordersv1.OrderService_CreateOrder_FullMethodName: auth.PermOrdersWrite,
+}
+
+// Access controls calls as the REST API controls requests. Every field is
+// optional.
+type Access struct {
+	// RateLimiter limits the calls of each client
+	RateLimiter *ratelimit.Limiter
+	// Verifier requires a bearer token in the authorization metadata
+	Verifier *auth.Verifier
+	// RouteScopes lists the scopes a token needs, keyed by the REST route a
+	// method mirrors, e.g. "POST /v1/orders"
+	RouteScopes map[string][]string
+	// RBAC requires the permission of mutating methods from the roles of
+	// the client
+	RBAC    bool
+	Roles   auth.Policy
+	APIKeys auth.APIKeys
+	Logger  *slog.Logger
+}
+
+// interceptor rate limits, authenticates, and authorizes calls in that
+// order, the order of the REST middleware. It must run after the tracing
+// interceptor.
+func (a Access) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if a.RateLimiter != nil {
+			if err := a.limit(ctx, md); err != nil {
+				return nil, err
+			}
+		}
+		if a.Verifier != nil {
+			var err error
+			if ctx, err = a.authenticate(ctx, md, info.FullMethod); err != nil {
+				return nil, err
+			}
+		}
+		if permission, ok := permissions[info.FullMethod]; ok && a.RBAC {
+			if err := a.authorize(ctx, md, permission); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// limit takes a token from the bucket of the client, by API key when it is
+// known or else by peer address. Calls are let through when redis fails.
+func (a Access) limit(ctx context.Context, md metadata.MD) error {
+	span := trace.SpanFromContext(ctx)
+	client := "ip:" + peerIP(ctx)
+	if key := first(md, apiKeyMetadata); key != "" {
+		if _, ok := a.APIKeys.Lookup(key); ok {
+			client = "key:" + auth.HashAPIKey(key)
+		}
+	}
+	res, err := a.RateLimiter.Take(ctx, client)
+	if err != nil {
+		span.RecordError(err)
+		if a.Logger != nil {
+			a.Logger.ErrorContext(ctx, "rate limit", "error", err)
+		}
+		return nil
+	}
+	span.SetAttributes(
+		attribute.Bool("ratelimit.throttled", !res.Allowed),
+		attribute.Int("ratelimit.remaining", res.Remaining),
+	)
+	if res.Allowed {
+		return nil
+	}
+	retryAfter := ratelimit.RetryAfterSeconds(res.RetryAfter)
+	span.SetAttributes(attribute.Int("ratelimit.retry_after_s", retryAfter))
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfter)))
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded, retry later")
+}
+
+// authenticate verifies the bearer token of the call and checks the scopes
+// of its method, returning ctx with the claims
+func (a Access) authenticate(ctx context.Context, md metadata.MD, method string) (context.Context, error) {
+	span := trace.SpanFromContext(ctx)
+	scheme, token, ok := strings.Cut(first(md, "authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "a bearer token is required")
+	}
+	claims, err := a.Verifier.Verify(token)
+	if err != nil {
+		span.RecordError(err)
+		return nil, status.Error(codes.Unauthenticated, "the bearer token is invalid")
+	}
+	span.SetAttributes(
+		semconv.EnduserIDKey.String(claims.Subject),
+		semconv.EnduserScopeKey.String(claims.Scope),
+	)
+	if claims.TenantID != "" {
+		span.SetAttributes(attribute.String("tenant.id", claims.TenantID))
+	}
+	for _, scope := range a.RouteScopes[routes[method]] {
+		if !claims.HasScope(scope) {
+			span.RecordError(errors.New("missing scope " + scope))
+			return nil, status.Error(codes.PermissionDenied, "the bearer token lacks the "+scope+" scope")
+		}
+	}
+	return auth.WithClaims(ctx, claims), nil
+}
+
+// authorize checks that the roles of the client, from its token or else its
+// API key, are granted permission
+func (a Access) authorize(ctx context.Context, md metadata.MD, permission string) error {
+	var subject, source string
+	var roles []string
+	if claims := auth.ClaimsFromContext(ctx); claims != nil {
+		subject, source, roles = claims.Subject, "token", claims.Roles
+	} else if client, ok := a.APIKeys.Lookup(first(md, apiKeyMetadata)); ok {
+		subject, source, roles = client.Subject, "api_key", client.Roles
+	}
+
+	allowed := a.Roles.Allows(roles, permission)
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	trace.SpanFromContext(ctx).AddEvent("authorization", trace.WithAttributes(
+		attribute.String("authz.permission", permission),
+		attribute.String("authz.decision", decision),
+		attribute.String("authz.source", source),
+		attribute.StringSlice("authz.roles", roles),
+		semconv.EnduserIDKey.String(subject),
+	))
+	if !allowed {
+		return status.Error(codes.PermissionDenied, "the "+permission+" permission is required")
+	}
+	return nil
+}
+
+// first returns the first value of key in md
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerIP returns the IP address of the caller
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
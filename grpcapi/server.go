@@ -0,0 +1,173 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/orders"
+	"github.com/observiq/tracing/payments"
+	ordersv1 "github.com/observiq/tracing/proto/orders/v1"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// server implements the OrderService on top of the same orders.Service as
+// the REST API
+type server struct {
+	ordersv1.UnimplementedOrderServiceServer
+	orders *orders.Service
+}
+
+// NewServer creates a gRPC server exposing the OrderService. Every call is
+// traced as a server span continuing the caller's trace, then goes through
+// the same rate limiting, authentication, and authorization as the REST
+// API, as configured by access.
+func NewServer(svc *orders.Service, tracerProvider trace.TracerProvider, access Access) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(otelgrpc.WithTracerProvider(tracerProvider)),
+			access.interceptor(),
+		),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(otelgrpc.WithTracerProvider(tracerProvider))),
+	)
+	ordersv1.RegisterOrderServiceServer(s, &server{orders: svc})
+	return s
+}
+
+func (s *server) GetOrder(ctx context.Context, req *ordersv1.GetOrderRequest) (*ordersv1.GetOrderResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is empty")
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.id", req.GetId()))
+
+	order, err := s.orders.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, statusForError(err)
+	}
+	return &ordersv1.GetOrderResponse{Order: toProto(order)}, nil
+}
+
+func (s *server) CreateOrder(ctx context.Context, req *ordersv1.CreateOrderRequest) (*ordersv1.CreateOrderResponse, error) {
+	r := orders.Request{
+		Customer: req.GetCustomer(),
+		Currency: req.GetCurrency(),
+	}
+	for _, item := range req.GetItems() {
+		r.Items = append(r.Items, orders.ItemRequest{
+			SKU:      item.GetSku(),
+			Quantity: int(item.GetQuantity()),
+			Price:    item.GetPrice(),
+		})
+	}
+	if err := validation.Struct(r); err != nil {
+		return nil, invalidArgument(err)
+	}
+
+	order, err := s.orders.Create(ctx, r)
+	if err != nil {
+		return nil, statusForError(err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.id", order.ID))
+	return &ordersv1.CreateOrderResponse{Order: toProto(order)}, nil
+}
+
+func (s *server) ListOrders(ctx context.Context, req *ordersv1.ListOrdersRequest) (*ordersv1.ListOrdersResponse, error) {
+	var cursor uint64
+	if req.GetCursor() != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(req.GetCursor(), 10, 64); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+	}
+	limit := int64(req.GetLimit())
+	if limit == 0 {
+		limit = orders.DefaultPageSize
+	}
+	if limit < 1 || limit > orders.MaxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", orders.MaxPageSize)
+	}
+
+	page, next, err := s.orders.List(ctx, cursor, limit)
+	if err != nil {
+		return nil, statusForError(err)
+	}
+	res := &ordersv1.ListOrdersResponse{Orders: make([]*ordersv1.Order, 0, len(page))}
+	for _, order := range page {
+		res.Orders = append(res.Orders, toProto(order))
+	}
+	if next != 0 {
+		res.NextCursor = strconv.FormatUint(next, 10)
+	}
+	return res, nil
+}
+
+func toProto(o *db.Order) *ordersv1.Order {
+	items := make([]*ordersv1.Item, 0, len(o.Items))
+	for _, item := range o.Items {
+		items = append(items, &ordersv1.Item{
+			Sku:      item.SKU,
+			Quantity: int32(item.Quantity),
+			Price:    item.Price,
+		})
+	}
+	return &ordersv1.Order{
+		Id:        o.ID,
+		Customer:  o.Customer,
+		Currency:  o.Currency,
+		Items:     items,
+		Total:     o.Total,
+		Status:    string(o.Status),
+		CreatedAt: timestamppb.New(o.CreatedAt),
+		UpdatedAt: timestamppb.New(o.UpdatedAt),
+	}
+}
+
+// invalidArgument converts a validation error into an InvalidArgument status
+// carrying a BadRequest detail per invalid field
+func invalidArgument(err error) error {
+	st := status.New(codes.InvalidArgument, "invalid request")
+	br := &errdetails.BadRequest{}
+	for _, f := range validation.FieldErrors(err) {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Description: f.Message,
+		})
+	}
+	if withDetails, err := st.WithDetails(br); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// statusForError maps errors returned by the orders service to gRPC statuses
+func statusForError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, db.ErrConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, db.ErrOrderExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, db.ErrInvalidTransition), errors.Is(err, db.ErrOutOfStock), errors.Is(err, inventory.ErrUnavailable),
+		errors.Is(err, payments.ErrDeclined):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, db.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, orders.ErrDownstream):
+		return status.Error(codes.Unavailable, "downstream service failed")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
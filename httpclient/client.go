@@ -0,0 +1,21 @@
+package httpclient
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// New creates an HTTP client whose requests are traced as client spans and
+// carry the trace context of the request's context to the server
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return "HTTP " + r.Method + " " + r.URL.Path
+			}),
+		),
+	}
+}
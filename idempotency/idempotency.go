@@ -0,0 +1,110 @@
+// Package idempotency remembers the responses to requests carrying an
+// Idempotency-Key header, so a client retrying a request gets the original
+// response rather than repeating its effects.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces idempotency records apart from the orders
+const keyPrefix = "idempotency:"
+
+// Record is what is remembered of a request. Status is 0 while the request
+// is in progress.
+type Record struct {
+	// Fingerprint identifies the request the key was first used with, so the
+	// key cannot be reused for a different request
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Store keeps the records of idempotency keys
+type Store interface {
+	// Reserve claims key for the request with fingerprint for lockTTL. When
+	// the key is already claimed it returns its record instead.
+	Reserve(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, error)
+	// Save stores the response to the request that claimed key for ttl
+	Save(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release frees key without storing a response, so the request can be
+	// retried
+	Release(ctx context.Context, key string) error
+}
+
+// RedisStore keeps records in redis as JSON strings expiring with their TTL
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a store keeping records with client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Reserve claims key with SET NX, reading the record of whoever claimed it
+// first when that fails
+func (s *RedisStore) Reserve(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, error) {
+	data, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, fmt.Errorf("encode record: %w", err)
+	}
+	// the record may expire between a failed SET NX and the GET, in which
+	// case claiming it again succeeds
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := s.client.SetNX(ctx, keyPrefix+key, data, lockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("reserve idempotency key: %w", err)
+		}
+		if ok {
+			return nil, nil
+		}
+		existing, err := s.client.Get(ctx, keyPrefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get idempotency record: %w", err)
+		}
+		var rec Record
+		if err := json.Unmarshal(existing, &rec); err != nil {
+			return nil, fmt.Errorf("decode idempotency record: %w", err)
+		}
+		return &rec, nil
+	}
+	return nil, errors.New("reserve idempotency key: key keeps expiring")
+}
+
+// Save replaces the reservation of key with the response
+func (s *RedisStore) Save(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode record: %w", err)
+	}
+	if err := s.client.Set(ctx, keyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("save idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Release deletes the reservation of key
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, keyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Close closes the redis connection
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
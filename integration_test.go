@@ -0,0 +1,287 @@
+//go:build integration
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/app"
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/telemetry"
+	"github.com/observiq/tracing/validation"
+)
+
+// Run with a docker daemon available:
+//
+//	go test -tags=integration -run Integration -v .
+//
+// The containers are driven with the docker CLI. The test is skipped when
+// the CLI is missing or cannot reach a daemon, so the tag is safe to set
+// anywhere.
+
+const (
+	redisImage     = "redis:7"
+	collectorImage = "otel/opentelemetry-collector-contrib:0.75.0"
+)
+
+// collectorConfig receives spans over OTLP gRPC and writes them as OTLP
+// JSON, one export per line, to a file the test reads
+const collectorConfig = `
+receivers:
+  otlp:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:4317
+exporters:
+  file:
+    path: /out/spans.json
+service:
+  pipelines:
+    traces:
+      receivers: [otlp]
+      exporters: [file]
+`
+
+func TestIntegrationSpansReachCollector(t *testing.T) {
+	requireDocker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	redisAddr := startContainer(ctx, t, redisImage, "6379/tcp", nil)
+
+	dir := t.TempDir()
+	// the collector runs as another user, which must be able to write its
+	// output next to its config
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(collectorConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	collectorAddr := startContainer(ctx, t, collectorImage, "4317/tcp",
+		[]string{"-v", dir + ":/out"}, "--config=/out/config.yaml")
+
+	cfg := config.Default()
+	cfg.Redis.Addr = redisAddr
+	cfg.Server.GRPCAddr = ""
+	cfg.Server.AdminAddr = ""
+	cfg.Telemetry.ServiceName = "integration"
+	cfg.Telemetry.Endpoint = collectorAddr
+	cfg.Telemetry.MetricsExporter = telemetry.ExporterNone
+	cfg.Telemetry.LogsExporter = telemetry.ExporterNone
+	cfg.Telemetry.ResourceDetectors = "none"
+	cfg.Telemetry.BatchScheduleDelay = 100 * time.Millisecond
+
+	providers, err := setupTelemetry(ctx, cfg.Telemetry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderStore, customerStore, _, err := newStore(ctx, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validation.Register(); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := app.New(cfg, app.Deps{
+		Store:          orderStore,
+		Customers:      customerStore,
+		TracerProvider: providers.tracer,
+		MeterProvider:  providers.meter,
+		Logger:         providers.logs.Logger(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(srv.Handler())
+	defer api.Close()
+	defer orderStore.Close()
+
+	body := `{"customer": "customer-1", "currency": "USD", "items": [{"sku": "ABC-1234", "quantity": 1, "price": 5}]}`
+	res, err := http.Post(api.URL+"/v1/orders", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create order: status %d, want %d", res.StatusCode, http.StatusCreated)
+	}
+	if err := providers.tracer.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the collector writes the spans it received asynchronously
+	var spans []collectedSpan
+	for ctx.Err() == nil {
+		spans = readSpans(t, filepath.Join(dir, "spans.json"))
+		if hasSpan(spans, "/v1/orders") {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	var server *collectedSpan
+	for i, s := range spans {
+		if s.Name == "/v1/orders" {
+			server = &spans[i]
+		}
+	}
+	if server == nil {
+		t.Fatalf("the collector received no span of the order creation, got %v", spans)
+	}
+	if server.Service != "integration" {
+		t.Errorf("server span service.name %q, want integration", server.Service)
+	}
+	var redis int
+	for _, s := range spans {
+		if s.TraceID == server.TraceID && s.Name != server.Name {
+			redis++
+		}
+	}
+	if redis == 0 {
+		t.Error("the collector received no redis spans in the trace of the order creation")
+	}
+}
+
+// requireDocker skips the test unless the docker CLI is on the PATH and
+// reaches a daemon
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not on the PATH")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := exec.CommandContext(ctx, "docker", "info").Run(); err != nil {
+		t.Skipf("docker cannot reach a daemon: %v", err)
+	}
+}
+
+// startContainer runs image detached with the docker run options opts and
+// the command arguments args, publishing port, and returns the local address
+// port is published on once it accepts connections. The container is removed
+// when the test ends.
+func startContainer(ctx context.Context, t *testing.T, image, port string, opts []string, args ...string) string {
+	t.Helper()
+	run := []string{"run", "-d", "--rm", "-p", "127.0.0.1::" + strings.TrimSuffix(port, "/tcp")}
+	run = append(run, opts...)
+	run = append(run, image)
+	run = append(run, args...)
+	out, err := exec.CommandContext(ctx, "docker", run...).Output()
+	if err != nil {
+		t.Fatalf("start %s: %v", image, commandError(err))
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	out, err = exec.CommandContext(ctx, "docker", "port", id, port).Output()
+	if err != nil {
+		t.Fatalf("find the port of %s: %v", image, commandError(err))
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return addr
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s never accepted connections on %s: %v", image, addr, err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// commandError adds the standard error of a failed command to its error
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("%w: %s", err, exitErr.Stderr)
+	}
+	return err
+}
+
+// collectedSpan is a span the collector wrote to its file
+type collectedSpan struct {
+	Service string
+	TraceID string
+	Name    string
+}
+
+func hasSpan(spans []collectedSpan, name string) bool {
+	for _, s := range spans {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readSpans reads the spans written by the collector's file exporter, a
+// line of OTLP JSON per export. A missing file has no spans yet.
+func readSpans(t *testing.T, path string) []collectedSpan {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []collectedSpan
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var export struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []struct {
+						Key   string `json:"key"`
+						Value struct {
+							StringValue string `json:"stringValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []struct {
+						TraceID string `json:"traceId"`
+						Name    string `json:"name"`
+					} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &export); err != nil {
+			// the line being written
+			continue
+		}
+		for _, rs := range export.ResourceSpans {
+			var service string
+			for _, attr := range rs.Resource.Attributes {
+				if attr.Key == "service.name" {
+					service = attr.Value.StringValue
+				}
+			}
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans = append(spans, collectedSpan{Service: service, TraceID: s.TraceID, Name: s.Name})
+				}
+			}
+		}
+	}
+	return spans
+}
@@ -0,0 +1,79 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnavailable is returned when the inventory cannot cover an order
+var ErrUnavailable = errors.New("items out of stock")
+
+// Item is a quantity of a SKU to check stock for
+type Item struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+// CheckRequest is the body of a stock check
+type CheckRequest struct {
+	Items []Item `json:"items"`
+}
+
+// CheckResponse is the result of a stock check. Unavailable lists the SKUs
+// that do not have enough stock.
+type CheckResponse struct {
+	Available   bool     `json:"available"`
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// Client calls the inventory service
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the inventory service at baseURL. The HTTP
+// client should propagate trace context, see httpclient.New.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Check verifies that every item is in stock. It returns an error wrapping
+// ErrUnavailable naming the SKUs that are not.
+func (c *Client) Check(ctx context.Context, items []Item) error {
+	body, err := json.Marshal(CheckRequest{Items: items})
+	if err != nil {
+		return fmt.Errorf("encode stock check: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/stock/check", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create stock check: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("check stock: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("check stock: unexpected status %s", resp.Status)
+	}
+
+	var res CheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("decode stock check: %w", err)
+	}
+	if !res.Available {
+		return fmt.Errorf("%w: %s", ErrUnavailable, strings.Join(res.Unavailable, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the inventory service
+const instrumentationName = "inventoryAPI"
+
+// stockRequest is the body accepted when setting the stock of a SKU
+type stockRequest struct {
+	Quantity int `json:"quantity" binding:"gte=0"`
+}
+
+type handler struct {
+	store  *Store
+	tracer trace.Tracer
+}
+
+// NewHandler creates the HTTP API of the inventory service
+func NewHandler(store *Store, tracerProvider trace.TracerProvider) http.Handler {
+	h := &handler{
+		store:  store,
+		tracer: tracerProvider.Tracer(instrumentationName),
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	v1 := r.Group("/v1")
+	v1.Use(otelgin.Middleware(instrumentationName, otelgin.WithTracerProvider(tracerProvider)))
+	v1.POST("/stock/check", h.check)
+	v1.GET("/stock/:sku", h.getStock)
+	v1.PUT("/stock/:sku", h.setStock)
+	return r
+}
+
+func (h *handler) check(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, h.tracer, c.FullPath())
+	defer span.End()
+
+	var req CheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, span, http.StatusBadRequest, err)
+		return
+	}
+
+	unavailable, err := h.store.Unavailable(ctx, req.Items)
+	if err != nil {
+		abort(c, span, http.StatusInternalServerError, err)
+		return
+	}
+	span.SetAttributes(attribute.Bool("stock.available", len(unavailable) == 0))
+
+	c.JSON(http.StatusOK, CheckResponse{
+		Available:   len(unavailable) == 0,
+		Unavailable: unavailable,
+	})
+}
+
+func (h *handler) getStock(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, h.tracer, c.FullPath())
+	defer span.End()
+
+	sku := c.Param("sku")
+	span.SetAttributes(attribute.String("sku", sku))
+
+	n, err := h.store.Stock(ctx, sku)
+	if errors.Is(err, ErrUnknownSKU) {
+		abort(c, span, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		abort(c, span, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sku":      sku,
+		"quantity": n,
+	})
+}
+
+func (h *handler) setStock(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, h.tracer, c.FullPath())
+	defer span.End()
+
+	sku := c.Param("sku")
+	span.SetAttributes(attribute.String("sku", sku))
+
+	var req stockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, span, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.store.SetStock(ctx, sku, req.Quantity); err != nil {
+		abort(c, span, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sku":      sku,
+		"quantity": req.Quantity,
+	})
+}
+
+// abort records the error on the span and responds with it
+func abort(c *gin.Context, s trace.Span, statusCode int, err error) {
+	span.RecordHTTPError(s, statusCode, err)
+	c.AbortWithStatusJSON(statusCode, gin.H{"error": err.Error()})
+}
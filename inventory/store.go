@@ -0,0 +1,99 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrUnknownSKU is returned when no stock has been recorded for a SKU
+var ErrUnknownSKU = errors.New("unknown sku")
+
+// stockKey is the hash of stock levels, one field per SKU. The orders API
+// reserves stock from it as orders are created.
+const stockKey = "stock"
+
+// Store keeps stock levels in a redis hash, one integer per SKU
+type Store struct {
+	redisClient *redis.Client
+	tracer      trace.Tracer
+}
+
+// NewStore creates a store and verifies connectivity using PING
+func NewStore(ctx context.Context, addr string) (*Store, error) {
+	c := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	if err := c.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+
+	return &Store{
+		redisClient: c,
+		tracer:      otel.Tracer("redis"),
+	}, nil
+}
+
+// Stock returns the quantity in stock of the SKU
+func (s *Store) Stock(ctx context.Context, sku string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "get stock", trace.WithAttributes(attribute.String("sku", sku)))
+	defer span.End()
+
+	n, err := s.redisClient.HGet(ctx, stockKey, sku).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrUnknownSKU
+	}
+	return n, err
+}
+
+// SetStock sets the quantity in stock of the SKU
+func (s *Store) SetStock(ctx context.Context, sku string, quantity int) error {
+	ctx, span := s.tracer.Start(ctx, "set stock", trace.WithAttributes(
+		attribute.String("sku", sku),
+		attribute.Int("quantity", quantity),
+	))
+	defer span.End()
+
+	return s.redisClient.HSet(ctx, stockKey, sku, quantity).Err()
+}
+
+// Unavailable returns the SKUs of the items that do not have enough stock,
+// reading every stock level in a single HMGET
+func (s *Store) Unavailable(ctx context.Context, items []Item) ([]string, error) {
+	ctx, span := s.tracer.Start(ctx, "check stock", trace.WithAttributes(attribute.Int("items", len(items))))
+	defer span.End()
+
+	if len(items) == 0 {
+		return nil, nil
+	}
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		skus = append(skus, item.SKU)
+	}
+	values, err := s.redisClient.HMGet(ctx, stockKey, skus...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var unavailable []string
+	for i, v := range values {
+		// unknown SKUs come back as nil and count as out of stock
+		data, _ := v.(string)
+		n, err := strconv.Atoi(data)
+		if err != nil || n < items[i].Quantity {
+			unavailable = append(unavailable, items[i].SKU)
+		}
+	}
+	span.SetAttributes(attribute.Int("unavailable", len(unavailable)))
+	return unavailable, nil
+}
+
+func (s *Store) Close() error {
+	return s.redisClient.Close()
+}
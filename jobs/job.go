@@ -0,0 +1,98 @@
+// Package jobs queues work on orders to be done outside of the request that
+// asked for it. By default the span processing a job starts a trace of its
+// own and links back to the span that enqueued it, so the asynchronous work
+// can be followed from the request without stretching its trace. A worker
+// may continue the trace of the request instead, see WorkerOptions.Trace.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Type names the work a job asks for
+type Type string
+
+// Job types
+const (
+	FulfillOrder Type = "order.fulfill"
+)
+
+// How the span processing a job relates to the span that enqueued it
+const (
+	// TraceLink starts a new trace linking back to the enqueuing span
+	TraceLink = "link"
+	// TraceChild continues the trace of the enqueuing span, for queues whose
+	// jobs are handled soon enough to be part of the request
+	TraceChild = "child"
+)
+
+// validTrace checks the relation to the enqueuing span
+func validTrace(trace string) error {
+	switch trace {
+	case TraceLink, TraceChild:
+		return nil
+	default:
+		return fmt.Errorf("unknown job trace %q, want %s or %s", trace, TraceLink, TraceChild)
+	}
+}
+
+// Job is a unit of work on an order
+type Job struct {
+	// ID is the ID of the stream entry the job was read from. It is only set
+	// on consumed jobs.
+	ID      string `json:"-"`
+	Type    Type   `json:"type"`
+	OrderID string `json:"order_id"`
+	// Attempt counts the times the job has been handed to a worker,
+	// starting at 1
+	Attempt    int       `json:"attempt"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// Error is why the previous attempt failed
+	Error string `json:"error,omitempty"`
+	// TraceContext holds the propagation headers of the span that first
+	// enqueued the job. Retries keep it, so every attempt links to the
+	// request.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// New returns a job of type t for the order
+func New(t Type, orderID string) Job {
+	return Job{
+		Type:       t,
+		OrderID:    orderID,
+		Attempt:    1,
+		EnqueuedAt: time.Now().UTC(),
+	}
+}
+
+// Queue hands jobs to workers
+type Queue interface {
+	Enqueue(ctx context.Context, j Job) error
+}
+
+// Handler does the work a job asks for
+type Handler func(ctx context.Context, j Job) error
+
+// inject stores the trace context of ctx in the job
+func (j *Job) inject(ctx context.Context) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	j.TraceContext = carrier
+}
+
+// extract returns ctx with the span that enqueued the job as its remote
+// parent
+func (j *Job) extract(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(j.TraceContext))
+}
+
+// link returns a link to the span that enqueued the job
+func (j *Job) link() trace.Link {
+	return trace.LinkFromContext(j.extract(context.Background()))
+}
@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/observiq/tracing/telemetry/span"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jobField is the stream entry field holding the JSON encoded job
+const jobField = "job"
+
+// DeadLetterStream returns the stream that jobs of stream are moved to once
+// they run out of attempts
+func DeadLetterStream(stream string) string {
+	return stream + ":dead"
+}
+
+// RedisQueue adds jobs to a redis stream, where they wait until a worker of
+// a consumer group reads them, see Worker
+type RedisQueue struct {
+	client redis.UniversalClient
+	stream string
+	tracer trace.Tracer
+}
+
+// NewRedisQueue creates a queue adding jobs to stream
+func NewRedisQueue(client redis.UniversalClient, stream string) *RedisQueue {
+	return &RedisQueue{
+		client: client,
+		stream: stream,
+		tracer: otel.Tracer("jobs"),
+	}
+}
+
+// Enqueue adds the job to the stream in a producer span whose trace context
+// the job carries
+func (q *RedisQueue) Enqueue(ctx context.Context, j Job) error {
+	ctx, span := span.Producer(ctx, q.tracer, messaging(q.stream),
+		trace.WithAttributes(j.attrs()...),
+	)
+	defer span.End()
+
+	j.inject(ctx)
+	id, err := add(ctx, q.client, q.stream, j)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetAttributes(semconv.MessagingMessageIDKey.String(id))
+	return nil
+}
+
+// Close closes the redis connection
+func (q *RedisQueue) Close() error {
+	return q.client.Close()
+}
+
+// WorkerOptions configures how a Worker reads jobs
+type WorkerOptions struct {
+	// Group is the consumer group the worker reads with. Workers of the same
+	// group share the jobs between them.
+	Group string
+	// Consumer names the worker within its group, and must be unique in it
+	Consumer string
+	// MaxAttempts is the number of times a job is tried before it is moved
+	// to the dead letter stream
+	MaxAttempts int
+	// ClaimAfter is how long a job may stay unacknowledged before another
+	// worker takes it over from a worker that presumably died
+	ClaimAfter time.Duration
+	// Block is how long a read waits for new jobs
+	Block time.Duration
+	// Trace is how the span processing a job relates to the span that
+	// enqueued it, TraceLink or TraceChild. It defaults to TraceLink.
+	Trace string
+}
+
+// Validate checks the options
+func (o WorkerOptions) Validate() error {
+	if o.Trace == "" {
+		return nil
+	}
+	return validTrace(o.Trace)
+}
+
+// Worker handles the jobs of a redis stream as a member of a consumer group.
+// A job is acknowledged once it is handled. A job whose handler fails is
+// added to the end of the stream again until it runs out of attempts, then
+// moved to the dead letter stream. Jobs left unacknowledged by a worker that
+// died are claimed by the others once ClaimAfter elapses.
+type Worker struct {
+	client redis.UniversalClient
+	stream string
+	opts   WorkerOptions
+	handle Handler
+	tracer trace.Tracer
+}
+
+// NewWorker creates a worker handling the jobs of stream with handle
+func NewWorker(client redis.UniversalClient, stream string, opts WorkerOptions, handle Handler) *Worker {
+	return &Worker{
+		client: client,
+		stream: stream,
+		opts:   opts,
+		handle: handle,
+		tracer: otel.Tracer("jobs"),
+	}
+}
+
+// Run handles jobs until ctx is done, creating the stream and the consumer
+// group if they do not exist yet
+func (w *Worker) Run(ctx context.Context) error {
+	err := w.client.XGroupCreateMkStream(ctx, w.stream, w.opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group %s: %w", w.opts.Group, err)
+	}
+
+	for ctx.Err() == nil {
+		if err := w.claim(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "claim stale jobs", "stream", w.stream, "error", err)
+		}
+		streams, err := w.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    w.opts.Group,
+			Consumer: w.opts.Consumer,
+			Streams:  []string{w.stream, ">"},
+			Count:    10,
+			Block:    w.opts.Block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			slog.ErrorContext(ctx, "read jobs", "stream", w.stream, "error", err)
+			sleep(ctx, w.opts.Block)
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				w.process(ctx, msg)
+			}
+		}
+	}
+	return nil
+}
+
+// claim takes over the jobs other workers left unacknowledged for longer
+// than ClaimAfter and handles them
+func (w *Worker) claim(ctx context.Context) error {
+	start := "0-0"
+	for {
+		msgs, next, err := w.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   w.stream,
+			Group:    w.opts.Group,
+			Consumer: w.opts.Consumer,
+			MinIdle:  w.opts.ClaimAfter,
+			Start:    start,
+			Count:    10,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			w.process(ctx, msg)
+		}
+		if next == "0-0" || len(msgs) == 0 {
+			return nil
+		}
+		start = next
+	}
+}
+
+// process handles a job in a consumer span linked to, or a child of, the
+// span that enqueued it, then acknowledges it, retrying or dead lettering it
+// if it failed. Entries that cannot be decoded are dead lettered right away.
+func (w *Worker) process(ctx context.Context, msg redis.XMessage) {
+	j, decodeErr := decode(msg)
+	attrs := append(j.attrs(),
+		semconv.MessagingMessageIDKey.String(msg.ID),
+		semconv.MessagingConsumerIDKey.String(w.opts.Group+" - "+w.opts.Consumer),
+		attribute.Int("job.attempt", j.Attempt),
+	)
+	parent := context.Background()
+	opts := []trace.SpanStartOption{trace.WithAttributes(attrs...)}
+	if w.opts.Trace == TraceChild {
+		parent = j.extract(parent)
+	} else {
+		// the span starts a new trace, so a job retried for minutes does not
+		// stretch the trace of the request that enqueued it
+		opts = append(opts, trace.WithLinks(j.link()))
+	}
+	spanCtx, span := span.Consumer(parent, w.tracer, messaging(w.stream), opts...)
+	defer span.End()
+
+	err := decodeErr
+	if err == nil {
+		err = w.handle(spanCtx, j)
+	}
+	if err == nil {
+		if err := w.client.XAck(ctx, w.stream, w.opts.Group, msg.ID).Err(); err != nil {
+			span.RecordError(err)
+			slog.ErrorContext(spanCtx, "acknowledge job", "id", msg.ID, "error", err)
+		}
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	j.Error = err.Error()
+	next := w.stream
+	if decodeErr != nil || j.Attempt >= w.opts.MaxAttempts {
+		next = DeadLetterStream(w.stream)
+		span.AddEvent("job dead lettered")
+		slog.ErrorContext(spanCtx, "job failed, dead lettering it", "type", j.Type, "order_id", j.OrderID, "attempt", j.Attempt, "error", err)
+	} else {
+		j.Attempt++
+		span.AddEvent("job retried", trace.WithAttributes(attribute.Int("job.next_attempt", j.Attempt)))
+		slog.WarnContext(spanCtx, "job failed, retrying it", "type", j.Type, "order_id", j.OrderID, "attempt", j.Attempt-1, "error", err)
+	}
+	if decodeErr != nil {
+		err = w.client.XAdd(ctx, &redis.XAddArgs{Stream: next, Values: msg.Values}).Err()
+	} else {
+		_, err = add(ctx, w.client, next, j)
+	}
+	if err != nil {
+		// the job stays pending, and is claimed again once ClaimAfter elapses
+		span.RecordError(err)
+		slog.ErrorContext(spanCtx, "requeue job", "id", msg.ID, "stream", next, "error", err)
+		return
+	}
+	if err := w.client.XAck(ctx, w.stream, w.opts.Group, msg.ID).Err(); err != nil {
+		span.RecordError(err)
+		slog.ErrorContext(spanCtx, "acknowledge job", "id", msg.ID, "error", err)
+	}
+}
+
+// add appends the job to stream, returning the ID of the entry
+func add(ctx context.Context, client redis.UniversalClient, stream string, j Job) (string, error) {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return "", fmt.Errorf("encode job: %w", err)
+	}
+	id, err := client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]any{jobField: data},
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("add job to %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+// decode reads the job of a stream entry
+func decode(msg redis.XMessage) (Job, error) {
+	j := Job{ID: msg.ID}
+	data, ok := msg.Values[jobField].(string)
+	if !ok {
+		return j, fmt.Errorf("entry %s has no %s field", msg.ID, jobField)
+	}
+	if err := json.Unmarshal([]byte(data), &j); err != nil {
+		return j, fmt.Errorf("decode job: %w", err)
+	}
+	j.ID = msg.ID
+	return j, nil
+}
+
+// messaging describes stream as a queue, as each job is read by a single
+// worker of the group
+func messaging(stream string) span.Messaging {
+	return span.Messaging{System: "redis", Destination: stream, Queue: true}
+}
+
+// attrs describes the job on the spans enqueuing and processing it
+func (j Job) attrs() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("job.type", string(j.Type)),
+		attribute.String("order.id", j.OrderID),
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
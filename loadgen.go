@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/observiq/tracing/loadgen"
+)
+
+// generateLoad sends requests to the orders API for a while, then prints a
+// summary of their statuses and latencies
+func generateLoad(args []string) error {
+	opts := loadgen.Options{Shape: loadgen.Shape{Pattern: loadgen.PatternConstant}}
+	var duration time.Duration
+	cfg, err := loadConfig("loadgen", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&opts.BaseURL, "url", "http://localhost:9911", "base URL of the REST API")
+		fs.StringVar(&opts.Shape.Pattern, "pattern", loadgen.PatternConstant, "how the rate changes: constant, spike, or sine")
+		fs.Float64Var(&opts.Shape.RPS, "rps", 10, "base requests per second")
+		fs.DurationVar(&opts.Shape.Period, "period", time.Minute, "length of a spike or sine cycle")
+		fs.Float64Var(&opts.Shape.Factor, "factor", 5, "multiple of rps reached by spikes and sine waves")
+		fs.DurationVar(&duration, "duration", time.Minute, "how long to run, 0 to run until interrupted")
+		fs.Float64Var(&opts.WriteRatio, "write-ratio", 0.2, "fraction of requests that create orders")
+		fs.IntVar(&opts.Workers, "workers", 50, "most requests in flight; requests beyond are dropped")
+		fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "timeout of each request")
+	})
+	if err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("invalid flags: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	providers, err := setupTelemetry(ctx, cfg.Telemetry)
+	if err != nil {
+		return fmt.Errorf("set up telemetry: %w", err)
+	}
+	defer providers.shutdown(cfg.Telemetry.ShutdownTimeout)
+
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	slog.Info("generating load", "url", opts.BaseURL, "pattern", opts.Shape.Pattern, "rps", opts.Shape.RPS, "duration", duration)
+	start := time.Now()
+	stats := loadgen.Run(ctx, opts, providers.tracer)
+	stats.Summary(os.Stdout, time.Since(start))
+	return nil
+}
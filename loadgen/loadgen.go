@@ -0,0 +1,238 @@
+// Package loadgen sends a stream of reads and writes to the orders API so
+// the example produces trace volume without external tools. The request
+// rate follows a constant, spike, or sine pattern and each request is the
+// root of its own trace.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/httpclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tick is how often the rate is recomputed and requests are scheduled
+const tick = 100 * time.Millisecond
+
+// skus are the SKUs orders are created with, those priced by cmd/pricing
+var skus = []string{"ABC-1234", "ABC-5678", "WIDGET-01", "GADGET-42"}
+
+// Options configure a run
+type Options struct {
+	// BaseURL is the base URL of the REST API
+	BaseURL string
+	Shape   Shape
+	// WriteRatio is the fraction of requests that create orders
+	WriteRatio float64
+	// Workers is the most requests in flight; requests beyond are dropped
+	Workers int
+	// Timeout is the timeout of each request
+	Timeout time.Duration
+}
+
+// Validate reports whether a run can start with the options
+func (o Options) Validate() error {
+	if err := o.Shape.Validate(); err != nil {
+		return err
+	}
+	if o.WriteRatio < 0 || o.WriteRatio > 1 {
+		return errors.New("write ratio must be between 0 and 1")
+	}
+	if o.Workers <= 0 || o.Timeout <= 0 {
+		return errors.New("workers and timeout must be positive")
+	}
+	return nil
+}
+
+// Run sends requests until ctx is done, then waits for those in flight and
+// returns the outcome of every request
+func Run(ctx context.Context, opts Options, tracerProvider trace.TracerProvider) *Stats {
+	g := &generator{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		httpClient: httpclient.New(opts.Timeout),
+		tracer:     tracerProvider.Tracer("loadgen"),
+		writeRatio: opts.WriteRatio,
+		stats:      newStats(),
+	}
+	g.run(ctx, opts.Shape, opts.Workers)
+	return g.stats
+}
+
+// generator sends the requests of a run
+type generator struct {
+	baseURL    string
+	httpClient *http.Client
+	tracer     trace.Tracer
+	writeRatio float64
+	stats      *Stats
+
+	mu sync.Mutex
+	// ids are the orders created so far, read back by reads
+	ids []string
+}
+
+// run sends requests at the rate of s until ctx is done, with at most
+// workers in flight, then waits for those in flight
+func (g *generator) run(ctx context.Context, s Shape, workers int) {
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+
+	start := time.Now()
+	// due carries the fraction of a request owed from one tick to the next
+	var due float64
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-progress.C:
+			rate := s.Rate(time.Since(start))
+			slog.Info("progress", "sent", g.stats.Total(), "rps", fmt.Sprintf("%.1f", rate))
+		case <-ticker.C:
+			due += s.Rate(time.Since(start)) * tick.Seconds()
+			for ; due >= 1; due-- {
+				select {
+				case sem <- struct{}{}:
+				default:
+					g.stats.drop()
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					// requests in flight finish even once the run is over
+					g.send(context.WithoutCancel(ctx))
+				}()
+			}
+		}
+	}
+}
+
+// send makes a read or a write as the root span of a new trace
+func (g *generator) send(ctx context.Context) {
+	op := "read"
+	if rand.Float64() < g.writeRatio {
+		op = "write"
+	}
+	ctx, span := g.tracer.Start(ctx, "loadgen "+op,
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("loadgen.op", op)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	var (
+		status int
+		err    error
+	)
+	if op == "write" {
+		status, err = g.create(ctx)
+	} else {
+		status, err = g.read(ctx)
+	}
+	g.stats.record(op, status, time.Since(start))
+
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// create creates an order with random items
+func (g *generator) create(ctx context.Context) (int, error) {
+	items := make([]map[string]any, 0, 3)
+	for n := 1 + rand.Intn(3); n > 0; n-- {
+		items = append(items, map[string]any{
+			"sku":      skus[rand.Intn(len(skus))],
+			"quantity": 1 + rand.Intn(5),
+			"price":    float64(1+rand.Intn(10000)) / 100,
+		})
+	}
+	body, err := json.Marshal(map[string]any{
+		"customer": fmt.Sprintf("loadgen-%d", rand.Intn(100)),
+		"currency": "USD",
+		"items":    items,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	status, err := g.do(ctx, http.MethodPost, "/v1/orders", body, &res)
+	if status == http.StatusCreated && res.ID != "" {
+		g.mu.Lock()
+		g.ids = append(g.ids, res.ID)
+		g.mu.Unlock()
+	}
+	return status, err
+}
+
+// read gets one of the orders created so far, or lists orders before any
+// was created
+func (g *generator) read(ctx context.Context) (int, error) {
+	g.mu.Lock()
+	var id string
+	if len(g.ids) > 0 {
+		id = g.ids[rand.Intn(len(g.ids))]
+	}
+	g.mu.Unlock()
+
+	if id == "" {
+		return g.do(ctx, http.MethodGet, "/v1/orders", nil, nil)
+	}
+	return g.do(ctx, http.MethodGet, "/v1/orders/"+id, nil, nil)
+}
+
+// do sends the request, decoding a successful JSON response into res when
+// set. It returns the status of the response, or 0 with the error when none
+// was received.
+func (g *generator) do(ctx context.Context, method, path string, body []byte, res any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if res != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+		}
+		return resp.StatusCode, nil
+	}
+	// drain the body so the connection is reused
+	_, err = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, err
+}
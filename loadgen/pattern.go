@@ -0,0 +1,61 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Load patterns
+const (
+	PatternConstant = "constant"
+	PatternSpike    = "spike"
+	PatternSine     = "sine"
+)
+
+// Shape is how the request rate changes over time
+type Shape struct {
+	// Pattern is PatternConstant, PatternSpike, or PatternSine
+	Pattern string
+	// RPS is the base rate in requests per second
+	RPS float64
+	// Period is the length of a cycle of the spike and sine patterns
+	Period time.Duration
+	// Factor multiplies RPS at the top of a spike or sine wave
+	Factor float64
+}
+
+// Validate reports whether the shape describes a rate
+func (s Shape) Validate() error {
+	switch s.Pattern {
+	case PatternConstant, PatternSpike, PatternSine:
+	default:
+		return fmt.Errorf("unknown pattern %q", s.Pattern)
+	}
+	if s.RPS <= 0 {
+		return errors.New("rps must be positive")
+	}
+	if s.Pattern != PatternConstant && (s.Period <= 0 || s.Factor < 1) {
+		return errors.New("period must be positive and factor at least 1")
+	}
+	return nil
+}
+
+// Rate returns the requests per second elapsed into the run. Spikes last
+// the last tenth of each period; sine waves swing between RPS and
+// RPS*Factor.
+func (s Shape) Rate(elapsed time.Duration) float64 {
+	switch s.Pattern {
+	case PatternSpike:
+		if elapsed%s.Period >= s.Period*9/10 {
+			return s.RPS * s.Factor
+		}
+		return s.RPS
+	case PatternSine:
+		phase := 2 * math.Pi * float64(elapsed%s.Period) / float64(s.Period)
+		return s.RPS + s.RPS*(s.Factor-1)*(1-math.Cos(phase))/2
+	default:
+		return s.RPS
+	}
+}
@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stats collects the outcome of every request of a run
+type Stats struct {
+	mu        sync.Mutex
+	sent      map[string]int
+	latencies map[string][]time.Duration
+	statuses  map[string]map[int]int
+	errors    map[string]int
+	dropped   int
+}
+
+func newStats() *Stats {
+	return &Stats{
+		sent:      map[string]int{},
+		latencies: map[string][]time.Duration{},
+		statuses:  map[string]map[int]int{},
+		errors:    map[string]int{},
+	}
+}
+
+// record adds the outcome of a request. A status of 0 means no response was
+// received.
+func (s *Stats) record(op string, status int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[op]++
+	if status == 0 {
+		s.errors[op]++
+		return
+	}
+	s.latencies[op] = append(s.latencies[op], latency)
+	if s.statuses[op] == nil {
+		s.statuses[op] = map[int]int{}
+	}
+	s.statuses[op][status]++
+}
+
+// drop counts a request skipped because every worker was busy
+func (s *Stats) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+// Total returns the number of requests sent
+func (s *Stats) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sent := range s.sent {
+		n += sent
+	}
+	return n
+}
+
+// Summary writes the counts, statuses, and latency percentiles of each
+// operation
+func (s *Stats) Summary(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := make([]string, 0, len(s.sent))
+	for op := range s.sent {
+		ops = append(ops, op)
+	}
+	slices.Sort(ops)
+
+	fmt.Fprintf(w, "ran for %s, %d requests dropped with every worker busy\n", elapsed.Round(time.Millisecond), s.dropped)
+	for _, op := range ops {
+		latencies := s.latencies[op]
+		slices.Sort(latencies)
+		sent := s.sent[op]
+		fmt.Fprintf(w, "%-6s %6d sent %8.1f/s  %d failed to connect\n", op, sent, float64(sent)/elapsed.Seconds(), s.errors[op])
+		if len(latencies) > 0 {
+			fmt.Fprintf(w, "       p50 %s  p90 %s  p99 %s  max %s\n",
+				percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99), percentile(latencies, 1))
+		}
+		codes := make([]int, 0, len(s.statuses[op]))
+		for code := range s.statuses[op] {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "       %d: %d\n", code, s.statuses[op][code])
+		}
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i].Round(100 * time.Microsecond)
+}
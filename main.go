@@ -1,164 +1,158 @@
+// Command orders runs the orders API and the tools around it. Each
+// subcommand loads the same config and sets up telemetry the same way, so
+// every process of the example is instrumented consistently.
 package main
 
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"os/signal"
-	"runtime"
-	"syscall"
+	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/observiq/tracing/db"
-	"github.com/redis/go-redis/v9"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/telemetry"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
-	oteltrace "go.opentelemetry.io/otel/trace"
-	"google.golang.org/grpc"
+	"go.opentelemetry.io/otel/metric/global"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-var tracer = otel.Tracer("ordersAPI")
+// command is a subcommand of the orders binary
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-type server struct {
-	httpServer *http.Server
-	db         *redis.Client
+var commands = []command{
+	{"serve", "run the orders API (the default)", serve},
+	{"seed", "fill the store with fake customers and orders", seedStore},
+	{"loadgen", "send a stream of requests to the orders API", generateLoad},
+	{"worker", "consume order events and fulfill paid orders", work},
 }
 
-func newServer(serverAddr, redisAddr string) (*server, error) {
-	mux := http.NewServeMux()
-	httpServer := &http.Server{
-		Addr:    serverAddr,
-		Handler: mux,
-	}
-	c := redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-	})
-	if _, err := c.Ping(context.Background()).Result(); err != nil {
-		return nil, fmt.Errorf("ping redis: %w", err)
-	}
-	return &server{
-		httpServer: httpServer,
-	}, nil
+// loadConfig loads the config of the named subcommand, registering its own
+// flags with register. The error wraps flag.ErrHelp when only the usage was
+// asked for. The subcommand reports its telemetry as a service of its own,
+// named after the API's, unless the environment names the service as
+// OTEL_SERVICE_NAME does.
+func loadConfig(name string, args []string, register func(fs *flag.FlagSet)) (config.Config, error) {
+	cfg, err := config.LoadCommand(name, args, register)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("load config: %w", err)
+	}
+	if _, ok := telemetry.ServiceNameFromEnv(); !ok {
+		cfg.Telemetry.ServiceName += "-" + name
+	}
+	return cfg, nil
 }
 
-func (s *server) start() error {
-	return s.httpServer.ListenAndServe()
+// providers are the telemetry providers set up for a subcommand
+type providers struct {
+	logs    *telemetry.LoggerProvider
+	sampler *telemetry.ReloadableSampler
+	tracer  *sdktrace.TracerProvider
+	meter   *sdkmetric.MeterProvider
 }
 
-func (s *server) stop() error {
-	if err := s.db.Close(); err != nil {
-		return errors.Join(fmt.Errorf("close redis: %w", err), s.httpServer.Close())
+// setupTelemetry creates the logger, tracer, and meter providers and the
+// propagator, makes them the defaults, and starts the process metrics
+func setupTelemetry(ctx context.Context, cfg telemetry.Config) (*providers, error) {
+	p := &providers{}
+	var err error
+	p.logs, err = telemetry.NewLoggerProvider(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create logger: %w", err)
 	}
-	return s.httpServer.Close()
-}
+	slog.SetDefault(p.logs.Logger())
 
-func initTraceProvider(ctx context.Context) (*trace.TracerProvider, error) {
-	hostname, _ := os.Hostname()
-	resources := resource.NewWithAttributes(
-		semconv.SchemaURL,
-		semconv.ServiceNameKey.String("ourservice"),
-		semconv.HostArchKey.String(runtime.GOARCH),
-		semconv.HostNameKey.String(hostname),
-	)
-	conn, err := grpc.DialContext(ctx, "localhost:4317", grpc.WithInsecure())
+	p.sampler, err = telemetry.NewReloadableSampler(cfg)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("create sampler: %w", err)
 	}
-	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure(), otlptracegrpc.WithGRPCConn(conn))
+	p.tracer, err = telemetry.NewTracerProvider(ctx, cfg, p.sampler)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("create tracer provider: %w", err)
 	}
-
-	return trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(resources),
-	), nil
-}
-
-func newRouter() (*gin.Engine, *gin.RouterGroup) {
-	r := gin.New()
-	v1 := r.Group("/v1")
-	v1.Use(otelgin.Middleware("ordersAPI"))
-	return r, v1
-}
-
-// Record an error on the span and abort the request with the given status code and error
-func handleErrorResponse(c *gin.Context, span oteltrace.Span, statusCode int, err error) {
-	span.RecordError(err)
-	span.SetStatus(codes.Error, err.Error())
-	c.AbortWithError(statusCode, err)
-}
-
-func getOrder(c *gin.Context, rc *db.Client) {
-	ctx, span := tracer.Start(c.Request.Context(), "/order/:id")
-	defer span.End()
-
-	id := c.Param("id")
-	if id == "" {
-		err := errors.New("id is empty")
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		c.AbortWithError(http.StatusBadRequest, err)
-		return
-	}
-	span.SetAttributes(attribute.String("order.id", id))
-
-	order, err := rc.Get(ctx, id)
-	if err != nil && !errors.Is(err, redis.Nil) {
-		handleErrorResponse(c, span, http.StatusInternalServerError, err)
-		return
+	otel.SetTracerProvider(p.tracer)
+	propagator, err := telemetry.NewPropagator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create propagator: %w", err)
 	}
+	otel.SetTextMapPropagator(propagator)
 
-	if order == "" || errors.Is(err, redis.Nil) {
-		err := errors.New("order not found")
-		handleErrorResponse(c, span, http.StatusNotFound, err)
-		return
+	p.meter, err = telemetry.NewMeterProvider(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create meter provider: %w", err)
 	}
+	global.SetMeterProvider(p.meter)
 
-	c.JSON(http.StatusOK, gin.H{
-		"order": order,
-	})
+	if err := telemetry.StartProcessMetrics(cfg); err != nil {
+		return nil, fmt.Errorf("start process metrics: %w", err)
+	}
+	return p, nil
 }
 
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+// shutdown flushes the spans, metrics, and logs still buffered, waiting at
+// most timeout. The logger is shut down last so the errors are still
+// reported.
+func (p *providers) shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-
-	traceProvider, err := initTraceProvider(ctx)
-	if err != nil {
-		log.Fatal(err)
+	if err := p.tracer.Shutdown(ctx); err != nil {
+		slog.Error("flush spans", "error", err)
 	}
-	otel.SetTracerProvider(traceProvider)
-	defer traceProvider.Shutdown(context.Background())
-
-	c, err := db.NewClient(ctx, "localhost:6379")
-	if err != nil {
-		log.Fatal(err)
+	if err := p.meter.Shutdown(ctx); err != nil {
+		slog.Error("flush metrics", "error", err)
 	}
-	defer c.Close()
-
-	router, v1 := newRouter()
-	v1.GET("/orders/:id", func(ctx *gin.Context) { getOrder(ctx, c) })
+	if err := p.logs.Shutdown(ctx); err != nil {
+		slog.Error("flush logs", "error", err)
+	}
+}
 
-	s := &http.Server{
-		Addr:    ":9911",
-		Handler: router,
+// usage lists the subcommands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+}
 
-	go func() {
-		if err := s.ListenAndServe(); err != nil {
-			log.Fatal(err)
+// run runs the subcommand named by the first of args. Flags without a
+// command run the API, as before there were commands. Asking for the usage
+// of a command is not an error.
+func run(args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		usage()
+		return nil
+	}
+	name, cmdArgs := "serve", args
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, cmdArgs = args[0], args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
 		}
-	}()
-	<-ctx.Done()
-	s.Shutdown(context.Background())
+		if err := cmd.run(cmdArgs); err != nil && !errors.Is(err, flag.ErrHelp) {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+	usage()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// main exits only once the subcommand has returned, so the telemetry it
+// buffered has been flushed by then
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("orders failed", "error", err)
+		os.Exit(1)
+	}
 }
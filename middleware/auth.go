@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/auth"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Auth requires a bearer token verified by verifier, answering 401 when it
+// is missing or invalid. Routes are looked up in scopes by method and path,
+// e.g. "POST /v1/orders", and answered with a 403 unless the token was
+// granted every scope listed. The subject, scopes, and tenant of the token
+// are recorded on the span, and the claims are added to the request context
+// for handlers, see auth.ClaimsFromContext. It must run after the tracing
+// middleware.
+func Auth(verifier *auth.Verifier, scopes map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			problem.Abort(c, problem.New(http.StatusUnauthorized, "a bearer token is required"))
+			return
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			span.RecordError(err)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, "the bearer token is invalid"))
+			return
+		}
+		span.SetAttributes(
+			semconv.EnduserIDKey.String(claims.Subject),
+			semconv.EnduserScopeKey.String(claims.Scope),
+		)
+		if claims.TenantID != "" {
+			span.SetAttributes(attribute.String("tenant.id", claims.TenantID))
+		}
+
+		for _, scope := range scopes[c.Request.Method+" "+c.FullPath()] {
+			if !claims.HasScope(scope) {
+				span.RecordError(errors.New("missing scope " + scope))
+				c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				problem.Abort(c, problem.New(http.StatusForbidden, "the bearer token lacks the "+scope+" scope"))
+				return
+			}
+		}
+
+		c.Request = c.Request.WithContext(auth.WithClaims(ctx, claims))
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an Authorization header using the Bearer
+// scheme
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/auth"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Authorize answers with a 403 unless the roles of the client are granted
+// permission by policy. Roles are read from the claims of the bearer token
+// verified by Auth, or else from keys by the X-Api-Key header. The decision
+// is recorded as an event on the span. It must run after the tracing
+// middleware, and after Auth when tokens are verified.
+func Authorize(policy auth.Policy, keys auth.APIKeys, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		var subject, source string
+		var roles []string
+		if claims := auth.ClaimsFromContext(ctx); claims != nil {
+			subject, source, roles = claims.Subject, "token", claims.Roles
+		} else if client, ok := keys.Lookup(c.GetHeader(APIKeyHeader)); ok {
+			subject, source, roles = client.Subject, "api_key", client.Roles
+		}
+
+		allowed := policy.Allows(roles, permission)
+		decision := "deny"
+		if allowed {
+			decision = "allow"
+		}
+		trace.SpanFromContext(ctx).AddEvent("authorization", trace.WithAttributes(
+			attribute.String("authz.permission", permission),
+			attribute.String("authz.decision", decision),
+			attribute.String("authz.source", source),
+			attribute.StringSlice("authz.roles", roles),
+			semconv.EnduserIDKey.String(subject),
+		))
+		if !allowed {
+			problem.Abort(c, problem.New(http.StatusForbidden, "the "+permission+" permission is required"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Baggage copies request headers into OpenTelemetry baggage, e.g.
+// X-Customer-Id into customer.id, so they travel with the request context to
+// every span below it and to downstream services. Entries already in the
+// propagated baggage are kept. It must run after the tracing middleware,
+// which extracts the propagated baggage and starts the request's span.
+func Baggage(headers map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		bag := baggage.FromContext(ctx)
+		span := trace.SpanFromContext(ctx)
+		for header, key := range headers {
+			value := c.GetHeader(header)
+			if value == "" || bag.Member(key).Key() != "" {
+				continue
+			}
+			member, err := baggage.NewMember(key, value)
+			if err != nil {
+				continue
+			}
+			if bag, err = bag.SetMember(member); err != nil {
+				continue
+			}
+			// the request's span started before the entry was added
+			span.SetAttributes(attribute.String(key, value))
+		}
+		c.Request = c.Request.WithContext(baggage.ContextWithBaggage(ctx, bag))
+		c.Next()
+	}
+}
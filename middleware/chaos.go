@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/chaos"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Chaos delays and fails requests at random as injector decides, recording
+// each fault as an event on the span. Requests cancelled or timed out while
+// delayed are not handled. It must run after the tracing middleware, and
+// after Timeout for delays to count against the request timeout.
+func Chaos(injector *chaos.Injector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if delay := injector.Delay(); delay > 0 {
+			chaos.Record(ctx, "latency", attribute.Int64("chaos.latency_ms", delay.Milliseconds()))
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				// Timeout answers once the request has timed out
+				timer.Stop()
+				c.Abort()
+				return
+			}
+		}
+		if status := injector.Error(); status != 0 {
+			chaos.Record(ctx, "error", attribute.Int("chaos.status", status))
+			problem.Abort(c, problem.New(status, "injected fault: "+http.StatusText(status)))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Compress compresses responses with gzip or deflate when the client
+// accepts either, the body is at least minSize bytes, and its media type is
+// one of contentTypes. Responses are buffered so the decision can be made
+// once the handler is done. The uncompressed and sent sizes are recorded on
+// the span. It must run after the tracing middleware, and after AccessLog
+// for the logged size to be the compressed one.
+func Compress(minSize int, contentTypes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		body := w.body.Bytes()
+		header := w.Header()
+		mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		if !slices.Contains(contentTypes, mediaType) || header.Get("Content-Encoding") != "" {
+			w.flush(body)
+			return
+		}
+		header.Add("Vary", "Accept-Encoding")
+		if len(body) < minSize {
+			w.flush(body)
+			return
+		}
+
+		compressed, err := compress(encoding, body)
+		span := trace.SpanFromContext(c.Request.Context())
+		if err != nil {
+			span.RecordError(err)
+			w.flush(body)
+			return
+		}
+		span.SetAttributes(
+			semconv.HTTPResponseContentLengthUncompressedKey.Int(len(body)),
+			semconv.HTTPResponseContentLengthKey.Int(len(compressed)),
+			attribute.String("http.response.content_encoding", encoding),
+		)
+		header.Set("Content-Encoding", encoding)
+		header.Set("Content-Length", strconv.Itoa(len(compressed)))
+		w.flush(compressed)
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip, or returns "" when the client accepts neither
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if allowed, ok := accepted[encoding]; ok {
+			if allowed {
+				return encoding
+			}
+		} else if accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+func compress(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	if encoding == "gzip" {
+		zw = gzip.NewWriter(&buf)
+	} else {
+		var err error
+		if zw, err = flate.NewWriter(&buf, flate.DefaultCompression); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressWriter holds back the response until the handler is done
+type compressWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	// headerWritten is set once the handler commits to a response without
+	// writing a body
+	headerWritten bool
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.headerWritten = true
+}
+
+// Written reports whether the handler has responded, so later middleware
+// does not write a second response into the buffer
+func (w *compressWriter) Written() bool {
+	return w.headerWritten || w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Size() int {
+	if w.body.Len() > 0 {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// flush sends the status, headers, and body to the client
+func (w *compressWriter) flush(body []byte) {
+	if len(body) == 0 {
+		if w.headerWritten {
+			w.ResponseWriter.WriteHeaderNow()
+		}
+		return
+	}
+	w.ResponseWriter.Write(body)
+}
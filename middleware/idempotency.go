@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/idempotency"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IdempotencyKeyHeader is the header clients set to make a request safe to
+// retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds the keys accepted, as they are stored verbatim
+const maxIdempotencyKeyLen = 255
+
+// Idempotency replays the stored response to requests whose Idempotency-Key
+// was already used for the same request, marking the span with
+// idempotent.replay. A key reused for a different request is rejected with
+// a 422, and a key whose first request is still running with a 409. The
+// response is stored for ttl unless it is a server error, which the client
+// may retry. A key is claimed for lockTTL while its first request runs, so
+// the claim of a request that died with its process eventually lapses.
+// Requests without the header are passed through. It must run after the
+// tracing middleware.
+func Idempotency(store idempotency.Store, ttl, lockTTL time.Duration, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		if len(key) > maxIdempotencyKeyLen {
+			problem.Abort(c, problem.New(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Abort(c, problem.New(http.StatusBadRequest, "unreadable request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := fingerprintRequest(c.Request.Method, c.FullPath(), body)
+
+		rec, err := store.Reserve(ctx, key, fingerprint, lockTTL)
+		if err != nil {
+			span.RecordError(err)
+			logger.ErrorContext(ctx, "reserve idempotency key", "error", err)
+			problem.Abort(c, problem.New(http.StatusServiceUnavailable, ""))
+			return
+		}
+		if rec != nil {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				problem.Abort(c, problem.New(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request"))
+			case rec.Status == 0:
+				problem.Abort(c, problem.New(http.StatusConflict, "a request with this Idempotency-Key is in progress"))
+			default:
+				span.SetAttributes(attribute.Bool("idempotent.replay", true))
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(rec.Status, rec.ContentType, rec.Body)
+				c.Abort()
+			}
+			return
+		}
+		span.SetAttributes(attribute.Bool("idempotent.replay", false))
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// store the outcome even if the request timed out
+		ctx = context.WithoutCancel(ctx)
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.Release(ctx, key)
+		} else {
+			err = store.Save(ctx, key, idempotency.Record{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: c.Writer.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			}, ttl)
+		}
+		if err != nil {
+			span.RecordError(err)
+			logger.ErrorContext(ctx, "store idempotency record", "error", err)
+		}
+	}
+}
+
+// fingerprintRequest hashes what identifies a request
+func fingerprintRequest(method, route string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + route + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyRecorder keeps a copy of the response body as it is written
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExemplarRecorder records request durations along with the trace of the
+// request, for metrics backends that link latency buckets to example traces
+type ExemplarRecorder interface {
+	Observe(sc trace.SpanContext, d time.Duration, method, route string, status int)
+}
+
+// Metrics records request duration, in-flight requests, and a request count
+// per status code for every route it is attached to. Durations are recorded
+// by exemplars too when it is set, with the trace that TraceHeaders found.
+func Metrics(meter metric.Meter, exemplars ExemplarRecorder) (gin.HandlerFunc, error) {
+	duration, err := meter.Float64Histogram("http.server.duration",
+		instrument.WithUnit("ms"),
+		instrument.WithDescription("Duration of inbound HTTP requests"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create duration histogram: %w", err)
+	}
+	active, err := meter.Int64UpDownCounter("http.server.active_requests",
+		instrument.WithUnit("{request}"),
+		instrument.WithDescription("Number of inbound HTTP requests in flight"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create active requests counter: %w", err)
+	}
+	requests, err := meter.Int64Counter("http.server.request.count",
+		instrument.WithUnit("{request}"),
+		instrument.WithDescription("Number of inbound HTTP requests by status code"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create request counter: %w", err)
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		activeAttrs := []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPRouteKey.String(c.FullPath()),
+		}
+		active.Add(ctx, 1, activeAttrs...)
+		start := time.Now()
+
+		c.Next()
+
+		elapsed := time.Since(start)
+		active.Add(ctx, -1, activeAttrs...)
+		attrs := append(activeAttrs, semconv.HTTPStatusCodeKey.Int(c.Writer.Status()))
+		duration.Record(ctx, float64(elapsed)/float64(time.Millisecond), attrs...)
+		requests.Add(ctx, 1, attrs...)
+		if exemplars != nil {
+			sc, _ := c.Value(spanContextKey).(trace.SpanContext)
+			exemplars.Observe(sc, elapsed, c.Request.Method, c.FullPath(), c.Writer.Status())
+		}
+	}, nil
+}
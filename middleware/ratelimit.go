@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/auth"
+	"github.com/observiq/tracing/problem"
+	"github.com/observiq/tracing/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// APIKeyHeader identifies the client for rate limiting. Clients without a
+// known key are limited by IP address.
+const APIKeyHeader = "X-Api-Key"
+
+// RateLimit rejects requests with a 429 and a Retry-After header once their
+// client runs out of tokens. Clients are told apart by API key when keys
+// knows it, or else by IP address, so made up keys do not get fresh
+// buckets. Every request is annotated with whether it
+// was throttled, and throttled requests are counted per route. If redis
+// cannot be reached the request is let through, so an outage of the limiter
+// does not take the API down with it. It must run after the tracing
+// middleware.
+func RateLimit(limiter *ratelimit.Limiter, keys auth.APIKeys, meter metric.Meter, logger *slog.Logger) (gin.HandlerFunc, error) {
+	throttled, err := meter.Int64Counter("http.server.throttled_requests",
+		instrument.WithUnit("{request}"),
+		instrument.WithDescription("Number of inbound HTTP requests rejected by the rate limiter"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create throttled counter: %w", err)
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+		client := "ip:" + c.ClientIP()
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			if _, ok := keys.Lookup(key); ok {
+				// API keys are secrets, so only their hash is kept in redis
+				client = "key:" + auth.HashAPIKey(key)
+			}
+		}
+
+		res, err := limiter.Take(ctx, client)
+		if err != nil {
+			span.RecordError(err)
+			logger.ErrorContext(ctx, "rate limit", "error", err)
+			c.Next()
+			return
+		}
+		span.SetAttributes(
+			attribute.Bool("ratelimit.throttled", !res.Allowed),
+			attribute.Int("ratelimit.remaining", res.Remaining),
+		)
+		c.Header("RateLimit-Limit", strconv.Itoa(limiter.Limit()))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if res.Allowed {
+			c.Next()
+			return
+		}
+
+		retryAfter := ratelimit.RetryAfterSeconds(res.RetryAfter)
+		span.SetAttributes(attribute.Int("ratelimit.retry_after_s", retryAfter))
+		throttled.Add(ctx, 1,
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPRouteKey.String(c.FullPath()),
+		)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		problem.Abort(c, problem.New(http.StatusTooManyRequests, "rate limit exceeded, retry later"))
+	}, nil
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recovery converts a panic in a later handler into a 500 response. The
+// panic value and stack are recorded as an exception event on the request's
+// span, which is marked as failed. It must run after the tracing middleware
+// for the span to be recorded.
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// net/http uses ErrAbortHandler to abort a response on purpose
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(r)
+			}
+
+			stack := string(debug.Stack())
+			msg := fmt.Sprint(r)
+			span := trace.SpanFromContext(c.Request.Context())
+			span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+				semconv.ExceptionTypeKey.String(fmt.Sprintf("%T", r)),
+				semconv.ExceptionMessageKey.String(msg),
+				semconv.ExceptionStacktraceKey.String(stack),
+			))
+			span.SetStatus(codes.Error, "panic: "+msg)
+			logger.ErrorContext(c.Request.Context(), "panic recovered",
+				slog.String("panic", msg),
+				slog.String("stack", stack),
+			)
+
+			problem.Abort(c, problem.New(http.StatusInternalServerError, ""))
+		}()
+		c.Next()
+	}
+}
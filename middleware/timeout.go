@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/problem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Timeout cancels the request context once the route's timeout elapses.
+// Routes are looked up in routes by method and path, e.g. "GET /v1/orders",
+// and fall back to def. Handlers see the cancellation through the context, so
+// it propagates into redis calls. If the handler has not responded by the
+// time it returns, a 504 is written. Requests upgrading their connection,
+// like WebSockets, are not bounded, since the session outlives the request.
+// It must run after the tracing middleware for the timeout to be recorded on
+// the span.
+func Timeout(def time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = def
+		}
+		if timeout <= 0 || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		span := trace.SpanFromContext(ctx)
+		span.AddEvent("request timeout", trace.WithAttributes(
+			attribute.Int64("http.request.timeout_ms", timeout.Milliseconds()),
+		))
+		span.SetStatus(codes.Error, "request timed out")
+		if !c.Writer.Written() {
+			problem.Abort(c, problem.New(http.StatusGatewayTimeout, ""))
+		}
+	}
+}
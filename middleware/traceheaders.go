@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanContextKey keeps the span context of the request on the gin context,
+// for the middleware running before the tracing middleware
+const spanContextKey = "middleware.span_context"
+
+// TraceHeaders writes the request's trace ID to the Trace-Id response header
+// and its full trace context to Server-Timing, so clients can link a response
+// to its trace. It must run after the tracing middleware.
+func TraceHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sc := trace.SpanContextFromContext(c.Request.Context())
+		if sc.IsValid() {
+			c.Set(spanContextKey, sc)
+			h := c.Writer.Header()
+			h.Set("Trace-Id", sc.TraceID().String())
+			h.Set("Server-Timing", fmt.Sprintf(`traceparent;desc="00-%s-%s-%s"`, sc.TraceID(), sc.SpanID(), sc.TraceFlags()))
+			h.Add("Access-Control-Expose-Headers", "Trace-Id, Server-Timing")
+		}
+		c.Next()
+	}
+}
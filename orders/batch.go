@@ -0,0 +1,96 @@
+package orders
+
+import (
+	"context"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/store"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchResult is the outcome of creating one order of a batch. Err is nil
+// once the order is stored.
+type BatchResult struct {
+	Order *db.Order
+	Err   error
+}
+
+// CreateBatch creates an order for each request like Create, storing them
+// together in one round trip when the store allows it and no payment
+// service is configured; otherwise each order runs the saga of createPaid.
+// Orders fail independently, so the result of each is returned by index;
+// a request failing validation fails with the errors of validation.Struct.
+//
+// Each order is created in a span of its own, a new root linked to the span
+// of the batch, so a large batch does not bury the trace of the request.
+// Invalid requests are recorded on their span without failing it.
+func (s *Service) CreateBatch(ctx context.Context, reqs []Request) []BatchResult {
+	tracer := otel.Tracer("orders")
+	link := trace.LinkFromContext(ctx)
+	results := make([]BatchResult, len(reqs))
+	spans := make([]trace.Span, len(reqs))
+	itemCtxs := make([]context.Context, len(reqs))
+	var (
+		pending []*db.Order
+		indexes []int
+	)
+	for i, req := range reqs {
+		itemCtx, span := tracer.Start(ctx, "create batch order",
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+			trace.WithAttributes(attribute.Int("batch.index", i)),
+		)
+		spans[i], itemCtxs[i] = span, itemCtx
+
+		if err := validation.Struct(req); err != nil {
+			for _, f := range validation.FieldErrors(err) {
+				span.AddEvent("validation failed", trace.WithAttributes(
+					attribute.String("validation.field", f.Field),
+					attribute.String("validation.rule", f.Rule),
+					attribute.String("validation.message", f.Message),
+				))
+			}
+			results[i].Err = err
+			continue
+		}
+		order, err := s.newOrder(itemCtx, req)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		span.SetAttributes(attribute.String("order.id", order.ID))
+		results[i].Order = order
+		pending = append(pending, order)
+		indexes = append(indexes, i)
+	}
+
+	if s.payments != nil {
+		for j, order := range pending {
+			i := indexes[j]
+			results[i].Err = s.createPaid(itemCtxs[i], order)
+		}
+	} else if len(pending) > 0 {
+		for j, err := range store.CreateOrders(ctx, s.store, pending) {
+			results[indexes[j]].Err = err
+		}
+	}
+
+	for i, span := range spans {
+		if err := results[i].Err; err != nil {
+			results[i].Order = nil
+			span.RecordError(err)
+			if validation.FieldErrors(err) == nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+		} else {
+			s.publish(itemCtxs[i], events.New(events.OrderCreated, results[i].Order))
+		}
+		span.End()
+	}
+	return results
+}
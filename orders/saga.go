@@ -0,0 +1,153 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/jobs"
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// compensationTimeout bounds how long the compensations of a saga may take
+// together
+const compensationTimeout = 10 * time.Second
+
+// step is one step of a saga. compensate undoes the step once a later step
+// fails, and is nil for steps with nothing to undo.
+type step struct {
+	name       string
+	do         func(context.Context) error
+	compensate func(context.Context) error
+}
+
+// runSaga runs the steps in order, each in a span of its own under a span
+// for the saga. When a step fails, the steps done so far are compensated in
+// reverse order, each in a span and announced by events on the saga span.
+// It returns the error of the failed step; compensations that fail are
+// logged, as nothing more can be done about them here.
+func runSaga(ctx context.Context, name string, steps []step) error {
+	tracer := otel.Tracer("orders")
+	ctx, span := tracer.Start(ctx, "saga "+name, trace.WithAttributes(
+		attribute.String("saga.name", name),
+		attribute.Int("saga.steps", len(steps)),
+	))
+	defer span.End()
+
+	for i, st := range steps {
+		stepCtx, stepSpan := tracer.Start(ctx, "saga step "+st.name, trace.WithAttributes(
+			attribute.String("saga.step", st.name),
+		))
+		err := st.do(stepCtx)
+		if err == nil {
+			stepSpan.End()
+			continue
+		}
+		stepSpan.RecordError(err)
+		stepSpan.SetStatus(codes.Error, err.Error())
+		stepSpan.End()
+
+		span.SetAttributes(
+			attribute.String("saga.failed_step", st.name),
+			attribute.String("saga.outcome", "compensated"),
+		)
+		span.SetStatus(codes.Error, err.Error())
+		span.AddEvent("saga compensating", trace.WithAttributes(
+			attribute.String("saga.failed_step", st.name),
+			attribute.String("error", err.Error()),
+		))
+		compensate(ctx, tracer, span, steps[:i])
+		return err
+	}
+	span.SetAttributes(attribute.String("saga.outcome", "completed"))
+	return nil
+}
+
+// compensate undoes the steps that were done, last first. The steps often
+// failed because ctx was cancelled or timed out, so compensations run on a
+// context of their own, bounded by compensationTimeout, lest they fail too.
+func compensate(ctx context.Context, tracer trace.Tracer, span trace.Span, done []step) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensationTimeout)
+	defer cancel()
+	for i := len(done) - 1; i >= 0; i-- {
+		st := done[i]
+		if st.compensate == nil {
+			continue
+		}
+		compCtx, compSpan := tracer.Start(ctx, "saga compensate "+st.name, trace.WithAttributes(
+			attribute.String("saga.step", st.name),
+		))
+		err := st.compensate(compCtx)
+		if err != nil {
+			compSpan.RecordError(err)
+			compSpan.SetStatus(codes.Error, err.Error())
+			slog.ErrorContext(compCtx, "compensate saga step", "step", st.name, "error", err)
+		}
+		compSpan.End()
+		span.AddEvent("saga step compensated", trace.WithAttributes(
+			attribute.String("saga.step", st.name),
+			attribute.Bool("saga.compensation_failed", err != nil),
+		))
+	}
+}
+
+// createPaid creates the order as a saga: stock is reserved as the order is
+// stored, the customer is charged, and the order confirmed as paid. When a
+// step fails the order is cancelled, its stock released, and its charge
+// refunded, as far as the saga got.
+func (s *Service) createPaid(ctx context.Context, order *db.Order) error {
+	var charge *payments.Charge
+	return runSaga(ctx, "create order", []step{
+		{
+			name: "reserve inventory",
+			do: func(ctx context.Context) error {
+				return s.store.CreateOrder(ctx, order)
+			},
+			// the stock is only released once the order is cancelled, so an
+			// order still pending keeps its reservation
+			compensate: func(ctx context.Context) error {
+				_, err := s.store.UpdateOrder(ctx, order.ID, func(o *db.Order) error {
+					return o.TransitionTo(db.StatusCancelled)
+				})
+				if err != nil {
+					return fmt.Errorf("cancel order: %w", err)
+				}
+				order.Status = db.StatusCancelled
+				return store.ReleaseStock(ctx, s.store, order.Items)
+			},
+		},
+		{
+			name: "charge payment",
+			do: func(ctx context.Context) error {
+				var err error
+				charge, err = s.charge(ctx, order)
+				return err
+			},
+			compensate: func(ctx context.Context) error {
+				_, err := s.payments.Refund(ctx, charge.ID)
+				return err
+			},
+		},
+		{
+			name: "confirm order",
+			do: func(ctx context.Context) error {
+				confirmed, err := s.store.UpdateOrder(ctx, order.ID, func(o *db.Order) error {
+					return o.TransitionTo(db.StatusPaid)
+				})
+				if err != nil {
+					return err
+				}
+				*order = *confirmed
+				s.enqueue(ctx, jobs.New(jobs.FulfillOrder, order.ID))
+				return nil
+			},
+		},
+	})
+}
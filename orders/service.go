@@ -0,0 +1,404 @@
+package orders
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/jobs"
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/pricing"
+	"github.com/observiq/tracing/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultPageSize is the page size used when a list request has none
+	DefaultPageSize = 20
+	// MaxPageSize is the largest page a list request may ask for
+	MaxPageSize = 100
+	// MaxBatchSize is the most orders a batch may create
+	MaxBatchSize = 100
+)
+
+// ErrDownstream wraps failures to call another service
+var ErrDownstream = errors.New("downstream service failed")
+
+// Request is the order accepted when creating or updating an order. Both the
+// REST and gRPC APIs validate it with the rules registered by the validation
+// package.
+type Request struct {
+	Customer string        `json:"customer" binding:"required"`
+	Currency string        `json:"currency" binding:"required,currency"`
+	Items    []ItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// ItemRequest is a line item of a Request
+type ItemRequest struct {
+	SKU      string  `json:"sku" binding:"required,sku"`
+	Quantity int     `json:"quantity" binding:"quantity"`
+	Price    float64 `json:"price" binding:"gte=0"`
+}
+
+func (r Request) items() []db.Item {
+	items := make([]db.Item, 0, len(r.Items))
+	for _, item := range r.Items {
+		items = append(items, db.Item{SKU: item.SKU, Quantity: item.Quantity, Price: item.Price})
+	}
+	return items
+}
+
+// Service implements the order operations shared by the REST and gRPC APIs
+type Service struct {
+	store store.OrderStore
+	// inventory checks stock before orders are created, or is nil to skip
+	// the check
+	inventory *inventory.Client
+	// pricing quotes the prices of items, or is nil to keep the prices of
+	// the request
+	pricing *pricing.Client
+	// payments charges orders as they are created, or is nil to leave
+	// them unpaid
+	payments *payments.Client
+	// events announces changes to orders, or is nil to publish nothing
+	events events.Publisher
+	// jobs queues the fulfillment of paid orders, or is nil to leave them
+	// paid
+	jobs jobs.Queue
+}
+
+// NewService creates a service keeping orders in store. inventory,
+// pricing, payments, publisher, and queue may be nil.
+func NewService(store store.OrderStore, inventory *inventory.Client, pricing *pricing.Client, payments *payments.Client, publisher events.Publisher, queue jobs.Queue) *Service {
+	return &Service{
+		store:     store,
+		inventory: inventory,
+		pricing:   pricing,
+		payments:  payments,
+		events:    publisher,
+		jobs:      queue,
+	}
+}
+
+// Get returns the order with the given ID
+func (s *Service) Get(ctx context.Context, id string) (*db.Order, error) {
+	return s.store.GetOrder(ctx, id)
+}
+
+// List returns a page of orders starting at cursor and the cursor of the
+// next page, which is 0 once every order has been listed
+func (s *Service) List(ctx context.Context, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	return s.store.List(ctx, cursor, limit)
+}
+
+// Search returns a page of the orders selected by a non-empty query and the
+// cursor of the next page, which is 0 once every match has been returned
+func (s *Service) Search(ctx context.Context, q db.Query, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	return store.SearchOrders(ctx, s.store, q, cursor, limit)
+}
+
+// SearchText returns a page of the orders matching text, returning
+// db.ErrSearchUnsupported when full text search is not enabled
+func (s *Service) SearchText(ctx context.Context, text string, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	return store.SearchText(ctx, s.store, text, cursor, limit)
+}
+
+// Create stores a new order once the inventory service confirms its items
+// are in stock, reserving their stock as it is stored. Items are priced by
+// the pricing service when one is configured. When a payment service is
+// configured the order is also charged and confirmed as paid, see
+// createPaid.
+func (s *Service) Create(ctx context.Context, req Request) (*db.Order, error) {
+	order, err := s.newOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.create(ctx, order); err != nil {
+		return nil, err
+	}
+	s.publish(ctx, events.New(events.OrderCreated, order))
+	return order, nil
+}
+
+// create stores the new order, charging it when a payment service is
+// configured
+func (s *Service) create(ctx context.Context, order *db.Order) error {
+	if s.payments == nil {
+		return s.store.CreateOrder(ctx, order)
+	}
+	return s.createPaid(ctx, order)
+}
+
+// newOrder builds the order for a request, priced and checked for stock,
+// ready to be stored
+func (s *Service) newOrder(ctx context.Context, req Request) (*db.Order, error) {
+	id, err := newOrderID()
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.price(ctx, req.Currency, req.items())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	order := &db.Order{
+		ID:        id,
+		Customer:  req.Customer,
+		Currency:  req.Currency,
+		Status:    db.StatusCreated,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	order.SetItems(items)
+	if err := s.checkStock(ctx, order.Items); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Update replaces the customer, currency, and items of an order, pricing the
+// items like Create. While the order holds stock, stock is reserved for the
+// quantities added and released for those removed, and nothing changes when
+// the added quantities are out of stock.
+func (s *Service) Update(ctx context.Context, id string, req Request) (*db.Order, error) {
+	items, err := s.price(ctx, req.Currency, req.items())
+	if err != nil {
+		return nil, err
+	}
+	var order *db.Order
+	err = s.store.WithLock(ctx, "order:"+id, func(ctx context.Context) error {
+		current, err := s.store.GetOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+		var added, removed []db.Item
+		if holdsStock(current.Status) {
+			added, removed = stockChanges(current.Items, items)
+			if err := store.ReserveStock(ctx, s.store, added); err != nil {
+				return err
+			}
+		}
+		order, err = s.store.UpdateOrder(ctx, id, func(o *db.Order) error {
+			o.Customer = req.Customer
+			o.Currency = req.Currency
+			o.SetItems(items)
+			return nil
+		})
+		if err != nil {
+			s.releaseStock(ctx, added)
+			return err
+		}
+		s.releaseStock(ctx, removed)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, events.New(events.OrderUpdated, order))
+	return order, nil
+}
+
+// UpdateStatus moves an order to the next status. It also returns the status
+// the order had before, which is empty if the order could not be read. The
+// order is locked while it moves, so concurrent transitions queue up rather
+// than conflict. Orders that are paid are queued for fulfillment, and orders
+// cancelled before they shipped release their stock.
+func (s *Service) UpdateStatus(ctx context.Context, id string, next db.Status) (*db.Order, db.Status, error) {
+	var (
+		order *db.Order
+		from  db.Status
+	)
+	err := s.store.WithLock(ctx, "order:"+id, func(ctx context.Context) error {
+		var err error
+		order, err = s.store.UpdateOrder(ctx, id, func(o *db.Order) error {
+			from = o.Status
+			return o.TransitionTo(next)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, from, err
+	}
+	if order.Status == db.StatusCancelled && holdsStock(from) {
+		s.releaseStock(ctx, order.Items)
+	}
+	s.publish(ctx, events.New(events.OrderStatusChanged, order))
+	if order.Status == db.StatusPaid {
+		s.enqueue(ctx, jobs.New(jobs.FulfillOrder, order.ID))
+	}
+	return order, from, nil
+}
+
+// Exists reports whether the order with the given ID exists
+func (s *Service) Exists(ctx context.Context, id string) (bool, error) {
+	return s.store.Exists(ctx, id)
+}
+
+// Delete removes the order with the given ID, releasing its stock unless it
+// shipped or was cancelled
+func (s *Service) Delete(ctx context.Context, id string) error {
+	err := s.store.WithLock(ctx, "order:"+id, func(ctx context.Context) error {
+		order, err := s.store.GetOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.store.Delete(ctx, id); err != nil {
+			return err
+		}
+		if holdsStock(order.Status) {
+			s.releaseStock(ctx, order.Items)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, events.New(events.OrderDeleted, &db.Order{ID: id}))
+	return nil
+}
+
+// publish announces the event. A failure to publish does not fail the
+// change, which has already been stored, so it is only logged.
+func (s *Service) publish(ctx context.Context, e events.Event) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.Publish(ctx, e); err != nil {
+		slog.ErrorContext(ctx, "publish event", "type", e.Type, "order_id", e.OrderID, "error", err)
+	}
+}
+
+// releaseStock returns the stock of items an order no longer needs. Like
+// publish, a failure does not fail the change, which has already been
+// stored, so it is only logged.
+func (s *Service) releaseStock(ctx context.Context, items []db.Item) {
+	if err := store.ReleaseStock(ctx, s.store, items); err != nil {
+		slog.ErrorContext(ctx, "release stock", "error", err)
+	}
+}
+
+// holdsStock reports whether an order in the status holds the stock reserved
+// as it was created. Shipped orders have used it up, and cancelled orders
+// have released it.
+func holdsStock(status db.Status) bool {
+	return status == db.StatusCreated || status == db.StatusPaid
+}
+
+// stockChanges compares the quantities of each SKU before and after the
+// items of an order change, returning the quantities added and removed
+func stockChanges(before, after []db.Item) (added, removed []db.Item) {
+	delta := make(map[string]int)
+	var skus []string
+	for _, item := range after {
+		if _, ok := delta[item.SKU]; !ok {
+			skus = append(skus, item.SKU)
+		}
+		delta[item.SKU] += item.Quantity
+	}
+	for _, item := range before {
+		if _, ok := delta[item.SKU]; !ok {
+			skus = append(skus, item.SKU)
+		}
+		delta[item.SKU] -= item.Quantity
+	}
+	for _, sku := range skus {
+		switch n := delta[sku]; {
+		case n > 0:
+			added = append(added, db.Item{SKU: sku, Quantity: n})
+		case n < 0:
+			removed = append(removed, db.Item{SKU: sku, Quantity: -n})
+		}
+	}
+	return added, removed
+}
+
+// enqueue queues the job. Like publish, a failure to queue it does not fail
+// the change, so it is only logged.
+func (s *Service) enqueue(ctx context.Context, j jobs.Job) {
+	if s.jobs == nil {
+		return
+	}
+	if err := s.jobs.Enqueue(ctx, j); err != nil {
+		slog.ErrorContext(ctx, "enqueue job", "type", j.Type, "order_id", j.OrderID, "error", err)
+	}
+}
+
+// checkStock asks the inventory service whether the items are in stock. It is
+// skipped when no inventory service is configured.
+func (s *Service) checkStock(ctx context.Context, items []db.Item) error {
+	if s.inventory == nil {
+		return nil
+	}
+	req := make([]inventory.Item, 0, len(items))
+	for _, item := range items {
+		req = append(req, inventory.Item{SKU: item.SKU, Quantity: item.Quantity})
+	}
+	err := s.inventory.Check(ctx, req)
+	if err != nil && !errors.Is(err, inventory.ErrUnavailable) && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrDownstream, err)
+	}
+	return err
+}
+
+// charge asks the payment service to charge the customer for the order,
+// recording the charge on the span
+func (s *Service) charge(ctx context.Context, order *db.Order) (*payments.Charge, error) {
+	charge, err := s.payments.Charge(ctx, payments.ChargeRequest{
+		OrderID:  order.ID,
+		Customer: order.Customer,
+		Amount:   order.Total,
+		Currency: order.Currency,
+	})
+	if err != nil {
+		if errors.Is(err, payments.ErrDeclined) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrDownstream, err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("payment.id", charge.ID))
+	return charge, nil
+}
+
+// price replaces the prices of the items with those quoted by the pricing
+// service. Items it does not know keep the price of the request. It is
+// skipped when no pricing service is configured.
+func (s *Service) price(ctx context.Context, currency string, items []db.Item) ([]db.Item, error) {
+	if s.pricing == nil {
+		return items, nil
+	}
+	skus := make([]string, 0, len(items))
+	for _, item := range items {
+		skus = append(skus, item.SKU)
+	}
+	prices, err := s.pricing.Quote(ctx, currency, skus)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrDownstream, err)
+	}
+	for i, item := range items {
+		if price, ok := prices[item.SKU]; ok {
+			items[i].Price = price
+		}
+	}
+	return items, nil
+}
+
+// newOrderID returns a random 128 bit hex encoded order ID
+func newOrderID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate order id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,158 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errNotStale aborts the expiry of an order that moved on since it was
+// listed
+var errNotStale = errors.New("order is no longer stale")
+
+// ExpireStale cancels the orders still created after maxAge, releasing their
+// stock, and returns how many it cancelled. It is meant to run periodically, see the scheduler
+// package.
+func (s *Service) ExpireStale(ctx context.Context, maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	var stale []string
+	err := s.each(ctx, func(o *db.Order) {
+		if o.Status == db.StatusCreated && o.CreatedAt.Before(cutoff) {
+			stale = append(stale, o.ID)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		expired int
+		errs    []error
+	)
+	for _, id := range stale {
+		var order *db.Order
+		err := s.store.WithLock(ctx, "order:"+id, func(ctx context.Context) error {
+			var err error
+			order, err = s.store.UpdateOrder(ctx, id, func(o *db.Order) error {
+				// the order may have been paid since it was listed
+				if o.Status != db.StatusCreated {
+					return errNotStale
+				}
+				return o.TransitionTo(db.StatusCancelled)
+			})
+			return err
+		})
+		if errors.Is(err, errNotStale) || errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire order %s: %w", id, err))
+			continue
+		}
+		s.releaseStock(ctx, order.Items)
+		s.publish(ctx, events.New(events.OrderStatusChanged, order))
+		expired++
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("orders.stale", len(stale)),
+		attribute.Int("orders.expired", expired),
+	)
+	return expired, errors.Join(errs...)
+}
+
+// Stats counts the stored orders by status
+type Stats struct {
+	ByStatus map[db.Status]int64
+}
+
+// Stats walks every stored order to count them. It is meant to run
+// periodically, see StatsReporter.
+func (s *Service) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{ByStatus: make(map[db.Status]int64)}
+	err := s.each(ctx, func(o *db.Order) {
+		stats.ByStatus[o.Status]++
+	})
+	return stats, err
+}
+
+// each calls fn with every stored order, a page at a time
+func (s *Service) each(ctx context.Context, fn func(*db.Order)) error {
+	var cursor uint64
+	for {
+		page, next, err := s.store.List(ctx, cursor, MaxPageSize)
+		if err != nil {
+			return err
+		}
+		for _, o := range page {
+			fn(o)
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// StatsReporter reports the order counts of the last recomputation as a
+// gauge, so the counts are not recomputed on every collection
+type StatsReporter struct {
+	service *Service
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewStatsReporter creates a reporter for the orders of the service, which
+// reports nothing until Recompute first succeeds
+func NewStatsReporter(service *Service) (*StatsReporter, error) {
+	r := &StatsReporter{service: service}
+	meter := global.Meter("orders")
+	count, err := meter.Int64ObservableGauge("orders.count",
+		instrument.WithUnit("{order}"),
+		instrument.WithDescription("Number of stored orders by status, as of the last recomputation"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create order count gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for status, n := range r.stats.ByStatus {
+			o.ObserveInt64(count, n, attribute.String("order.status", string(status)))
+		}
+		return nil
+	}, count)
+	if err != nil {
+		return nil, fmt.Errorf("register order count callback: %w", err)
+	}
+	return r, nil
+}
+
+// Recompute counts the orders again. A failed recomputation keeps the
+// previous counts.
+func (r *StatsReporter) Recompute(ctx context.Context) error {
+	stats, err := r.service.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, n := range stats.ByStatus {
+		total += n
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("orders.total", total))
+
+	r.mu.Lock()
+	r.stats = stats
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,106 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrDeclined is returned when the payment service declines a charge
+var ErrDeclined = errors.New("payment declined")
+
+// ChargeRequest is the body of a charge
+type ChargeRequest struct {
+	OrderID  string  `json:"order_id" binding:"required"`
+	Customer string  `json:"customer" binding:"required"`
+	Amount   float64 `json:"amount" binding:"gte=0"`
+	Currency string  `json:"currency" binding:"required"`
+}
+
+// Charge is an accepted charge
+type Charge struct {
+	ID      string `json:"id"`
+	OrderID string `json:"order_id"`
+}
+
+// Refund is an accepted refund of a charge
+type Refund struct {
+	ID       string `json:"id"`
+	ChargeID string `json:"charge_id"`
+}
+
+// Client calls the payment service
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the payment service at baseURL. The HTTP
+// client should propagate trace context, see httpclient.New.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Charge charges the customer for an order. It returns an error wrapping
+// ErrDeclined when the charge is declined.
+func (c *Client) Charge(ctx context.Context, charge ChargeRequest) (*Charge, error) {
+	body, err := json.Marshal(charge)
+	if err != nil {
+		return nil, fmt.Errorf("encode charge: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/charges", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create charge: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("charge: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusPaymentRequired:
+		return nil, fmt.Errorf("%w: order %s", ErrDeclined, charge.OrderID)
+	default:
+		return nil, fmt.Errorf("charge: unexpected status %s", resp.Status)
+	}
+
+	var res Charge
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decode charge: %w", err)
+	}
+	return &res, nil
+}
+
+// Refund refunds a charge in full
+func (c *Client) Refund(ctx context.Context, chargeID string) (*Refund, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/charges/"+url.PathEscape(chargeID)+"/refund", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create refund: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("refund: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("refund: unexpected status %s", resp.Status)
+	}
+
+	var res Refund
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("decode refund: %w", err)
+	}
+	return &res, nil
+}
@@ -0,0 +1,174 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the payment service
+const instrumentationName = "paymentsAPI"
+
+var (
+	// errProcessorUnavailable is the failure the stub injects at random
+	errProcessorUnavailable = errors.New("payment processor unavailable")
+	// errCardDeclined is the decline the stub injects at random
+	errCardDeclined = errors.New("card declined")
+)
+
+// Options tune the stub so demos can show slow and failing downstream calls
+type Options struct {
+	// Latency is the least time a charge takes
+	Latency time.Duration
+	// Jitter is the most time added at random to Latency
+	Jitter time.Duration
+	// FailureRate is the fraction of charges that fail with a 503
+	FailureRate float64
+	// DeclineRate is the fraction of charges that are declined with a 402
+	DeclineRate float64
+}
+
+type handler struct {
+	opts   Options
+	tracer trace.Tracer
+}
+
+// NewHandler creates the HTTP API of the payment service stub. It accepts
+// every charge that does not fail or get declined at random, and refunds
+// any charge ID without keeping track of charges.
+func NewHandler(opts Options, tracerProvider trace.TracerProvider) http.Handler {
+	h := &handler{
+		opts:   opts,
+		tracer: tracerProvider.Tracer(instrumentationName),
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	v1 := r.Group("/v1")
+	v1.Use(otelgin.Middleware(instrumentationName, otelgin.WithTracerProvider(tracerProvider)))
+	v1.POST("/charges", h.charge)
+	v1.POST("/charges/:id/refund", h.refund)
+	return r
+}
+
+func (h *handler) charge(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, h.tracer, c.FullPath())
+	defer span.End()
+
+	var req ChargeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, span, http.StatusBadRequest, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("order.id", req.OrderID),
+		attribute.Float64("payment.amount", req.Amount),
+		attribute.String("payment.currency", req.Currency),
+	)
+
+	if err := h.process(ctx); errors.Is(err, errCardDeclined) {
+		abort(c, span, http.StatusPaymentRequired, err)
+		return
+	} else if err != nil {
+		abort(c, span, http.StatusServiceUnavailable, err)
+		return
+	}
+	id, err := newID("ch_")
+	if err != nil {
+		abort(c, span, http.StatusInternalServerError, err)
+		return
+	}
+	span.SetAttributes(attribute.String("payment.id", id))
+
+	c.JSON(http.StatusCreated, Charge{
+		ID:      id,
+		OrderID: req.OrderID,
+	})
+}
+
+func (h *handler) refund(c *gin.Context) {
+	ctx, span := span.Handler(c.Request, h.tracer, c.FullPath())
+	defer span.End()
+
+	chargeID := c.Param("id")
+	span.SetAttributes(attribute.String("payment.id", chargeID))
+
+	// refunds only wait out the latency, so compensations succeed
+	select {
+	case <-time.After(h.opts.Latency):
+	case <-ctx.Done():
+		abort(c, span, http.StatusServiceUnavailable, ctx.Err())
+		return
+	}
+	id, err := newID("re_")
+	if err != nil {
+		abort(c, span, http.StatusInternalServerError, err)
+		return
+	}
+	span.SetAttributes(attribute.String("payment.refund_id", id))
+
+	c.JSON(http.StatusCreated, Refund{
+		ID:       id,
+		ChargeID: chargeID,
+	})
+}
+
+// process stands in for the call to a card processor, waiting out the
+// configured latency and failing or declining at the configured rates
+func (h *handler) process(ctx context.Context) error {
+	ctx, span := h.tracer.Start(ctx, "process charge")
+	defer span.End()
+
+	delay := h.opts.Latency
+	if h.opts.Jitter > 0 {
+		delay += time.Duration(mathrand.Int63n(int64(h.opts.Jitter)))
+	}
+	span.SetAttributes(attribute.Int64("payment.simulated_latency_ms", delay.Milliseconds()))
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		span.SetStatus(codes.Error, ctx.Err().Error())
+		return ctx.Err()
+	}
+
+	var err error
+	switch roll := mathrand.Float64(); {
+	case roll < h.opts.FailureRate:
+		err = errProcessorUnavailable
+	case roll < h.opts.FailureRate+h.opts.DeclineRate:
+		err = errCardDeclined
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// newID returns a random charge or refund ID with the prefix
+func newID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate id: %w", err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// abort records the error on the span and responds with it
+func abort(c *gin.Context, s trace.Span, statusCode int, err error) {
+	span.RecordHTTPError(s, statusCode, err)
+	c.AbortWithStatusJSON(statusCode, gin.H{"error": err.Error()})
+}
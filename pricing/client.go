@@ -0,0 +1,81 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Client asks the pricing service for quotes
+type Client struct {
+	conn    *nats.Conn
+	subject string
+	timeout time.Duration
+	tracer  trace.Tracer
+}
+
+// NewClient creates a client sending quote requests on subject, giving up on
+// a reply after timeout
+func NewClient(conn *nats.Conn, subject string, timeout time.Duration) *Client {
+	return &Client{
+		conn:    conn,
+		subject: subject,
+		timeout: timeout,
+		tracer:  otel.Tracer("pricing"),
+	}
+}
+
+// Quote returns the unit prices of the SKUs the pricing service knows. It
+// returns an error wrapping ErrUnavailable when no pricing service answers.
+func (c *Client) Quote(ctx context.Context, currency string, skus []string) (map[string]float64, error) {
+	attrs := append(messagingAttrs(c.subject), attribute.Int("pricing.sku_count", len(skus)))
+	ctx, span := span.Client(ctx, c.tracer, c.subject+" request", trace.WithAttributes(attrs...))
+	defer span.End()
+
+	prices, err := c.quote(ctx, currency, skus)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("pricing.quoted_count", len(prices)))
+	return prices, nil
+}
+
+func (c *Client) quote(ctx context.Context, currency string, skus []string) (map[string]float64, error) {
+	data, err := json.Marshal(QuoteRequest{Currency: currency, SKUs: skus})
+	if err != nil {
+		return nil, fmt.Errorf("encode quote request: %w", err)
+	}
+	msg := nats.NewMsg(c.subject)
+	msg.Data = data
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(msg.Header))
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	reply, err := c.conn.RequestMsgWithContext(ctx, msg)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return nil, fmt.Errorf("%w: no responders on %s", ErrUnavailable, c.subject)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("request quote: %w", err)
+	}
+
+	var res QuoteResponse
+	if err := json.Unmarshal(reply.Data, &res); err != nil {
+		return nil, fmt.Errorf("decode quote: %w", err)
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("quote: %s", res.Error)
+	}
+	return res.Prices, nil
+}
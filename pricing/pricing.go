@@ -0,0 +1,68 @@
+// Package pricing quotes the prices of SKUs over NATS request/reply. The
+// trace context travels in the NATS message headers, so the span answering a
+// quote is a child of the span that asked for it.
+package pricing
+
+import (
+	"errors"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// ErrUnavailable is returned when the pricing service cannot quote
+var ErrUnavailable = errors.New("pricing unavailable")
+
+// DefaultSubject is the subject the pricing service answers quotes on
+const DefaultSubject = "pricing.quote"
+
+// QuoteRequest asks for the unit prices of SKUs in a currency
+type QuoteRequest struct {
+	Currency string   `json:"currency"`
+	SKUs     []string `json:"skus"`
+}
+
+// QuoteResponse holds the unit prices of the SKUs the pricing service knows.
+// SKUs it does not know are left out. Error is set when the quote failed.
+type QuoteResponse struct {
+	Prices map[string]float64 `json:"prices,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// messagingAttrs describes a message on subject with the messaging semantic
+// conventions
+func messagingAttrs(subject string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingDestinationKey.String(subject),
+		semconv.MessagingDestinationKindTopic,
+	}
+}
+
+// headerCarrier adapts NATS message headers to the propagation API. Unlike
+// http.Header, NATS headers are case sensitive, so keys are kept as the
+// propagators write them.
+type headerCarrier nats.Header
+
+var _ propagation.TextMapCarrier = headerCarrier(nil)
+
+// Get returns the first value of the header
+func (c headerCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+// Set replaces the values of the header
+func (c headerCarrier) Set(key, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+// Keys lists the header keys
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
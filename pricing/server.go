@@ -0,0 +1,75 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queueGroup spreads quote requests over every running pricing service
+const queueGroup = "pricing"
+
+// Catalog holds the unit price of each SKU. Prices are the same in every
+// currency.
+type Catalog map[string]float64
+
+// Serve answers the quote requests sent on subject from the catalog until
+// the returned subscription is drained
+func Serve(conn *nats.Conn, subject string, catalog Catalog) (*nats.Subscription, error) {
+	tracer := otel.Tracer("pricing")
+	sub, err := conn.QueueSubscribe(subject, queueGroup, func(msg *nats.Msg) {
+		respond(tracer, catalog, msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+// respond answers a quote request in a server span that is a child of the
+// span that sent it
+func respond(tracer trace.Tracer, catalog Catalog, msg *nats.Msg) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(msg.Header))
+	attrs := append(messagingAttrs(msg.Subject), semconv.MessagingOperationProcess)
+	ctx, span := span.Server(ctx, tracer, msg.Subject+" process", trace.WithAttributes(attrs...))
+	defer span.End()
+
+	var res QuoteResponse
+	var req QuoteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		res.Error = fmt.Sprintf("decode quote request: %v", err)
+	} else {
+		res.Prices = make(map[string]float64, len(req.SKUs))
+		for _, sku := range req.SKUs {
+			if price, ok := catalog[sku]; ok {
+				res.Prices[sku] = price
+			}
+		}
+		span.SetAttributes(
+			attribute.String("pricing.currency", req.Currency),
+			attribute.Int("pricing.sku_count", len(req.SKUs)),
+			attribute.Int("pricing.quoted_count", len(res.Prices)),
+		)
+	}
+
+	data, err := json.Marshal(res)
+	if err == nil {
+		err = msg.Respond(data)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "respond to quote", "error", err)
+	}
+}
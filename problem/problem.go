@@ -0,0 +1,70 @@
+package problem
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/observiq/tracing/validation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// TraceID identifies the trace of the failed request so it can be looked
+	// up from a support ticket
+	TraceID string `json:"trace_id,omitempty"`
+	// Errors lists the individual fields that failed validation
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+// serverErrorDetail is the detail of every server error. The error itself
+// is only recorded on the span and logged, so the trace ID is what leads to
+// it.
+const serverErrorDetail = "internal error; quote the trace ID when reporting it"
+
+// New builds a problem for the status code. The detail of server errors is
+// replaced with a generic message so internal errors are not leaked.
+func New(status int, detail string) Problem {
+	if status >= http.StatusInternalServerError {
+		detail = serverErrorDetail
+	}
+	return Problem{
+		Type:   fmt.Sprintf("https://httpstatuses.io/%d", status),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Validation builds the problem returned when a request body is invalid
+func Validation(detail string, fields []validation.FieldError) Problem {
+	p := New(http.StatusBadRequest, detail)
+	p.Title = "Invalid request body"
+	p.Errors = fields
+	return p
+}
+
+// WithTraceID returns p stamped with the trace ID of ctx, if it has one
+func WithTraceID(ctx context.Context, p Problem) Problem {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		p.TraceID = sc.TraceID().String()
+	}
+	return p
+}
+
+// Abort writes the problem as the response, stamped with the trace ID of the
+// request, and stops the handler chain
+func Abort(c *gin.Context, p Problem) {
+	p = WithTraceID(c.Request.Context(), p)
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
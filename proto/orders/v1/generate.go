@@ -0,0 +1,5 @@
+// Package ordersv1 contains the generated protobuf and gRPC code for the
+// orders API.
+package ordersv1
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative --go-grpc_out=../../.. --go-grpc_opt=paths=source_relative proto/orders/v1/orders.proto
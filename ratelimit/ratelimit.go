@@ -0,0 +1,102 @@
+// Package ratelimit limits how often each client may call the API with token
+// buckets kept in redis, so every instance of the API enforces the same
+// limit.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the buckets apart from the orders
+const keyPrefix = "ratelimit:"
+
+// takeScript takes a token from the bucket in KEYS[1], refilled at ARGV[1]
+// tokens per second up to ARGV[2] tokens, as of ARGV[3] milliseconds since
+// the epoch. The bucket expires once it would be full again. Returns whether
+// a token was taken, the tokens left, and the milliseconds until the next
+// token when none was.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate))
+return {allowed, math.floor(tokens), retry}
+`)
+
+// Result is the outcome of a request to take a token
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until a token is available when none was
+	RetryAfter time.Duration
+}
+
+// Limiter hands out tokens from a bucket per key, refilled at Rate tokens
+// per second up to Burst tokens
+type Limiter struct {
+	client redis.UniversalClient
+	rate   float64
+	burst  int
+}
+
+// NewLimiter creates a limiter keeping its buckets with client
+func NewLimiter(client redis.UniversalClient, rate float64, burst int) *Limiter {
+	return &Limiter{
+		client: client,
+		rate:   rate,
+		burst:  burst,
+	}
+}
+
+// Take takes a token from the bucket of key. Refilling and taking happen in
+// one atomic script, so concurrent requests cannot overdraw the bucket.
+func (l *Limiter) Take(ctx context.Context, key string) (Result, error) {
+	res, err := takeScript.Run(ctx, l.client, []string{keyPrefix + key},
+		l.rate, l.burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("take token: %w", err)
+	}
+	if len(res) != 3 {
+		return Result{}, fmt.Errorf("take token: unexpected reply %v", res)
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+// Limit returns the size of the buckets
+func (l *Limiter) Limit() int {
+	return l.burst
+}
+
+// RetryAfterSeconds rounds d up to whole seconds, as the Retry-After header
+// expects, and is at least 1
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+// Close closes the redis connection
+func (l *Limiter) Close() error {
+	return l.client.Close()
+}
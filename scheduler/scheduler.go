@@ -0,0 +1,148 @@
+// Package scheduler runs periodic background tasks. Each run is the root
+// span of a trace of its own, since no request caused it, and is counted by
+// outcome so failing tasks show up in metrics as well as in traces.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Task outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Task is work run every Interval
+type Task struct {
+	// Name identifies the task in spans, metrics, and logs
+	Name     string
+	Interval time.Duration
+	// Timeout bounds a run. Runs are unbounded when it is 0.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Scheduler runs each of its tasks on a ticker of its own. A run that takes
+// longer than the interval of its task delays the next run rather than
+// overlapping with it.
+type Scheduler struct {
+	tasks    []Task
+	tracer   trace.Tracer
+	runs     instrument.Int64Counter
+	duration instrument.Float64Histogram
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a scheduler for the tasks. Call Start to run them.
+func New(tasks ...Task) (*Scheduler, error) {
+	meter := global.Meter("scheduler")
+	runs, err := meter.Int64Counter("scheduler.task.runs",
+		instrument.WithUnit("{run}"),
+		instrument.WithDescription("Number of scheduled task runs by task and outcome"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create runs counter: %w", err)
+	}
+	duration, err := meter.Float64Histogram("scheduler.task.duration",
+		instrument.WithUnit("ms"),
+		instrument.WithDescription("Duration of scheduled task runs"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create duration histogram: %w", err)
+	}
+
+	return &Scheduler{
+		tasks:    tasks,
+		tracer:   otel.Tracer("scheduler"),
+		runs:     runs,
+		duration: duration,
+	}, nil
+}
+
+// Start runs every task once per interval, starting one interval from now,
+// until Close is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(ctx, t)
+	}
+}
+
+// Close cancels the runs in progress and waits for them to return
+func (s *Scheduler) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, t Task) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.run(ctx, t)
+		}
+	}
+}
+
+// run runs the task once in a root span recording its outcome
+func (s *Scheduler) run(ctx context.Context, t Task) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	ctx, span := s.tracer.Start(ctx, "scheduled "+t.Name,
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("task.name", t.Name),
+			attribute.String("task.interval", t.Interval.String()),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := t.Run(ctx)
+	elapsed := time.Since(start)
+
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "scheduled task failed", "task", t.Name, "error", err)
+	}
+	span.SetAttributes(
+		attribute.String("task.outcome", outcome),
+		attribute.Int64("task.duration_ms", elapsed.Milliseconds()),
+	)
+	attrs := []attribute.KeyValue{
+		attribute.String("task.name", t.Name),
+		attribute.String("task.outcome", outcome),
+	}
+	s.runs.Add(ctx, 1, attrs...)
+	s.duration.Record(ctx, float64(elapsed)/float64(time.Millisecond), attrs...)
+}
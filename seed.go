@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/seed"
+)
+
+// seedStore fills the configured store with fake customers and orders and
+// exits, for stores that outlive the command
+func seedStore(args []string) error {
+	var count int
+	cfg, err := loadConfig("seed", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&count, "count", 100, "number of orders created")
+	})
+	if err != nil {
+		return err
+	}
+	if cfg.Store.Backend == config.StoreMemory {
+		return errors.New("the memory store does not outlive the command, use serve -seed instead")
+	}
+	if count <= 0 {
+		return errors.New("count must be positive")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	providers, err := setupTelemetry(ctx, cfg.Telemetry)
+	if err != nil {
+		return fmt.Errorf("set up telemetry: %w", err)
+	}
+	defer providers.shutdown(cfg.Telemetry.ShutdownTimeout)
+
+	orderStore, customerStore, _, err := newStore(ctx, cfg, nil)
+	if err != nil {
+		return fmt.Errorf("create store: %w", err)
+	}
+	// closing the store flushes the orders held by write behind
+	defer orderStore.Close()
+
+	if err := seed.Run(ctx, orderStore, customerStore, count); err != nil {
+		return fmt.Errorf("seed store: %w", err)
+	}
+	slog.Info("seeded store", "orders", count)
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package seed fills a store with fake customers and orders, so the API
+// returns data right after startup
+package seed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"strings"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	firstNames = []string{"Ada", "Alan", "Barbara", "Claude", "Dennis", "Edsger", "Frances", "Grace", "Hedy", "John", "Katherine", "Ken", "Linus", "Margaret", "Niklaus", "Radia", "Shafi", "Tim"}
+	lastNames  = []string{"Allen", "Berners-Lee", "Dijkstra", "Goldwasser", "Hamilton", "Hopper", "Johnson", "Kernighan", "Lamarr", "Liskov", "Lovelace", "McCarthy", "Perlman", "Ritchie", "Shannon", "Thompson", "Torvalds", "Turing", "Wirth"}
+	domains    = []string{"example.com", "example.org", "example.net"}
+	currencies = []string{"USD", "USD", "USD", "EUR", "GBP"}
+	// catalog matches the prices served by cmd/pricing
+	catalog = []db.Item{
+		{SKU: "ABC-1234", Price: 9.99},
+		{SKU: "ABC-5678", Price: 24.5},
+		{SKU: "WIDGET-01", Price: 3.25},
+		{SKU: "GADGET-42", Price: 129},
+	}
+	// statuses are weighted towards orders early in their lifecycle
+	statuses = []db.Status{
+		db.StatusCreated, db.StatusCreated, db.StatusCreated,
+		db.StatusPaid, db.StatusPaid,
+		db.StatusShipped, db.StatusDelivered, db.StatusCancelled,
+	}
+)
+
+// ordersPerCustomer is roughly how many orders each fake customer places
+const ordersPerCustomer = 5
+
+// batchSize is how many orders are stored per round trip
+const batchSize = 100
+
+// maxAge is how far back orders are created
+const maxAge = 30 * 24 * time.Hour
+
+// Run stores n fake orders in orders, placed by fake customers stored in
+// customers. Stock is reserved for the orders when the store tracks it.
+func Run(ctx context.Context, orders store.OrderStore, customers store.CustomerStore, n int) error {
+	ctx, span := otel.Tracer("seed").Start(ctx, "seed", trace.WithAttributes(attribute.Int("seed.orders", n)))
+	defer span.End()
+
+	err := run(ctx, orders, customers, n)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func run(ctx context.Context, orders store.OrderStore, customers store.CustomerStore, n int) error {
+	now := time.Now().UTC()
+	people := make([]*db.Customer, 0, n/ordersPerCustomer+1)
+	for i := 0; i < cap(people); i++ {
+		c, err := newCustomer(now)
+		if err != nil {
+			return err
+		}
+		if err := customers.CreateCustomer(ctx, c); err != nil {
+			return fmt.Errorf("create customer: %w", err)
+		}
+		people = append(people, c)
+	}
+
+	for created := 0; created < n; created += batchSize {
+		batch := make([]*db.Order, 0, min(batchSize, n-created))
+		for len(batch) < cap(batch) {
+			o, err := newOrder(people[mathrand.Intn(len(people))], now)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, o)
+		}
+		var errs []error
+		for _, err := range store.CreateOrders(ctx, orders, batch) {
+			// fake orders may ask for more than is in stock
+			if err != nil && !errors.Is(err, db.ErrOutOfStock) {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("create orders: %w", err)
+		}
+	}
+	return nil
+}
+
+func newCustomer(now time.Time) (*db.Customer, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	first := firstNames[mathrand.Intn(len(firstNames))]
+	last := lastNames[mathrand.Intn(len(lastNames))]
+	email := fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(strings.ReplaceAll(last, "-", "")), mathrand.Intn(100), domains[mathrand.Intn(len(domains))])
+	createdAt := now.Add(-maxAge - time.Duration(mathrand.Int63n(int64(maxAge))))
+	return &db.Customer{
+		ID:        id,
+		Name:      first + " " + last,
+		Email:     email,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}, nil
+}
+
+func newOrder(customer *db.Customer, now time.Time) (*db.Order, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]db.Item, 0, 3)
+	for _, i := range mathrand.Perm(len(catalog))[:1+mathrand.Intn(3)] {
+		item := catalog[i]
+		item.Quantity = min(10, 1+int(math.Floor(mathrand.ExpFloat64()*2)))
+		items = append(items, item)
+	}
+	age := 1 + time.Duration(mathrand.Int63n(int64(maxAge)))
+	createdAt := now.Add(-age)
+	o := &db.Order{
+		ID:        id,
+		Customer:  customer.ID,
+		Currency:  currencies[mathrand.Intn(len(currencies))],
+		Status:    statuses[mathrand.Intn(len(statuses))],
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt.Add(time.Duration(mathrand.Int63n(int64(age)))),
+	}
+	o.SetItems(items)
+	return o, nil
+}
+
+// newID returns a random 128 bit hex encoded ID, like the IDs of the API
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats.go"
+	"github.com/observiq/tracing/app"
+	"github.com/observiq/tracing/auth"
+	"github.com/observiq/tracing/chaos"
+	"github.com/observiq/tracing/config"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/httpclient"
+	"github.com/observiq/tracing/idempotency"
+	"github.com/observiq/tracing/inventory"
+	"github.com/observiq/tracing/jobs"
+	"github.com/observiq/tracing/middleware"
+	"github.com/observiq/tracing/payments"
+	"github.com/observiq/tracing/pricing"
+	"github.com/observiq/tracing/ratelimit"
+	"github.com/observiq/tracing/seed"
+	"github.com/observiq/tracing/store"
+	"github.com/observiq/tracing/telemetry"
+	"github.com/observiq/tracing/validation"
+)
+
+// reloadOnHangup reloads the config each time a SIGHUP is received, applying
+// the log level and sampling ratio. Other settings require a restart.
+func reloadOnHangup(ctx context.Context, hangup <-chan os.Signal, holder *config.Holder, logs *telemetry.LoggerProvider, sampler *telemetry.ReloadableSampler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+
+		cfg, err := holder.Reload(func(cfg *config.Config) error {
+			if err := sampler.Update(cfg.Telemetry); err != nil {
+				return err
+			}
+			logs.SetLevel(cfg.Telemetry.LogLevel)
+			return nil
+		})
+		if err != nil {
+			slog.Error("reload config", "error", err)
+			continue
+		}
+		slog.Info("reloaded config",
+			"log_level", cfg.Telemetry.LogLevel,
+			"traces_sampler_arg", cfg.Telemetry.SamplerArg,
+		)
+	}
+}
+
+// newStore creates the order store selected by the config, with the write
+// buffer and cache in front of it when enabled. It also returns the outbox
+// of the backend when the events outbox is enabled, and the backend itself
+// as the customer store, bypassing the buffer and cache.
+func newStore(ctx context.Context, cfg config.Config, faults *chaos.Injector) (store.OrderStore, store.CustomerStore, events.Outbox, error) {
+	s, err := newBackend(ctx, cfg, faults)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	customers, ok := s.(store.CustomerStore)
+	if !ok {
+		s.Close()
+		return nil, nil, nil, errors.New("the store does not keep customers")
+	}
+	var outbox events.Outbox
+	if cfg.Events.Outbox.Enabled {
+		sqlStore, ok := s.(*store.SQL)
+		if !ok {
+			s.Close()
+			return nil, nil, nil, errors.New("the events outbox needs a SQL store")
+		}
+		if err := sqlStore.EnableOutbox(ctx); err != nil {
+			s.Close()
+			return nil, nil, nil, err
+		}
+		outbox = sqlStore
+	}
+	if cfg.Store.Search.Enabled {
+		if err := enableSearch(ctx, s, cfg.Store.Search.Index); err != nil {
+			s.Close()
+			return nil, nil, nil, err
+		}
+	}
+	if cfg.Store.WriteBehind.Enabled {
+		s = store.NewWriteBehind(s, cfg.Store.WriteBehind.Interval, cfg.Store.WriteBehind.BatchSize)
+	}
+	if cfg.Store.Cache.Size == 0 {
+		return s, customers, outbox, nil
+	}
+	cached, err := store.NewCached(s, cfg.Store.Cache.Size, cfg.Store.Cache.TTL)
+	if err != nil {
+		s.Close()
+		return nil, nil, nil, err
+	}
+	return cached, customers, outbox, nil
+}
+
+// enableSearch indexes the orders of the redis store for full text search.
+// Redis without the RediSearch module only disables search, with a warning.
+func enableSearch(ctx context.Context, s store.OrderStore, index string) error {
+	client, ok := s.(*db.Client)
+	if !ok {
+		return errors.New("full text search needs the redis store")
+	}
+	err := client.EnableSearch(ctx, index)
+	if errors.Is(err, db.ErrSearchUnsupported) {
+		slog.WarnContext(ctx, "redis lacks the RediSearch module, full text search is disabled")
+		return nil
+	}
+	return err
+}
+
+// newBackend creates the order store backend selected by the config. The
+// commands of the redis store time out at random when faults is set.
+func newBackend(ctx context.Context, cfg config.Config, faults *chaos.Injector) (store.OrderStore, error) {
+	switch cfg.Store.Backend {
+	case config.StoreMemory:
+		return store.NewMemory(), nil
+	case config.StorePostgres:
+		return store.NewPostgres(ctx, cfg.Store.PostgresDSN)
+	case config.StoreSQLite:
+		return store.NewSQLite(ctx, cfg.Store.SQLitePath)
+	}
+
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	if faults != nil {
+		opts.Hooks = append(opts.Hooks, faults)
+	}
+	c, err := db.NewClient(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return c, nil
+}
+
+// redisOptions converts the redis config to client options
+func redisOptions(cfg config.RedisConfig) (db.Options, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return db.Options{}, err
+	}
+	return db.Options{
+		Mode:             cfg.Mode,
+		Addrs:            cfg.Addrs(),
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		TLSConfig:        tlsConfig,
+		PoolSize:         cfg.Pool.Size,
+		MinIdleConns:     cfg.Pool.MinIdleConns,
+		MaxIdleConns:     cfg.Pool.MaxIdleConns,
+		PoolTimeout:      cfg.Pool.Timeout,
+		ConnMaxIdleTime:  cfg.Pool.ConnMaxIdleTime,
+		ConnMaxLifetime:  cfg.Pool.ConnMaxLifetime,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		BreakerThreshold: cfg.Breaker.Threshold,
+		BreakerCooldown:  cfg.Breaker.Cooldown,
+	}, nil
+}
+
+// publishCloser is an event publisher holding connections to close
+type publishCloser interface {
+	events.Publisher
+	Close() error
+}
+
+// newPublisher creates the event publisher selected by the config, or
+// returns nil when events are disabled
+func newPublisher(ctx context.Context, cfg config.Config) (publishCloser, error) {
+	switch cfg.Events.Publisher {
+	case config.PublisherRedis:
+	case config.PublisherKafka:
+		return events.NewKafkaPublisher(cfg.Events.Kafka.Addrs(), cfg.Events.Kafka.Topic), nil
+	default:
+		return nil, nil
+	}
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	opts.Name = "events"
+	// the store already guards redis with a breaker, and a failed publish
+	// does not fail the request
+	opts.BreakerThreshold = 0
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return events.NewRedisPublisher(client, cfg.Events.Channel), nil
+}
+
+// newWatcher creates the watcher streaming the status changes of orders to
+// WebSocket clients when events are published to redis, or returns nil
+func newWatcher(ctx context.Context, cfg config.Config) (*events.RedisWatcher, error) {
+	if cfg.Events.Publisher != config.PublisherRedis {
+		return nil, nil
+	}
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	opts.Name = "watch"
+	// the subscription holds its own connection, which the breaker would
+	// only cut off
+	opts.BreakerThreshold = 0
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return events.NewRedisWatcher(client, cfg.Events.Channel), nil
+}
+
+// newQueue creates the job queue selected by the config, or returns nil
+// when jobs are disabled
+func newQueue(ctx context.Context, cfg config.Config) (*jobs.RedisQueue, error) {
+	if cfg.Jobs.Queue != config.QueueRedis {
+		return nil, nil
+	}
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	opts.Name = "jobs"
+	// as with events, a failed enqueue does not fail the request
+	opts.BreakerThreshold = 0
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return jobs.NewRedisQueue(client, cfg.Jobs.Stream), nil
+}
+
+// newIdempotencyStore creates the store of idempotency records when
+// Idempotency-Key support is enabled, or returns nil
+func newIdempotencyStore(ctx context.Context, cfg config.Config) (*idempotency.RedisStore, error) {
+	if !cfg.Idempotency.Enabled {
+		return nil, nil
+	}
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	opts.Name = "idempotency"
+	// the store already guards redis with a breaker, whose state gauge a
+	// second breaker would report over
+	opts.BreakerThreshold = 0
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return idempotency.NewRedisStore(client), nil
+}
+
+// newInjector creates the fault injector when chaos is enabled, or returns
+// nil
+func newInjector(cfg config.Config) (*chaos.Injector, error) {
+	if !cfg.Chaos.Enabled {
+		return nil, nil
+	}
+	slog.Warn("chaos is enabled, faults will be injected into requests")
+	return chaos.NewInjector(cfg.Chaos.Faults())
+}
+
+// newRateLimiter creates the rate limiter when rate limiting is enabled, or
+// returns nil
+func newRateLimiter(ctx context.Context, cfg config.Config) (*ratelimit.Limiter, error) {
+	if !cfg.RateLimit.Enabled {
+		return nil, nil
+	}
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	opts.Name = "ratelimit"
+	// requests are let through when redis fails, so the breaker would only
+	// hide the failures
+	opts.BreakerThreshold = 0
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return ratelimit.NewLimiter(client, cfg.RateLimit.Rate, cfg.RateLimit.Burst), nil
+}
+
+// newVerifier creates the verifier of bearer tokens when authentication is
+// enabled, or returns nil
+func newVerifier(cfg config.AuthConfig) (*auth.Verifier, error) {
+	opts := auth.Options{Issuer: cfg.Issuer, Audience: cfg.Audience}
+	switch cfg.Mode {
+	case config.AuthHMAC:
+		return auth.NewHMACVerifier([]byte(cfg.HMACSecret), opts), nil
+	case config.AuthJWKS:
+		return auth.NewJWKSVerifier(cfg.JWKSURL, cfg.JWKSRefresh, opts)
+	default:
+		return nil, nil
+	}
+}
+
+// serve runs the orders API
+func serve(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	// the receiver is stopped once the providers have flushed to it
+	var traces http.Handler
+	if cfg.Telemetry.ReceiverAddr != "" {
+		receiver, err := telemetry.StartReceiver(cfg.Telemetry.ReceiverAddr, cfg.Telemetry.ReceiverTraces)
+		if err != nil {
+			return fmt.Errorf("start otlp receiver: %w", err)
+		}
+		defer receiver.Stop()
+		cfg.Telemetry.UseReceiver(receiver.Addr())
+		traces = telemetry.TracesHandler(receiver)
+		slog.Info("exporting to the in process otlp receiver", "addr", receiver.Addr())
+	}
+
+	providers, err := setupTelemetry(ctx, cfg.Telemetry)
+	if err != nil {
+		return fmt.Errorf("set up telemetry: %w", err)
+	}
+	defer providers.shutdown(cfg.Telemetry.ShutdownTimeout)
+	spanStream := telemetry.NewSpanStream()
+	providers.tracer.RegisterSpanProcessor(spanStream)
+
+	faults, err := newInjector(cfg)
+	if err != nil {
+		return fmt.Errorf("create fault injector: %w", err)
+	}
+	orderStore, customerStore, outbox, err := newStore(ctx, cfg, faults)
+	if err != nil {
+		return fmt.Errorf("create store: %w", err)
+	}
+	if cfg.Store.Seed > 0 {
+		if err := seed.Run(ctx, orderStore, customerStore, cfg.Store.Seed); err != nil {
+			return fmt.Errorf("seed store: %w", err)
+		}
+		slog.Info("seeded store", "orders", cfg.Store.Seed)
+	}
+
+	holder := config.NewHolder(cfg, args)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go reloadOnHangup(ctx, hangup, holder, providers.logs, providers.sampler)
+
+	if err := validation.Register(); err != nil {
+		return fmt.Errorf("register validators: %w", err)
+	}
+
+	var inventoryClient *inventory.Client
+	if cfg.Inventory.URL != "" {
+		inventoryClient = inventory.NewClient(cfg.Inventory.URL, httpclient.New(cfg.Inventory.Timeout))
+	}
+
+	var paymentsClient *payments.Client
+	if cfg.Payments.URL != "" {
+		paymentsClient = payments.NewClient(cfg.Payments.URL, httpclient.New(cfg.Payments.Timeout))
+	}
+
+	var pricingClient *pricing.Client
+	if cfg.Pricing.NATSURL != "" {
+		nc, err := nats.Connect(cfg.Pricing.NATSURL, nats.Name(cfg.Telemetry.ServiceName))
+		if err != nil {
+			return fmt.Errorf("connect to nats: %w", err)
+		}
+		defer nc.Close()
+		pricingClient = pricing.NewClient(nc, cfg.Pricing.Subject, cfg.Pricing.Timeout)
+	}
+
+	publisher, err := newPublisher(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create event publisher: %w", err)
+	}
+	var (
+		eventPublisher events.Publisher
+		relay          *events.Relay
+	)
+	if publisher != nil {
+		defer publisher.Close()
+		eventPublisher = publisher
+		// with the outbox, the store records the events and the relay
+		// publishes them, so the service must not publish them as well
+		if outbox != nil {
+			relay = events.NewRelay(outbox, publisher, cfg.Events.Outbox.Interval, cfg.Events.Outbox.BatchSize)
+			eventPublisher = nil
+		}
+	}
+
+	watcher, err := newWatcher(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create order watcher: %w", err)
+	}
+	var orderWatcher events.Watcher
+	if watcher != nil {
+		orderWatcher = watcher
+		defer watcher.Close()
+		go func() {
+			if err := watcher.Run(ctx); err != nil {
+				slog.Error("watch order events", "error", err)
+			}
+		}()
+	}
+
+	queue, err := newQueue(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create job queue: %w", err)
+	}
+	var jobQueue jobs.Queue
+	if queue != nil {
+		jobQueue = queue
+		defer queue.Close()
+	}
+
+	idempotencyStore, err := newIdempotencyStore(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create idempotency store: %w", err)
+	}
+	var idempotencyRecords idempotency.Store
+	if idempotencyStore != nil {
+		idempotencyRecords = idempotencyStore
+		defer idempotencyStore.Close()
+	}
+
+	limiter, err := newRateLimiter(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("create rate limiter: %w", err)
+	}
+	if limiter != nil {
+		defer limiter.Close()
+	}
+
+	verifier, err := newVerifier(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("create token verifier: %w", err)
+	}
+	if verifier != nil {
+		defer verifier.Close()
+	}
+
+	exemplarHistogram, err := telemetry.NewExemplarHistogram(cfg.Telemetry)
+	if err != nil {
+		return fmt.Errorf("create exemplar histogram: %w", err)
+	}
+	var exemplars middleware.ExemplarRecorder
+	if exemplarHistogram != nil {
+		exemplars = exemplarHistogram
+	}
+
+	srv, err := app.New(cfg, app.Deps{
+		Store:          orderStore,
+		Customers:      customerStore,
+		Inventory:      inventoryClient,
+		Pricing:        pricingClient,
+		Payments:       paymentsClient,
+		Events:         eventPublisher,
+		Watcher:        orderWatcher,
+		Jobs:           jobQueue,
+		Idempotency:    idempotencyRecords,
+		RateLimiter:    limiter,
+		Chaos:          faults,
+		Verifier:       verifier,
+		TracerProvider: providers.tracer,
+		MeterProvider:  providers.meter,
+		Logger:         slog.Default(),
+		MetricsHandler: telemetry.MetricsHandler(cfg.Telemetry),
+		Exemplars:      exemplars,
+		ExporterCheck: func(ctx context.Context) error {
+			return telemetry.CheckExporter(ctx, cfg.Telemetry)
+		},
+		TelemetryStatus: telemetry.StatusHandler(cfg.Telemetry, providers.sampler),
+		Traces:          traces,
+		SpanStream:      spanStream,
+	})
+	if err != nil {
+		return fmt.Errorf("create server: %w", err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Start()
+	}()
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		if err != nil {
+			err = fmt.Errorf("serve http: %w", err)
+		}
+	}
+	// stop the relay while the store is still open
+	if relay != nil {
+		relay.Close()
+	}
+	if stopErr := srv.Stop(); stopErr != nil {
+		slog.Error("shutdown", "error", stopErr)
+	}
+	return err
+}
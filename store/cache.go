@@ -0,0 +1,245 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cached serves reads from an in-process LRU cache in front of another
+// store. Orders are evicted from the cache when they are written through it,
+// but writes by other instances are only seen once the cached copy expires.
+type Cached struct {
+	OrderStore
+	lru      *lru
+	tracer   trace.Tracer
+	requests instrument.Int64Counter
+}
+
+var _ OrderStore = (*Cached)(nil)
+
+// NewCached caches up to size orders of next for ttl each
+func NewCached(next OrderStore, size int, ttl time.Duration) (*Cached, error) {
+	requests, err := global.Meter("store").Int64Counter("store.cache.requests",
+		instrument.WithUnit("{request}"),
+		instrument.WithDescription("Number of order cache lookups by result"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create cache requests counter: %w", err)
+	}
+	return &Cached{
+		OrderStore: next,
+		lru:        newLRU(size, ttl),
+		tracer:     otel.Tracer("store"),
+		requests:   requests,
+	}, nil
+}
+
+// GetOrder returns the cached order, reading it from the next store on a
+// miss
+func (c *Cached) GetOrder(ctx context.Context, id string) (*db.Order, error) {
+	ctx, span := span.DB(ctx, c.tracer, "cache get", trace.WithAttributes(attribute.String("order.id", id)))
+	defer span.End()
+
+	if o, ok := c.lru.get(id); ok {
+		c.record(ctx, span, true)
+		return o, nil
+	}
+	c.record(ctx, span, false)
+
+	gen := c.lru.generation(id)
+	o, err := c.OrderStore.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.lru.addIfCurrent(o, gen)
+	return o, nil
+}
+
+// Exists reports a cached order as existing without asking the next store
+func (c *Cached) Exists(ctx context.Context, id string) (bool, error) {
+	if _, ok := c.lru.get(id); ok {
+		return true, nil
+	}
+	return c.OrderStore.Exists(ctx, id)
+}
+
+// PutOrder stores the order and evicts its cached copy
+func (c *Cached) PutOrder(ctx context.Context, o *db.Order) error {
+	defer c.lru.remove(o.ID)
+	return c.OrderStore.PutOrder(ctx, o)
+}
+
+// CreateOrder stores the new order and evicts any cached copy of its ID
+func (c *Cached) CreateOrder(ctx context.Context, o *db.Order) error {
+	defer c.lru.remove(o.ID)
+	return c.OrderStore.CreateOrder(ctx, o)
+}
+
+// CreateOrders stores the new orders and evicts any cached copies of their
+// IDs
+func (c *Cached) CreateOrders(ctx context.Context, orders []*db.Order) []error {
+	defer func() {
+		for _, o := range orders {
+			c.lru.remove(o.ID)
+		}
+	}()
+	return CreateOrders(ctx, c.OrderStore, orders)
+}
+
+// Search searches the next store, bypassing the cache
+func (c *Cached) Search(ctx context.Context, q db.Query, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	return SearchOrders(ctx, c.OrderStore, q, cursor, limit)
+}
+
+// SearchText searches the next store for text, bypassing the cache
+func (c *Cached) SearchText(ctx context.Context, text string, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	return SearchText(ctx, c.OrderStore, text, cursor, limit)
+}
+
+// ReserveStock reserves stock for the items in the next store
+func (c *Cached) ReserveStock(ctx context.Context, items []db.Item) error {
+	return ReserveStock(ctx, c.OrderStore, items)
+}
+
+// ReleaseStock releases the stock of the items in the next store
+func (c *Cached) ReleaseStock(ctx context.Context, items []db.Item) error {
+	return ReleaseStock(ctx, c.OrderStore, items)
+}
+
+// UpdateOrder updates the order in the next store and evicts its cached copy
+func (c *Cached) UpdateOrder(ctx context.Context, id string, fn func(*db.Order) error) (*db.Order, error) {
+	defer c.lru.remove(id)
+	return c.OrderStore.UpdateOrder(ctx, id, fn)
+}
+
+// Delete removes the order from the next store and the cache
+func (c *Cached) Delete(ctx context.Context, id string) error {
+	defer c.lru.remove(id)
+	return c.OrderStore.Delete(ctx, id)
+}
+
+func (c *Cached) record(ctx context.Context, span trace.Span, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	span.SetAttributes(attribute.Bool("db.redis.cache_hit", hit))
+	span.AddEvent("cache " + result)
+	c.requests.Add(ctx, 1, attribute.String("cache.result", result))
+}
+
+// generations is the number of generation counters of an lru. IDs share
+// counters by hash, so a write may only make a fill of another ID skip
+// the cache.
+const generations = 256
+
+// lru is a fixed size cache of orders that evicts the least recently used
+// order when full. Entries older than ttl are treated as missing.
+type lru struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+	// gens counts the removals of the IDs hashing to each counter, so a
+	// fill can tell the order was written while it was being read
+	gens [generations]uint64
+}
+
+type lruEntry struct {
+	order   *db.Order
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(id string) (*db.Order, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[id]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		l.order.Remove(el)
+		delete(l.entries, id)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return copyOrder(e.order), true
+}
+
+// generation returns the generation of id, to be passed to addIfCurrent
+// once the order is read
+func (l *lru) generation(id string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gens[genIndex(id)]
+}
+
+// addIfCurrent adds the order unless it was removed since gen was read, as
+// it was then read before a write and may be stale
+func (l *lru) addIfCurrent(o *db.Order, gen uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.gens[genIndex(o.ID)] != gen {
+		return
+	}
+	l.add(o)
+}
+
+// add caches the order. l.mu must be held.
+func (l *lru) add(o *db.Order) {
+	e := &lruEntry{order: copyOrder(o), expires: time.Now().Add(l.ttl)}
+	if el, ok := l.entries[o.ID]; ok {
+		el.Value = e
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[o.ID] = l.order.PushFront(e)
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).order.ID)
+	}
+}
+
+func (l *lru) remove(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gens[genIndex(id)]++
+	if el, ok := l.entries[id]; ok {
+		l.order.Remove(el)
+		delete(l.entries, id)
+	}
+}
+
+// genIndex returns the generation counter of id
+func genIndex(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % generations)
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCachedSpans(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	ctx := context.Background()
+	next := NewMemory()
+	if err := next.CreateOrder(ctx, newOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCached(next, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := tp.Tracer("test").Start(ctx, "test")
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetOrder(ctx, "order-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	span.End()
+
+	parent := tracetest.RequireSpan(t, exporter, "test")
+	miss := tracetest.RequireSpan(t, exporter, "cache get",
+		attribute.Bool("db.redis.cache_hit", false),
+		semconv.DBSystemRedis,
+		semconv.DBOperationKey.String("cache get"),
+		attribute.String("order.id", "order-1"),
+	)
+	hit := tracetest.RequireSpan(t, exporter, "cache get", attribute.Bool("db.redis.cache_hit", true))
+	tracetest.RequireParentChild(t, parent, miss)
+	tracetest.RequireParentChild(t, parent, hit)
+	if miss.SpanKind != trace.SpanKindClient {
+		t.Errorf("cache get kind %s, want client", miss.SpanKind)
+	}
+	tracetest.RequireEvent(t, miss, "cache miss")
+	tracetest.RequireEvent(t, hit, "cache hit")
+	if !miss.StartTime.Before(hit.StartTime) {
+		t.Error("the cache hit came before the miss that filled the cache")
+	}
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/observiq/tracing/db"
+)
+
+var (
+	_ CustomerStore = (*Memory)(nil)
+	_ CustomerStore = (*SQL)(nil)
+
+	_ CustomerBatchGetter = (*Memory)(nil)
+	_ CustomerBatchGetter = (*SQL)(nil)
+	_ CustomerBatchGetter = (*db.Client)(nil)
+)
+
+// GetCustomer returns a copy of the customer with the given ID
+func (m *Memory) GetCustomer(_ context.Context, id string) (*db.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.customers[id]
+	if !ok {
+		return nil, db.ErrCustomerNotFound
+	}
+	copied := *c
+	return &copied, nil
+}
+
+// GetCustomers returns copies of the customers with the given IDs by ID,
+// leaving out those that do not exist
+func (m *Memory) GetCustomers(_ context.Context, ids []string) (map[string]*db.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customers := make(map[string]*db.Customer, len(ids))
+	for _, id := range ids {
+		if c, ok := m.customers[id]; ok {
+			copied := *c
+			customers[id] = &copied
+		}
+	}
+	return customers, nil
+}
+
+// CreateCustomer stores a copy of a new customer, returning
+// db.ErrCustomerExists if the ID is taken
+func (m *Memory) CreateCustomer(_ context.Context, c *db.Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customers[c.ID]; ok {
+		return db.ErrCustomerExists
+	}
+	copied := *c
+	m.customers[c.ID] = &copied
+	return nil
+}
+
+// UpdateCustomer applies fn to a copy of the stored customer and stores the
+// result if fn succeeds
+func (m *Memory) UpdateCustomer(_ context.Context, id string, fn func(*db.Customer) error) (*db.Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.customers[id]
+	if !ok {
+		return nil, db.ErrCustomerNotFound
+	}
+	c := *stored
+	if err := fn(&c); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = time.Now().UTC()
+	copied := c
+	m.customers[id] = &copied
+	return &c, nil
+}
+
+// DeleteCustomer removes the customer with the given ID
+func (m *Memory) DeleteCustomer(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.customers[id]; !ok {
+		return db.ErrCustomerNotFound
+	}
+	delete(m.customers, id)
+	return nil
+}
+
+// ListCustomers returns up to limit customers in ID order, with the offset
+// of the page as the cursor like List
+func (m *Memory) ListCustomers(_ context.Context, cursor uint64, limit int64) ([]*db.Customer, uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.customers))
+	for id := range m.customers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if cursor >= uint64(len(ids)) {
+		return nil, 0, nil
+	}
+	end := cursor + uint64(limit)
+	next := end
+	if end >= uint64(len(ids)) {
+		end, next = uint64(len(ids)), 0
+	}
+	customers := make([]*db.Customer, 0, end-cursor)
+	for _, id := range ids[cursor:end] {
+		copied := *m.customers[id]
+		customers = append(customers, &copied)
+	}
+	return customers, next, nil
+}
+
+const (
+	customerColumns = `id, name, email, created_at, updated_at`
+	selectCustomer  = `SELECT ` + customerColumns + ` FROM customers WHERE id = $1`
+)
+
+// GetCustomer returns the customer with the given ID
+func (s *SQL) GetCustomer(ctx context.Context, id string) (*db.Customer, error) {
+	return scanCustomer(s.db.QueryRowContext(ctx, selectCustomer, id))
+}
+
+// GetCustomers returns the customers with the given IDs by ID in a single
+// query, leaving out those that do not exist
+func (s *SQL) GetCustomers(ctx context.Context, ids []string) (map[string]*db.Customer, error) {
+	customers := make(map[string]*db.Customer, len(ids))
+	if len(ids) == 0 {
+		return customers, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+customerColumns+` FROM customers WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		customers[c.ID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+// CreateCustomer stores a new customer, returning db.ErrCustomerExists if
+// the ID is taken
+func (s *SQL) CreateCustomer(ctx context.Context, c *db.Customer) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO customers (`+customerColumns+`) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO NOTHING`,
+		c.ID, c.Name, c.Email, c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return db.ErrCustomerExists
+	}
+	return nil
+}
+
+// UpdateCustomer applies fn to the stored customer and writes the result
+// back, with the row locked like UpdateOrder
+func (s *SQL) UpdateCustomer(ctx context.Context, id string, fn func(*db.Customer) error) (*db.Customer, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	c, err := scanCustomer(tx.QueryRowContext(ctx, selectCustomer+s.dialect.lockRow, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `UPDATE customers SET name = $1, email = $2, updated_at = $3 WHERE id = $4`,
+		c.Name, c.Email, c.UpdatedAt, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return c, nil
+}
+
+// DeleteCustomer removes the customer with the given ID
+func (s *SQL) DeleteCustomer(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM customers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return db.ErrCustomerNotFound
+	}
+	return nil
+}
+
+// ListCustomers returns up to limit customers in ID order, with the offset
+// of the page as the cursor like List
+func (s *SQL) ListCustomers(ctx context.Context, cursor uint64, limit int64) ([]*db.Customer, uint64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+customerColumns+` FROM customers ORDER BY id LIMIT $1 OFFSET $2`, limit, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var customers []*db.Customer
+	for rows.Next() {
+		c, err := scanCustomer(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		customers = append(customers, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var next uint64
+	if int64(len(customers)) == limit {
+		next = cursor + uint64(limit)
+	}
+	return customers, next, nil
+}
+
+func scanCustomer(row scanner) (*db.Customer, error) {
+	var c db.Customer
+	err := row.Scan(&c.ID, &c.Name, &c.Email, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/db"
+)
+
+// Memory keeps orders and customers in maps. It needs no external services,
+// which makes it suitable for tests and demos, but they are lost on restart.
+type Memory struct {
+	mu        sync.RWMutex
+	orders    map[string]*db.Order
+	customers map[string]*db.Customer
+}
+
+var _ OrderStore = (*Memory)(nil)
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		orders:    make(map[string]*db.Order),
+		customers: make(map[string]*db.Customer),
+	}
+}
+
+// GetOrder returns a copy of the order with the given ID
+func (m *Memory) GetOrder(_ context.Context, id string) (*db.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return copyOrder(o), nil
+}
+
+// PutOrder stores a copy of the order under its ID
+func (m *Memory) PutOrder(_ context.Context, o *db.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.orders[o.ID] = copyOrder(o)
+	return nil
+}
+
+// CreateOrder stores a copy of a new order, returning db.ErrOrderExists if
+// the ID is taken. Stock is not tracked by the in-memory store.
+func (m *Memory) CreateOrder(_ context.Context, o *db.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[o.ID]; ok {
+		return db.ErrOrderExists
+	}
+	m.orders[o.ID] = copyOrder(o)
+	return nil
+}
+
+// UpdateOrder applies fn to a copy of the stored order and stores the result
+// if fn succeeds. The store is locked while fn runs, so updates never
+// conflict.
+func (m *Memory) UpdateOrder(_ context.Context, id string, fn func(*db.Order) error) (*db.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.orders[id]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	o := copyOrder(stored)
+	if err := fn(o); err != nil {
+		return nil, err
+	}
+	o.UpdatedAt = time.Now().UTC()
+	m.orders[id] = copyOrder(o)
+	return o, nil
+}
+
+// Exists reports whether the order with the given ID is stored
+func (m *Memory) Exists(_ context.Context, id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.orders[id]
+	return ok, nil
+}
+
+// Delete removes the order with the given ID
+func (m *Memory) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[id]; !ok {
+		return db.ErrNotFound
+	}
+	delete(m.orders, id)
+	return nil
+}
+
+// List returns up to limit orders in ID order. The cursor is the offset of
+// the page, so orders created or deleted between pages may shift it.
+func (m *Memory) List(_ context.Context, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.orders))
+	for id := range m.orders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if cursor >= uint64(len(ids)) {
+		return nil, 0, nil
+	}
+	end := cursor + uint64(limit)
+	next := end
+	if end >= uint64(len(ids)) {
+		end, next = uint64(len(ids)), 0
+	}
+	orders := make([]*db.Order, 0, end-cursor)
+	for _, id := range ids[cursor:end] {
+		orders = append(orders, copyOrder(m.orders[id]))
+	}
+	return orders, next, nil
+}
+
+// WithLock runs fn without taking a lock, since the store is local to the
+// process and UpdateOrder already holds its mutex while fn runs
+func (m *Memory) WithLock(ctx context.Context, _ string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+// Ping always succeeds
+func (m *Memory) Ping(context.Context) error {
+	return nil
+}
+
+// Close is a no-op; the orders stay readable after it
+func (m *Memory) Close() error {
+	return nil
+}
+
+// copyOrder copies o so callers cannot modify stored orders in place
+func copyOrder(o *db.Order) *db.Order {
+	c := *o
+	c.Items = append([]db.Item(nil), o.Items...)
+	return &c
+}
@@ -0,0 +1,471 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+
+	// register the postgres and sqlite drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dialect holds the SQL that differs between databases
+type dialect struct {
+	driver string
+	system attribute.KeyValue
+	// schema creates the orders table. Items are kept as JSON since they
+	// are always read and written together with their order.
+	schema string
+	// customerSchema creates the customers table
+	customerSchema string
+	// lockRow is appended to the select of UpdateOrder to lock the row
+	lockRow string
+	// outboxSchema creates the table events are recorded in when the outbox
+	// is enabled
+	outboxSchema string
+	// skipLocked is appended to the select of RelayOutbox so concurrent
+	// relays each take different events
+	skipLocked string
+}
+
+var postgres = dialect{
+	driver: "postgres",
+	system: semconv.DBSystemPostgreSQL,
+	schema: `
+CREATE TABLE IF NOT EXISTS orders (
+	id         TEXT PRIMARY KEY,
+	customer   TEXT NOT NULL,
+	currency   TEXT NOT NULL,
+	items      JSONB NOT NULL,
+	total      DOUBLE PRECISION NOT NULL,
+	status     TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`,
+	customerSchema: `
+CREATE TABLE IF NOT EXISTS customers (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	email      TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`,
+	lockRow: ` FOR UPDATE`,
+	outboxSchema: `
+CREATE TABLE IF NOT EXISTS outbox (
+	id         BIGSERIAL PRIMARY KEY,
+	event      JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+)`,
+	skipLocked: ` FOR UPDATE SKIP LOCKED`,
+}
+
+// sqlite declares timestamps as TIMESTAMP so the driver parses them back
+// into times. Rows need no lock as transactions take the write lock up
+// front, which also keeps concurrent relays apart.
+var sqlite = dialect{
+	driver: "sqlite3",
+	system: semconv.DBSystemSqlite,
+	schema: `
+CREATE TABLE IF NOT EXISTS orders (
+	id         TEXT PRIMARY KEY,
+	customer   TEXT NOT NULL,
+	currency   TEXT NOT NULL,
+	items      TEXT NOT NULL,
+	total      REAL NOT NULL,
+	status     TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`,
+	customerSchema: `
+CREATE TABLE IF NOT EXISTS customers (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	email      TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`,
+	outboxSchema: `
+CREATE TABLE IF NOT EXISTS outbox (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	event      TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`,
+}
+
+const (
+	orderColumns = `id, customer, currency, items, total, status, created_at, updated_at`
+	selectOrder  = `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+	insertOrder  = `INSERT INTO orders (` + orderColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	upsertOrder  = insertOrder + ` ON CONFLICT (id) DO UPDATE SET
+	customer = EXCLUDED.customer, currency = EXCLUDED.currency, items = EXCLUDED.items,
+	total = EXCLUDED.total, status = EXCLUDED.status, updated_at = EXCLUDED.updated_at`
+)
+
+// SQL keeps orders and customers in tables of a SQL database. Every query is
+// traced and measured by otelsql, so SQL spans carry the statement that was
+// run.
+type SQL struct {
+	db      *sql.DB
+	dialect dialect
+	// get is prepared once at startup, as it is the most frequent query
+	get *sql.Stmt
+	// outbox records an event in the outbox table with each change
+	outbox bool
+}
+
+var (
+	_ OrderStore    = (*SQL)(nil)
+	_ events.Outbox = (*SQL)(nil)
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// NewPostgres connects to the PostgreSQL database at dsn and creates the
+// orders and customers tables if they do not exist yet
+func NewPostgres(ctx context.Context, dsn string) (*SQL, error) {
+	return openSQL(ctx, postgres, dsn)
+}
+
+// NewSQLite opens the SQLite database file at path, creating it and the
+// orders and customers tables if they do not exist yet
+func NewSQLite(ctx context.Context, path string) (*SQL, error) {
+	// an immediate transaction lock makes concurrent updates wait for each
+	// other instead of failing when they upgrade to a write lock
+	s, err := openSQL(ctx, sqlite, "file:"+path+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, more connections would only contend
+	s.db.SetMaxOpenConns(1)
+	return s, nil
+}
+
+func openSQL(ctx context.Context, d dialect, dsn string) (*SQL, error) {
+	attrs := otelsql.WithAttributes(d.system)
+	conn, err := otelsql.Open(d.driver, dsn, attrs)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", d.driver, err)
+	}
+	if err := otelsql.RegisterDBStatsMetrics(conn, attrs); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("register db stats metrics: %w", err)
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	for _, schema := range []string{d.schema, d.customerSchema} {
+		if _, err := conn.ExecContext(ctx, schema); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("migrate schema: %w", err)
+		}
+	}
+	get, err := conn.PrepareContext(ctx, selectOrder)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("prepare get: %w", err)
+	}
+
+	return &SQL{db: conn, dialect: d, get: get}, nil
+}
+
+// EnableOutbox creates the outbox table and records an event in it in the
+// same transaction as each order created, updated, or deleted, so an event
+// is recorded if and only if its change commits. The events are published
+// by an events.Relay. PutOrder records no event, as it only backs other
+// stores.
+func (s *SQL) EnableOutbox(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.dialect.outboxSchema); err != nil {
+		return fmt.Errorf("migrate outbox schema: %w", err)
+	}
+	s.outbox = true
+	return nil
+}
+
+// GetOrder returns the order with the given ID
+func (s *SQL) GetOrder(ctx context.Context, id string) (*db.Order, error) {
+	return scanOrder(s.get.QueryRowContext(ctx, id))
+}
+
+// PutOrder stores the order under its ID, replacing any existing order
+func (s *SQL) PutOrder(ctx context.Context, o *db.Order) error {
+	args, err := orderArgs(o)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, upsertOrder, args...)
+	return err
+}
+
+// CreateOrder stores a new order, returning db.ErrOrderExists if the ID is
+// taken. Stock is not tracked by the SQL stores.
+func (s *SQL) CreateOrder(ctx context.Context, o *db.Order) error {
+	args, err := orderArgs(o)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, func(ex execer) error {
+		res, err := ex.ExecContext(ctx, insertOrder+` ON CONFLICT (id) DO NOTHING`, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return db.ErrOrderExists
+		}
+		return s.record(ctx, ex, events.OrderCreated, o)
+	})
+}
+
+// UpdateOrder applies fn to the stored order and writes the result back. The
+// row is locked while fn runs, so concurrent updates wait for each other
+// rather than conflicting.
+func (s *SQL) UpdateOrder(ctx context.Context, id string, fn func(*db.Order) error) (*db.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	o, err := scanOrder(tx.QueryRowContext(ctx, selectOrder+s.dialect.lockRow, id))
+	if err != nil {
+		return nil, err
+	}
+	from := o.Status
+	if err := fn(o); err != nil {
+		return nil, err
+	}
+	o.UpdatedAt = time.Now().UTC()
+	args, err := orderArgs(o)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, upsertOrder, args...); err != nil {
+		return nil, err
+	}
+	t := events.OrderUpdated
+	if o.Status != from {
+		t = events.OrderStatusChanged
+	}
+	if err := s.record(ctx, tx, t, o); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return o, nil
+}
+
+// Exists reports whether the order with the given ID is stored
+func (s *SQL) Exists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// Delete removes the order with the given ID
+func (s *SQL) Delete(ctx context.Context, id string) error {
+	return s.write(ctx, func(ex execer) error {
+		res, err := ex.ExecContext(ctx, `DELETE FROM orders WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return db.ErrNotFound
+		}
+		return s.record(ctx, ex, events.OrderDeleted, &db.Order{ID: id})
+	})
+}
+
+// List returns up to limit orders in ID order. The cursor is the offset of
+// the page, so orders created or deleted between pages may shift it.
+func (s *SQL) List(ctx context.Context, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+orderColumns+` FROM orders ORDER BY id LIMIT $1 OFFSET $2`, limit, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var orders []*db.Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var next uint64
+	if int64(len(orders)) == limit {
+		next = cursor + uint64(limit)
+	}
+	return orders, next, nil
+}
+
+// RelayOutbox hands up to limit recorded events to publish in the order they
+// were recorded, removing those published in the same transaction. In
+// postgres the events are locked while they are published, and events
+// locked by another relay are skipped.
+func (s *SQL) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, events.Event) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, event FROM outbox ORDER BY id LIMIT $1`+s.dialect.skipLocked, limit)
+	if err != nil {
+		return 0, err
+	}
+	type recorded struct {
+		id    int64
+		event events.Event
+	}
+	var batch []recorded
+	for rows.Next() {
+		var (
+			r    recorded
+			data []byte
+		)
+		if err := rows.Scan(&r.id, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(data, &r.event); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("decode event %d: %w", r.id, err)
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var (
+		published  int
+		publishErr error
+	)
+	for _, r := range batch {
+		if publishErr = publish(ctx, r.event); publishErr != nil {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, r.id); err != nil {
+			return 0, err
+		}
+		published++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	if publishErr != nil {
+		return published, fmt.Errorf("publish event: %w", publishErr)
+	}
+	return published, nil
+}
+
+// WithLock runs fn without taking a lock, since UpdateOrder already locks
+// the row it updates
+func (s *SQL) WithLock(ctx context.Context, _ string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+// Ping verifies that the database is reachable
+func (s *SQL) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
+}
+
+func (s *SQL) Close() error {
+	return errors.Join(s.get.Close(), s.db.Close())
+}
+
+// write runs fn in a transaction when the outbox is enabled, so the event it
+// records commits with its change, and directly against the database
+// otherwise
+func (s *SQL) write(ctx context.Context, fn func(execer) error) error {
+	if !s.outbox {
+		return fn(s.db)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// record adds an event of type t about the order to the outbox when it is
+// enabled
+func (s *SQL) record(ctx context.Context, ex execer, t events.Type, o *db.Order) error {
+	if !s.outbox {
+		return nil
+	}
+	e := events.NewRecorded(ctx, t, o)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	_, err = ex.ExecContext(ctx, `INSERT INTO outbox (event, created_at) VALUES ($1, $2)`, data, e.Time)
+	return err
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(row scanner) (*db.Order, error) {
+	var (
+		o     db.Order
+		items []byte
+	)
+	err := row.Scan(&o.ID, &o.Customer, &o.Currency, &items, &o.Total, &o.Status, &o.CreatedAt, &o.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(items, &o.Items); err != nil {
+		return nil, fmt.Errorf("decode items: %w", err)
+	}
+	return &o, nil
+}
+
+// orderArgs returns the values of orderColumns for o
+func orderArgs(o *db.Order) ([]any, error) {
+	items, err := json.Marshal(o.Items)
+	if err != nil {
+		return nil, fmt.Errorf("encode items: %w", err)
+	}
+	return []any{o.ID, o.Customer, o.Currency, items, o.Total, o.Status, o.CreatedAt, o.UpdatedAt}, nil
+}
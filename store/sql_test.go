@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/telemetry/tracetest"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newOrder(id string) *db.Order {
+	now := time.Now().UTC()
+	o := &db.Order{ID: id, Customer: "customer-1", Currency: "USD", Status: db.StatusCreated, CreatedAt: now, UpdatedAt: now}
+	o.SetItems([]db.Item{{SKU: "SKU-1", Quantity: 2, Price: 5}})
+	return o
+}
+
+func TestSQLiteSpans(t *testing.T) {
+	tp, exporter := tracetest.Install(t)
+	ctx := context.Background()
+	s, err := NewSQLite(ctx, filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	// leave out the spans of the schema migration
+	exporter.Reset()
+
+	ctx, span := tp.Tracer("test").Start(ctx, "test")
+	if err := s.CreateOrder(ctx, newOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetOrder(ctx, "missing"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("get missing order: got %v, want %v", err, db.ErrNotFound)
+	}
+	span.End()
+
+	parent := tracetest.RequireSpan(t, exporter, "test")
+	var statements []string
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "test" {
+			continue
+		}
+		tracetest.RequireParentChild(t, parent, span)
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("span %s: kind %s, want client", span.Name, span.SpanKind)
+		}
+		if system, _ := tracetest.Attribute(span, semconv.DBSystemKey); system.AsString() != "sqlite" {
+			t.Errorf("span %s: db.system %q, want sqlite", span.Name, system.AsString())
+		}
+		// a missing order is not an error of the database
+		tracetest.RequireStatus(t, span, codes.Unset)
+		if statement, ok := tracetest.Attribute(span, semconv.DBStatementKey); ok {
+			statements = append(statements, statement.AsString())
+		}
+	}
+	if len(statements) != 2 {
+		t.Fatalf("got statements %q, want an insert and a select", statements)
+	}
+}
+
+func TestSQLiteGetCustomers(t *testing.T) {
+	_, exporter := tracetest.Install(t)
+	ctx := context.Background()
+	s, err := NewSQLite(ctx, filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	now := time.Now().UTC()
+	for _, id := range []string{"customer-1", "customer-2"} {
+		if err := s.CreateCustomer(ctx, &db.Customer{ID: id, Name: id, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exporter.Reset()
+
+	customers, err := GetCustomers(ctx, s, []string{"customer-1", "missing", "customer-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(customers) != 2 || customers["customer-1"] == nil || customers["customer-2"] == nil {
+		t.Fatalf("got %v, want customer-1 and customer-2", customers)
+	}
+	var queries int
+	for _, span := range exporter.GetSpans() {
+		if _, ok := tracetest.Attribute(span, semconv.DBStatementKey); ok {
+			queries++
+		}
+	}
+	if queries != 1 {
+		t.Errorf("%d queries, want the customers got in one", queries)
+	}
+}
@@ -0,0 +1,218 @@
+// Package store defines the storage backends orders can be kept in
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/observiq/tracing/db"
+)
+
+// OrderStore persists orders. Implementations return db.ErrNotFound for
+// missing orders and db.ErrConflict when an update keeps racing with other
+// writers, so handlers can map errors the same way for every backend.
+type OrderStore interface {
+	// GetOrder returns the order with the given ID
+	GetOrder(ctx context.Context, id string) (*db.Order, error)
+	// PutOrder stores the order under its ID, replacing any existing order
+	PutOrder(ctx context.Context, o *db.Order) error
+	// CreateOrder stores a new order, returning db.ErrOrderExists if the ID
+	// is taken
+	CreateOrder(ctx context.Context, o *db.Order) error
+	// UpdateOrder applies fn to the stored order and writes the result back
+	UpdateOrder(ctx context.Context, id string, fn func(*db.Order) error) (*db.Order, error)
+	// Exists reports whether the order with the given ID is stored
+	Exists(ctx context.Context, id string) (bool, error)
+	// Delete removes the order with the given ID
+	Delete(ctx context.Context, id string) error
+	// List returns a page of orders starting at cursor and the cursor of
+	// the next page, which is 0 once every order has been listed
+	List(ctx context.Context, cursor uint64, limit int64) ([]*db.Order, uint64, error)
+	// WithLock runs fn while holding an exclusive lock on key. Backends
+	// whose updates cannot race across instances may simply run fn.
+	WithLock(ctx context.Context, key string, fn func(context.Context) error) error
+	// Ping verifies that the backend is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// CustomerStore persists customers. Every order store backend is also a
+// customer store, keeping customers next to the orders. Implementations
+// return db.ErrCustomerNotFound for missing customers.
+type CustomerStore interface {
+	// GetCustomer returns the customer with the given ID
+	GetCustomer(ctx context.Context, id string) (*db.Customer, error)
+	// CreateCustomer stores a new customer, returning db.ErrCustomerExists
+	// if the ID is taken
+	CreateCustomer(ctx context.Context, c *db.Customer) error
+	// UpdateCustomer applies fn to the stored customer and writes the
+	// result back
+	UpdateCustomer(ctx context.Context, id string, fn func(*db.Customer) error) (*db.Customer, error)
+	// DeleteCustomer removes the customer with the given ID
+	DeleteCustomer(ctx context.Context, id string) error
+	// ListCustomers returns a page of customers starting at cursor and the
+	// cursor of the next page, which is 0 once every customer has been
+	// listed
+	ListCustomers(ctx context.Context, cursor uint64, limit int64) ([]*db.Customer, uint64, error)
+}
+
+// BatchCreator is implemented by stores that can create many orders in one
+// round trip
+type BatchCreator interface {
+	// CreateOrders stores new orders like CreateOrder, returning the error
+	// of each order by index, nil for those stored
+	CreateOrders(ctx context.Context, orders []*db.Order) []error
+}
+
+// CreateOrders creates the orders in one round trip when s is a
+// BatchCreator, or one at a time otherwise. It returns the error of each
+// order by index.
+func CreateOrders(ctx context.Context, s OrderStore, orders []*db.Order) []error {
+	if b, ok := s.(BatchCreator); ok {
+		return b.CreateOrders(ctx, orders)
+	}
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		errs[i] = s.CreateOrder(ctx, o)
+	}
+	return errs
+}
+
+// CustomerBatchGetter is implemented by stores that can get many customers
+// in one round trip
+type CustomerBatchGetter interface {
+	// GetCustomers returns the customers with the given IDs by ID, leaving
+	// out those that do not exist
+	GetCustomers(ctx context.Context, ids []string) (map[string]*db.Customer, error)
+}
+
+// GetCustomers returns the customers with the given IDs by ID, leaving out
+// those that do not exist. It gets them in one round trip when s is a
+// CustomerBatchGetter, or one at a time otherwise.
+func GetCustomers(ctx context.Context, s CustomerStore, ids []string) (map[string]*db.Customer, error) {
+	if b, ok := s.(CustomerBatchGetter); ok {
+		return b.GetCustomers(ctx, ids)
+	}
+	customers := make(map[string]*db.Customer, len(ids))
+	for _, id := range ids {
+		c, err := s.GetCustomer(ctx, id)
+		if errors.Is(err, db.ErrCustomerNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		customers[id] = c
+	}
+	return customers, nil
+}
+
+// scanPageSize is the page size stores are scanned with when searching
+// without an index
+const scanPageSize = 100
+
+// Searcher is implemented by stores that index orders by their fields
+type Searcher interface {
+	// Search returns a page of the orders selected by a non-empty query,
+	// with the same cursor semantics as SearchOrders
+	Search(ctx context.Context, q db.Query, cursor uint64, limit int64) ([]*db.Order, uint64, error)
+}
+
+// SearchOrders returns a page of the orders selected by a non-empty query
+// and the cursor of the next page, which is 0 once every match has been
+// returned. Stores that are not a Searcher are scanned in full, and the
+// cursor counts the matches skipped.
+func SearchOrders(ctx context.Context, s OrderStore, q db.Query, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	if searcher, ok := s.(Searcher); ok {
+		return searcher.Search(ctx, q, cursor, limit)
+	}
+
+	var (
+		page    []*db.Order
+		matched uint64
+		scan    uint64
+	)
+	for {
+		orders, next, err := s.List(ctx, scan, scanPageSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, o := range orders {
+			if !q.Matches(o) {
+				continue
+			}
+			matched++
+			if matched <= cursor {
+				continue
+			}
+			if int64(len(page)) == limit {
+				return page, cursor + uint64(limit), nil
+			}
+			page = append(page, o)
+		}
+		if next == 0 {
+			return page, 0, nil
+		}
+		scan = next
+	}
+}
+
+// TextSearcher is implemented by stores with full text search
+type TextSearcher interface {
+	// SearchText returns a page of the orders matching text and the cursor
+	// of the next page, which is 0 once every match has been returned
+	SearchText(ctx context.Context, text string, cursor uint64, limit int64) ([]*db.Order, uint64, error)
+}
+
+// SearchText searches the orders of s for text, returning
+// db.ErrSearchUnsupported if s is not a TextSearcher
+func SearchText(ctx context.Context, s OrderStore, text string, cursor uint64, limit int64) ([]*db.Order, uint64, error) {
+	searcher, ok := s.(TextSearcher)
+	if !ok {
+		return nil, 0, db.ErrSearchUnsupported
+	}
+	return searcher.SearchText(ctx, text, cursor, limit)
+}
+
+// StockReleaser is implemented by stores that reserve stock as orders are
+// created
+type StockReleaser interface {
+	// ReleaseStock returns the stock reserved for the items
+	ReleaseStock(ctx context.Context, items []db.Item) error
+}
+
+// StockReserver is implemented by stores that can reserve stock for the
+// items added to an existing order
+type StockReserver interface {
+	// ReserveStock reserves stock for the items, or returns
+	// db.ErrOutOfStock reserving none
+	ReserveStock(ctx context.Context, items []db.Item) error
+}
+
+// ReserveStock reserves stock for the items when s is a StockReserver.
+// Other stores track no stock, so there is nothing to do.
+func ReserveStock(ctx context.Context, s OrderStore, items []db.Item) error {
+	if r, ok := s.(StockReserver); ok {
+		return r.ReserveStock(ctx, items)
+	}
+	return nil
+}
+
+// ReleaseStock returns the stock reserved for the items when s is a
+// StockReleaser. Other stores reserve no stock, so there is nothing to do.
+func ReleaseStock(ctx context.Context, s OrderStore, items []db.Item) error {
+	if r, ok := s.(StockReleaser); ok {
+		return r.ReleaseStock(ctx, items)
+	}
+	return nil
+}
+
+var (
+	_ OrderStore    = (*db.Client)(nil)
+	_ CustomerStore = (*db.Client)(nil)
+	_ BatchCreator  = (*db.Client)(nil)
+	_ Searcher      = (*db.Client)(nil)
+	_ TextSearcher  = (*db.Client)(nil)
+	_ StockReleaser = (*db.Client)(nil)
+	_ StockReserver = (*db.Client)(nil)
+)
@@ -0,0 +1,325 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/telemetry/span"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchPutter is implemented by stores that can write several orders in
+// one round trip, like the redis client
+type batchPutter interface {
+	SetMany(ctx context.Context, orders []*db.Order) error
+}
+
+// WriteBehind acknowledges writes once they are buffered in memory and
+// flushes them to the next store in batches from a background worker. Reads
+// of a buffered order see the buffered version, but List only sees flushed
+// orders, and writes not yet flushed are lost if the process dies. Orders
+// created through it are flushed with a plain put, so the redis store does
+// not reserve their stock.
+//
+// Every buffered write is recorded as a producer span, and the consumer span
+// of the flush that persists it links back to it, so the asynchronous write
+// can be followed from the request that made it.
+type WriteBehind struct {
+	OrderStore
+	interval  time.Duration
+	batchSize int
+	tracer    trace.Tracer
+
+	// updateMu serializes CreateOrder and UpdateOrder so read-modify-write
+	// cycles of the same order cannot interleave
+	updateMu sync.Mutex
+	mu       sync.Mutex
+	pending  map[string]*pendingWrite
+	// inflight is the batch being flushed, still read until it is written
+	inflight map[string]*pendingWrite
+	// deleted holds the orders of the inflight batch deleted while it was
+	// being written, which the flush deletes again once it is
+	deleted map[string]struct{}
+
+	flushNow chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// maxPendingLinks bounds the spans a pending write links to, so an order
+// written again and again while flushes fail does not grow without bound.
+// The latest writes are kept.
+const maxPendingLinks = 32
+
+// pendingWrite is the latest buffered version of an order along with the
+// spans of the latest writes that produced it
+type pendingWrite struct {
+	order *db.Order
+	links []trace.Link
+}
+
+var _ OrderStore = (*WriteBehind)(nil)
+
+// NewWriteBehind buffers writes to next, flushing them every interval or
+// once batchSize orders are buffered
+func NewWriteBehind(next OrderStore, interval time.Duration, batchSize int) *WriteBehind {
+	w := &WriteBehind{
+		OrderStore: next,
+		interval:   interval,
+		batchSize:  batchSize,
+		tracer:     otel.Tracer("store"),
+		pending:    make(map[string]*pendingWrite),
+		deleted:    make(map[string]struct{}),
+		flushNow:   make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// GetOrder returns the buffered version of the order if there is one
+func (w *WriteBehind) GetOrder(ctx context.Context, id string) (*db.Order, error) {
+	o, ok, deleted := w.buffered(id)
+	if deleted {
+		return nil, db.ErrNotFound
+	}
+	if ok {
+		return o, nil
+	}
+	return w.OrderStore.GetOrder(ctx, id)
+}
+
+// Exists reports buffered orders as existing
+func (w *WriteBehind) Exists(ctx context.Context, id string) (bool, error) {
+	_, ok, deleted := w.buffered(id)
+	if deleted {
+		return false, nil
+	}
+	if ok {
+		return true, nil
+	}
+	return w.OrderStore.Exists(ctx, id)
+}
+
+// PutOrder buffers the order
+func (w *WriteBehind) PutOrder(ctx context.Context, o *db.Order) error {
+	w.enqueue(ctx, o)
+	return nil
+}
+
+// CreateOrder buffers the new order, returning db.ErrOrderExists if an order
+// with its ID is buffered or stored. It holds updateMu, so a concurrent
+// create of the same order cannot pass the check as well.
+func (w *WriteBehind) CreateOrder(ctx context.Context, o *db.Order) error {
+	w.updateMu.Lock()
+	defer w.updateMu.Unlock()
+
+	exists, err := w.Exists(ctx, o.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return db.ErrOrderExists
+	}
+	w.enqueue(ctx, o)
+	return nil
+}
+
+// UpdateOrder applies fn to the buffered or stored order and buffers the
+// result
+func (w *WriteBehind) UpdateOrder(ctx context.Context, id string, fn func(*db.Order) error) (*db.Order, error) {
+	w.updateMu.Lock()
+	defer w.updateMu.Unlock()
+
+	o, err := w.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(o); err != nil {
+		return nil, err
+	}
+	o.UpdatedAt = time.Now().UTC()
+	w.enqueue(ctx, o)
+	return o, nil
+}
+
+// Delete drops any buffered write of the order and deletes it from the next
+// store. When the order is being flushed, the flush deletes it again once it
+// is written, as the write may land after this delete.
+func (w *WriteBehind) Delete(ctx context.Context, id string) error {
+	w.mu.Lock()
+	_, wasPending := w.pending[id]
+	delete(w.pending, id)
+	_, inflight := w.inflight[id]
+	if inflight {
+		w.deleted[id] = struct{}{}
+	}
+	wasBuffered := wasPending || inflight
+	w.mu.Unlock()
+
+	err := w.OrderStore.Delete(ctx, id)
+	if wasBuffered && errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Close flushes the buffered writes before closing the next store
+func (w *WriteBehind) Close() error {
+	close(w.stop)
+	<-w.done
+	return w.OrderStore.Close()
+}
+
+// buffered returns the latest buffered version of the order, pending or
+// being flushed. deleted is set when the order was deleted while being
+// flushed, so the next store may briefly hold it again.
+func (w *WriteBehind) buffered(id string) (o *db.Order, ok, deleted bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if pw, ok := w.pending[id]; ok {
+		return copyOrder(pw.order), true, false
+	}
+	if _, ok := w.deleted[id]; ok {
+		return nil, false, true
+	}
+	if pw, ok := w.inflight[id]; ok {
+		return copyOrder(pw.order), true, false
+	}
+	return nil, false, false
+}
+
+// enqueue buffers a copy of the order, waking the worker once a full batch
+// is buffered
+func (w *WriteBehind) enqueue(ctx context.Context, o *db.Order) {
+	_, span := span.DB(ctx, w.tracer, "write behind enqueue",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("order.id", o.ID)),
+	)
+	defer span.End()
+
+	w.mu.Lock()
+	// the order was created again since it was deleted
+	delete(w.deleted, o.ID)
+	pw, ok := w.pending[o.ID]
+	if !ok {
+		pw = &pendingWrite{}
+		w.pending[o.ID] = pw
+	}
+	pw.order = copyOrder(o)
+	if len(pw.links) == maxPendingLinks {
+		pw.links = pw.links[1:]
+	}
+	pw.links = append(pw.links, trace.Link{SpanContext: span.SpanContext()})
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flushNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *WriteBehind) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flushNow:
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush writes every buffered order to the next store. Orders that fail to
+// be written are buffered again unless they were written to or deleted
+// since. The batch is read by GetOrder until it is written, and orders
+// deleted meanwhile are deleted again after.
+func (w *WriteBehind) flush() {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make(map[string]*pendingWrite)
+	w.inflight = batch
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	orders := make([]*db.Order, 0, len(batch))
+	var links []trace.Link
+	for _, pw := range batch {
+		orders = append(orders, pw.order)
+		links = append(links, pw.links...)
+	}
+	ctx, span := span.DB(context.Background(), w.tracer, "write behind flush",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(orders))),
+	)
+	defer span.End()
+
+	err := w.write(ctx, orders)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		otel.Handle(fmt.Errorf("flush buffered orders: %w", err))
+	}
+
+	w.mu.Lock()
+	deleted := make([]string, 0, len(w.deleted))
+	for id := range w.deleted {
+		deleted = append(deleted, id)
+	}
+	w.mu.Unlock()
+	for _, id := range deleted {
+		if err := w.OrderStore.Delete(ctx, id); err != nil && !errors.Is(err, db.ErrNotFound) {
+			span.RecordError(err)
+			otel.Handle(fmt.Errorf("delete flushed order %s: %w", id, err))
+		}
+	}
+	span.SetAttributes(attribute.Int("batch.deleted", len(deleted)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		for id, pw := range batch {
+			_, pending := w.pending[id]
+			_, deleted := w.deleted[id]
+			if !pending && !deleted {
+				w.pending[id] = pw
+			}
+		}
+	}
+	w.inflight = nil
+	w.deleted = make(map[string]struct{})
+}
+
+func (w *WriteBehind) write(ctx context.Context, orders []*db.Order) error {
+	if bp, ok := w.OrderStore.(batchPutter); ok {
+		return bp.SetMany(ctx, orders)
+	}
+	var errs []error
+	for _, o := range orders {
+		if err := w.OrderStore.PutOrder(ctx, o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observiq/tracing/db"
+)
+
+// slowExists is a store whose Exists takes a round trip, as redis does
+type slowExists struct {
+	OrderStore
+}
+
+func (s slowExists) Exists(ctx context.Context, id string) (bool, error) {
+	time.Sleep(10 * time.Millisecond)
+	return s.OrderStore.Exists(ctx, id)
+}
+
+func TestWriteBehindCreateOrderOnce(t *testing.T) {
+	ctx := context.Background()
+	w := NewWriteBehind(slowExists{NewMemory()}, time.Hour, 100)
+	defer w.Close()
+
+	// creates of the same order racing each other, of which only one wins
+	const creates = 10
+	errs := make(chan error, creates)
+	var wg sync.WaitGroup
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- w.CreateOrder(ctx, newOrder("order-1"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var created int
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, db.ErrOrderExists):
+			t.Fatal(err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d creates succeeded, want 1", created)
+	}
+}
@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// baggageProcessor copies selected baggage entries onto every span as it
+// starts, so attributes such as customer.id appear on the database spans of
+// a request without each call site setting them
+type baggageProcessor struct {
+	keys []string
+}
+
+func newBaggageProcessor(keys string) *baggageProcessor {
+	return &baggageProcessor{keys: splitKeys(keys)}
+}
+
+func (p *baggageProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	bag := baggage.FromContext(ctx)
+	for _, key := range p.keys {
+		if m := bag.Member(key); m.Key() != "" {
+			s.SetAttributes(attribute.String(key, m.Value()))
+		}
+	}
+}
+
+func (p *baggageProcessor) OnEnd(s trace.ReadOnlySpan) {}
+
+func (p *baggageProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *baggageProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporterKey names the exporter the spans counted were meant for
+const exporterKey = attribute.Key("exporter")
+
+// newBatchProcessor creates a batch span processor exporting to the named
+// exporter with the batching settings of the config. The spans it exports,
+// fails to export, and drops because its queue is full are counted by
+// exporter, and its state is reported by StatusHandler.
+func newBatchProcessor(exporter trace.SpanExporter, cfg Config, name string) (trace.SpanProcessor, error) {
+	status := &exporterStatus{name: name, maxQueued: int64(cfg.BatchMaxQueueSize)}
+	if err := status.instrument(global.Meter("telemetry")); err != nil {
+		return nil, err
+	}
+	statuses.add(status)
+
+	p := &boundedProcessor{status: status}
+	// the batch span processor drops the spans beyond its queue silently, so
+	// the bound is kept here and the spans waiting in the batch it is
+	// filling count towards it too
+	p.SpanProcessor = trace.NewBatchSpanProcessor(countingExporter{exporter, status},
+		trace.WithMaxQueueSize(cfg.BatchMaxQueueSize),
+		trace.WithMaxExportBatchSize(cfg.BatchMaxExportSize),
+		trace.WithBatchTimeout(cfg.BatchScheduleDelay),
+		trace.WithExportTimeout(cfg.BatchExportTimeout),
+	)
+	return p, nil
+}
+
+// boundedProcessor drops and counts the sampled spans that end while
+// maxQueued of them are waiting to be exported by the batch span processor
+// it wraps
+type boundedProcessor struct {
+	trace.SpanProcessor
+	status *exporterStatus
+}
+
+func (p *boundedProcessor) OnEnd(s trace.ReadOnlySpan) {
+	// the batch span processor ignores the spans that are not sampled
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if !p.status.enqueue() {
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// countingExporter takes the spans it exports off the count of spans
+// waiting to be exported, and records how the export went
+type countingExporter struct {
+	trace.SpanExporter
+	status *exporterStatus
+}
+
+func (e countingExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	e.status.dequeue(len(spans))
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.status.exported(ctx, len(spans), err)
+	// the degrading exporter logs the endpoint going down once, rather than
+	// the error handler logging every batch dropped meanwhile
+	if errors.Is(err, errExporterUnavailable) {
+		return nil
+	}
+	return err
+}
+
+// multiProcessor hands every span to each of its processors
+type multiProcessor []trace.SpanProcessor
+
+func (m multiProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	for _, p := range m {
+		p.OnStart(ctx, s)
+	}
+}
+
+func (m multiProcessor) OnEnd(s trace.ReadOnlySpan) {
+	for _, p := range m {
+		p.OnEnd(s)
+	}
+}
+
+func (m multiProcessor) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, p := range m {
+		errs = append(errs, p.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiProcessor) ForceFlush(ctx context.Context) error {
+	var errs []error
+	for _, p := range m {
+		errs = append(errs, p.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
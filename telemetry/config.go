@@ -0,0 +1,563 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Exporter names accepted by Config.Exporter, modelled on OTEL_TRACES_EXPORTER
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterJaeger = "jaeger"
+	ExporterZipkin = "zipkin"
+	ExporterNone   = "none"
+)
+
+// OTLP protocols accepted by Config.Protocol, modelled on OTEL_EXPORTER_OTLP_PROTOCOL
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// Sampler names accepted by Config.Sampler, modelled on OTEL_TRACES_SAMPLER
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	// SamplerErrorBiased keeps every trace whose root span errors and
+	// SamplerArg of the successful ones
+	SamplerErrorBiased = "error_biased"
+)
+
+// Config configures how telemetry is sampled and exported
+type Config struct {
+	// ServiceName is reported as service.name on every signal
+	ServiceName string `yaml:"service_name"`
+
+	// Exporter is a comma separated list of the span exporters, any of the
+	// Exporter* constants, or none. Each is sent every span.
+	Exporter string `yaml:"traces_exporter"`
+	// Protocol selects the OTLP transport when Exporter is otlp
+	Protocol string `yaml:"otlp_protocol"`
+	// Endpoint is the destination of the otlp exporter, or of the jaeger or
+	// zipkin exporter when otlp is not selected. When empty the exporter's
+	// conventional local default is used. An OTLP endpoint is either a host
+	// and port or a URL, whose scheme decides whether TLS is used and whose
+	// path, over HTTP, is the base that /v1/traces is sent to.
+	Endpoint string `yaml:"otlp_endpoint"`
+	// TracesEndpoint replaces Endpoint for the spans of the otlp exporter
+	// when set. As OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is, a URL is used as
+	// is, with no /v1/traces appended to its path.
+	TracesEndpoint string `yaml:"otlp_traces_endpoint"`
+	// MetricsEndpoint and LogsEndpoint replace Endpoint for the metrics and
+	// logs, which are only exported over OTLP gRPC, when set. Of a URL only
+	// the host and port are used.
+	MetricsEndpoint string `yaml:"otlp_metrics_endpoint"`
+	LogsEndpoint    string `yaml:"otlp_logs_endpoint"`
+	Insecure        bool   `yaml:"otlp_insecure"`
+	CAFile          string `yaml:"otlp_ca_file"`
+	CertFile        string `yaml:"otlp_cert_file"`
+	KeyFile         string `yaml:"otlp_key_file"`
+
+	// RetryEnabled retries the OTLP exports that fail with a retryable
+	// error, backing off exponentially from RetryInitialInterval up to
+	// RetryMaxInterval between attempts, until RetryMaxElapsedTime has passed
+	RetryEnabled         bool          `yaml:"otlp_retry_enabled"`
+	RetryInitialInterval time.Duration `yaml:"otlp_retry_initial_interval"`
+	RetryMaxInterval     time.Duration `yaml:"otlp_retry_max_interval"`
+	RetryMaxElapsedTime  time.Duration `yaml:"otlp_retry_max_elapsed_time"`
+
+	// KeepaliveTime is how long the gRPC connection to the collector may be
+	// idle before it is pinged, or 0 to never ping it. A connection whose
+	// ping is not answered within KeepaliveTimeout is closed.
+	KeepaliveTime    time.Duration `yaml:"otlp_keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"otlp_keepalive_timeout"`
+	// KeepalivePermitWithoutStream pings the connection even while no
+	// export is in flight
+	KeepalivePermitWithoutStream bool `yaml:"otlp_keepalive_permit_without_stream"`
+
+	// Propagators is a comma separated list of the context propagation
+	// formats, any of the Propagator* constants, or none
+	Propagators string `yaml:"propagators"`
+
+	// BaggageKeys is a comma separated list of baggage entries copied onto
+	// every span as attributes
+	BaggageKeys string `yaml:"baggage_keys"`
+
+	// FilterSpans is a comma separated list of rules dropping the spans they
+	// match before export. A rule is a list of KEY=VALUE conditions joined
+	// by &, where the key name matches the span name and any other key the
+	// attribute of that key. A value ending in * matches every value with
+	// its prefix.
+	FilterSpans string `yaml:"filter_spans"`
+
+	// RedactAttributes is a comma separated list of the span attribute keys
+	// whose values are redacted before spans are exported. A key ending in *
+	// matches every key with its prefix.
+	RedactAttributes string `yaml:"redact_attributes"`
+	// RedactAllowAttributes, when set, is a comma separated list of the only
+	// span attribute keys whose values are exported as they are
+	RedactAllowAttributes string `yaml:"redact_allow_attributes"`
+	// RedactMode selects how values are redacted, one of the Redact*
+	// constants
+	RedactMode string `yaml:"redact_mode"`
+
+	// Sampler selects the sampler, one of the Sampler* constants
+	Sampler string `yaml:"traces_sampler"`
+	// SamplerArg is the sampling fraction used by the ratio based and error
+	// biased samplers
+	SamplerArg float64 `yaml:"traces_sampler_arg"`
+	// SamplerRoutes is a comma separated list of rules overriding the
+	// sampler for the requests to some routes, as "[METHOD ]ROUTE=DECISION"
+	// where the decision is always, never or a sampling fraction. A route
+	// ending in * matches every route with its prefix. The first matching
+	// rule applies. The health, readiness, version and metrics endpoints are
+	// not traced, so they need no rule.
+	SamplerRoutes string `yaml:"traces_sampler_routes"`
+
+	// IDGenerator selects how trace and span IDs are made, one of the
+	// IDGenerator* constants
+	IDGenerator string `yaml:"id_generator"`
+
+	// BatchMaxQueueSize is how many ended spans may wait to be exported.
+	// Spans ending while the queue is full are dropped.
+	BatchMaxQueueSize int `yaml:"bsp_max_queue_size"`
+	// BatchMaxExportSize is the most spans exported at once
+	BatchMaxExportSize int `yaml:"bsp_max_export_batch_size"`
+	// BatchScheduleDelay is the longest ended spans wait before they are
+	// exported
+	BatchScheduleDelay time.Duration `yaml:"bsp_schedule_delay"`
+	// BatchExportTimeout bounds how long an export may take before it is
+	// abandoned
+	BatchExportTimeout time.Duration `yaml:"bsp_export_timeout"`
+
+	// ReconnectInterval is how often the endpoint of an exporter is probed.
+	// Spans are dropped rather than exported while it is unreachable.
+	ReconnectInterval time.Duration `yaml:"exporter_reconnect_interval"`
+
+	// MetricsExporter is a comma separated list of metric exporters, any of
+	// otlp and prometheus, or none
+	MetricsExporter string `yaml:"metrics_exporter"`
+	// MetricsInterval is how often metrics are pushed to the otlp exporter
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	// RuntimeMetricsInterval is the minimum interval between reads of the Go
+	// runtime memory statistics
+	RuntimeMetricsInterval time.Duration `yaml:"runtime_metrics_interval"`
+
+	// LogsExporter selects the log exporter, either otlp or none
+	LogsExporter string `yaml:"logs_exporter"`
+	// LogLevel is the minimum level of records that are logged
+	LogLevel slog.Level `yaml:"log_level"`
+
+	// ResourceDetectors is a comma separated list of the detectors
+	// describing where the process runs, any of the Detector* constants,
+	// or none
+	ResourceDetectors string `yaml:"resource_detectors"`
+
+	// ReceiverAddr, when set, is the address of an OTLP gRPC receiver run in
+	// process, which every signal is exported to in place of a collector.
+	// The spans it receives are served at /debug/traces on the admin
+	// listener, so the example can be explored without a backend.
+	ReceiverAddr string `yaml:"debug_receiver_addr"`
+	// ReceiverTraces is how many of the most recent traces the receiver
+	// keeps
+	ReceiverTraces int `yaml:"debug_receiver_traces"`
+
+	// ShutdownTimeout bounds how long buffered spans are flushed for when
+	// the process exits
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DefaultConfig returns the config used when nothing is overridden
+func DefaultConfig() Config {
+	return Config{
+		ServiceName:            "ourservice",
+		Exporter:               ExporterOTLP,
+		Protocol:               ProtocolGRPC,
+		Insecure:               true,
+		RetryEnabled:           true,
+		RetryInitialInterval:   5 * time.Second,
+		RetryMaxInterval:       30 * time.Second,
+		RetryMaxElapsedTime:    time.Minute,
+		KeepaliveTimeout:       20 * time.Second,
+		Propagators:            PropagatorTraceContext + "," + PropagatorBaggage,
+		BaggageKeys:            "customer.id,tenant.id",
+		RedactMode:             RedactMask,
+		Sampler:                SamplerParentBasedAlwaysOn,
+		SamplerArg:             1,
+		IDGenerator:            IDGeneratorRandom,
+		BatchMaxQueueSize:      2048,
+		BatchMaxExportSize:     512,
+		BatchScheduleDelay:     5 * time.Second,
+		BatchExportTimeout:     30 * time.Second,
+		ReconnectInterval:      10 * time.Second,
+		MetricsExporter:        ExporterOTLP,
+		MetricsInterval:        time.Minute,
+		RuntimeMetricsInterval: 15 * time.Second,
+		LogsExporter:           ExporterOTLP,
+		LogLevel:               slog.LevelInfo,
+		ResourceDetectors:      "env,host,process,container,k8s",
+		ReceiverTraces:         100,
+		ShutdownTimeout:        5 * time.Second,
+	}
+}
+
+// RegisterFlags binds the config to command line flags. Environment
+// variables take precedence over the current values as the flag defaults.
+// The standard OTEL_* variables are honored, and take precedence over the
+// older names this example read before.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ServiceName, "service-name", serviceNameOrDefault(c.ServiceName), "service.name reported on every signal")
+	fs.StringVar(&c.Exporter, "traces-exporter", envOrDefault("OTEL_TRACES_EXPORTER", c.Exporter), "comma separated span exporters: otlp, stdout, jaeger, zipkin or none")
+	fs.StringVar(&c.Protocol, "otlp-protocol", envOrDefault("OTEL_EXPORTER_OTLP_PROTOCOL", c.Protocol), "OTLP protocol: grpc or http/protobuf")
+	fs.StringVar(&c.Endpoint, "otlp-endpoint", envOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", envOrDefault("OTLP_ENDPOINT", c.Endpoint)), "exporter endpoint as a host and port or a URL, defaults to the exporter's local default")
+	fs.StringVar(&c.TracesEndpoint, "otlp-traces-endpoint", envOrDefault("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", c.TracesEndpoint), "OTLP endpoint of spans, replacing -otlp-endpoint; a URL is used as is")
+	fs.StringVar(&c.MetricsEndpoint, "otlp-metrics-endpoint", envOrDefault("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", c.MetricsEndpoint), "OTLP gRPC endpoint of metrics, replacing -otlp-endpoint")
+	fs.StringVar(&c.LogsEndpoint, "otlp-logs-endpoint", envOrDefault("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", c.LogsEndpoint), "OTLP gRPC endpoint of logs, replacing -otlp-endpoint")
+	fs.BoolVar(&c.Insecure, "otlp-insecure", envBoolOrDefault("OTEL_EXPORTER_OTLP_INSECURE", envBoolOrDefault("OTLP_INSECURE", c.Insecure)), "disable TLS when connecting to the collector, unless the endpoint is a URL")
+	fs.StringVar(&c.CAFile, "otlp-ca-file", envOrDefault("OTEL_EXPORTER_OTLP_CERTIFICATE", envOrDefault("OTLP_CA_FILE", c.CAFile)), "CA certificate used to verify the collector")
+	fs.StringVar(&c.CertFile, "otlp-cert-file", envOrDefault("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", envOrDefault("OTLP_CERT_FILE", c.CertFile)), "client certificate for mTLS with the collector")
+	fs.StringVar(&c.KeyFile, "otlp-key-file", envOrDefault("OTEL_EXPORTER_OTLP_CLIENT_KEY", envOrDefault("OTLP_KEY_FILE", c.KeyFile)), "client key for mTLS with the collector")
+	fs.BoolVar(&c.RetryEnabled, "otlp-retry-enabled", envBoolOrDefault("OTLP_RETRY_ENABLED", c.RetryEnabled), "retry OTLP exports that fail with a retryable error")
+	fs.DurationVar(&c.RetryInitialInterval, "otlp-retry-initial-interval", envDurationOrDefault("OTLP_RETRY_INITIAL_INTERVAL", c.RetryInitialInterval), "wait before the first retry of an OTLP export")
+	fs.DurationVar(&c.RetryMaxInterval, "otlp-retry-max-interval", envDurationOrDefault("OTLP_RETRY_MAX_INTERVAL", c.RetryMaxInterval), "longest wait between retries of an OTLP export")
+	fs.DurationVar(&c.RetryMaxElapsedTime, "otlp-retry-max-elapsed-time", envDurationOrDefault("OTLP_RETRY_MAX_ELAPSED_TIME", c.RetryMaxElapsedTime), "time after which a failing OTLP export is given up")
+	fs.DurationVar(&c.KeepaliveTime, "otlp-keepalive-time", envDurationOrDefault("OTLP_KEEPALIVE_TIME", c.KeepaliveTime), "idle time after which the gRPC connection to the collector is pinged, 0 disables pings")
+	fs.DurationVar(&c.KeepaliveTimeout, "otlp-keepalive-timeout", envDurationOrDefault("OTLP_KEEPALIVE_TIMEOUT", c.KeepaliveTimeout), "time a keepalive ping may go unanswered before the connection is closed")
+	fs.BoolVar(&c.KeepalivePermitWithoutStream, "otlp-keepalive-permit-without-stream", envBoolOrDefault("OTLP_KEEPALIVE_PERMIT_WITHOUT_STREAM", c.KeepalivePermitWithoutStream), "ping the collector connection even while no export is in flight")
+	fs.StringVar(&c.Propagators, "propagators", envOrDefault("OTEL_PROPAGATORS", c.Propagators), "comma separated propagators: tracecontext, baggage, b3, b3multi, jaeger or none")
+	fs.StringVar(&c.BaggageKeys, "baggage-keys", envOrDefault("BAGGAGE_KEYS", c.BaggageKeys), "comma separated baggage entries copied onto every span")
+	fs.StringVar(&c.FilterSpans, "filter-spans", envOrDefault("FILTER_SPANS", c.FilterSpans), "comma separated rules dropping spans before export, as KEY=VALUE conditions joined by &, e.g. \"name=ping\"")
+	fs.StringVar(&c.RedactAttributes, "redact-attributes", envOrDefault("REDACT_ATTRIBUTES", c.RedactAttributes), "comma separated span attribute keys redacted before export, a trailing * matches a prefix")
+	fs.StringVar(&c.RedactAllowAttributes, "redact-allow-attributes", envOrDefault("REDACT_ALLOW_ATTRIBUTES", c.RedactAllowAttributes), "comma separated span attribute keys exported as they are, redacting every other key")
+	fs.StringVar(&c.RedactMode, "redact-mode", envOrDefault("REDACT_MODE", c.RedactMode), "how redacted values are replaced: mask or hash")
+	fs.StringVar(&c.Sampler, "traces-sampler", envOrDefault("OTEL_TRACES_SAMPLER", c.Sampler), "span sampler: always_on, always_off, traceidratio, error_biased or the parentbased_ variants")
+	fs.Float64Var(&c.SamplerArg, "traces-sampler-arg", envFloatOrDefault("OTEL_TRACES_SAMPLER_ARG", c.SamplerArg), "fraction of traces sampled by the ratio based samplers")
+	fs.StringVar(&c.SamplerRoutes, "traces-sampler-routes", envOrDefault("TRACES_SAMPLER_ROUTES", c.SamplerRoutes), "comma separated per route sampling overrides, e.g. \"/v1/orders/:id/watch=never,POST /v1/orders=always\"")
+	fs.StringVar(&c.IDGenerator, "id-generator", envOrDefault("OTEL_ID_GENERATOR", c.IDGenerator), "trace ID generator: random, or xray for trace IDs AWS X-Ray accepts")
+	fs.IntVar(&c.BatchMaxQueueSize, "bsp-max-queue-size", envIntOrDefault("OTEL_BSP_MAX_QUEUE_SIZE", c.BatchMaxQueueSize), "ended spans waiting to be exported beyond which spans are dropped")
+	fs.IntVar(&c.BatchMaxExportSize, "bsp-max-export-batch-size", envIntOrDefault("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", c.BatchMaxExportSize), "most spans exported at once")
+	fs.DurationVar(&c.BatchScheduleDelay, "bsp-schedule-delay", envMillisOrDefault("OTEL_BSP_SCHEDULE_DELAY", c.BatchScheduleDelay), "longest ended spans wait before they are exported")
+	fs.DurationVar(&c.BatchExportTimeout, "bsp-export-timeout", envMillisOrDefault("OTEL_BSP_EXPORT_TIMEOUT", c.BatchExportTimeout), "maximum time an export of spans may take")
+	fs.DurationVar(&c.ReconnectInterval, "exporter-reconnect-interval", envDurationOrDefault("EXPORTER_RECONNECT_INTERVAL", c.ReconnectInterval), "how often an unreachable exporter endpoint is probed, spans being dropped meanwhile")
+	fs.StringVar(&c.MetricsExporter, "metrics-exporter", envOrDefault("OTEL_METRICS_EXPORTER", c.MetricsExporter), "comma separated metric exporters: otlp, prometheus or none")
+	fs.DurationVar(&c.MetricsInterval, "metrics-interval", envMillisOrDefault("OTEL_METRIC_EXPORT_INTERVAL", c.MetricsInterval), "interval between metric exports")
+	fs.DurationVar(&c.RuntimeMetricsInterval, "runtime-metrics-interval", envDurationOrDefault("RUNTIME_METRICS_INTERVAL", c.RuntimeMetricsInterval), "minimum interval between reads of Go runtime statistics")
+	fs.StringVar(&c.LogsExporter, "logs-exporter", envOrDefault("OTEL_LOGS_EXPORTER", c.LogsExporter), "log exporter: otlp or none")
+	fs.TextVar(&c.LogLevel, "log-level", envLevelOrDefault("LOG_LEVEL", c.LogLevel), "minimum log level: debug, info, warn or error")
+	fs.StringVar(&c.ResourceDetectors, "resource-detectors", envOrDefault("RESOURCE_DETECTORS", c.ResourceDetectors), "comma separated resource detectors: env, host, process, container, k8s, ec2, gce, azure or none")
+	fs.StringVar(&c.ReceiverAddr, "debug-receiver-addr", envOrDefault("DEBUG_RECEIVER_ADDR", c.ReceiverAddr), "address of an OTLP receiver run in process in place of a collector, its spans served at /debug/traces, empty to disable")
+	fs.IntVar(&c.ReceiverTraces, "debug-receiver-traces", envIntOrDefault("DEBUG_RECEIVER_TRACES", c.ReceiverTraces), "number of recent traces the in process receiver keeps")
+	fs.DurationVar(&c.ShutdownTimeout, "telemetry-shutdown-timeout", envDurationOrDefault("TELEMETRY_SHUTDOWN_TIMEOUT", c.ShutdownTimeout), "maximum time to flush buffered spans on shutdown")
+}
+
+// Validate reports the first setting that is not supported
+func (c *Config) Validate() error {
+	if c.ServiceName == "" {
+		return errors.New("service name is required")
+	}
+	seen := make(map[string]bool)
+	for _, name := range c.tracesExporters() {
+		switch name {
+		case ExporterOTLP, ExporterStdout, "console", ExporterJaeger, ExporterZipkin, ExporterNone:
+		default:
+			return fmt.Errorf("unknown traces exporter %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("traces exporter %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	switch c.Protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+	default:
+		return fmt.Errorf("unknown otlp protocol %q", c.Protocol)
+	}
+	if c.RetryEnabled && (c.RetryInitialInterval <= 0 || c.RetryMaxInterval < c.RetryInitialInterval || c.RetryMaxElapsedTime <= 0) {
+		return errors.New("otlp retry intervals must be positive, the max interval at least the initial one")
+	}
+	if c.KeepaliveTime < 0 || c.KeepaliveTimeout <= 0 {
+		return errors.New("otlp keepalive time must not be negative and its timeout must be positive")
+	}
+	if _, err := NewPropagator(*c); err != nil {
+		return err
+	}
+	if _, err := parseFilterRules(c.FilterSpans); err != nil {
+		return err
+	}
+	switch c.RedactMode {
+	case RedactMask, RedactHash:
+	default:
+		return fmt.Errorf("unknown redact mode %q", c.RedactMode)
+	}
+	if _, err := NewSampler(*c); err != nil {
+		return err
+	}
+	if _, err := newIDGenerator(c.IDGenerator); err != nil {
+		return err
+	}
+	if c.BatchMaxQueueSize <= 0 {
+		return errors.New("span queue size must be positive")
+	}
+	if c.BatchMaxExportSize <= 0 || c.BatchMaxExportSize > c.BatchMaxQueueSize {
+		return errors.New("span export batch size must be positive and at most the queue size")
+	}
+	if c.BatchScheduleDelay <= 0 {
+		return errors.New("span schedule delay must be positive")
+	}
+	if c.BatchExportTimeout <= 0 {
+		return errors.New("span export timeout must be positive")
+	}
+	if c.ReconnectInterval <= 0 {
+		return errors.New("exporter reconnect interval must be positive")
+	}
+	for _, name := range c.metricsExporters() {
+		switch name {
+		case ExporterOTLP, ExporterPrometheus, ExporterNone:
+		default:
+			return fmt.Errorf("unknown metrics exporter %q", name)
+		}
+	}
+	if c.MetricsInterval <= 0 {
+		return errors.New("metrics interval must be positive")
+	}
+	if c.exportsMetrics(ExporterOTLP) {
+		if _, err := c.metricsEndpoint(); err != nil {
+			return err
+		}
+	}
+	switch c.LogsExporter {
+	case ExporterOTLP:
+		if _, err := c.logsEndpoint(); err != nil {
+			return err
+		}
+	case ExporterNone:
+	default:
+		return fmt.Errorf("unknown logs exporter %q", c.LogsExporter)
+	}
+	if _, err := resourceOptions(c.ResourceDetectors); err != nil {
+		return err
+	}
+	if c.ReceiverAddr != "" && c.ReceiverTraces <= 0 {
+		return errors.New("debug receiver traces must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("telemetry shutdown timeout must be positive")
+	}
+	return nil
+}
+
+// tlsConfig builds the TLS settings described by the config. It returns nil
+// when the config is insecure.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.insecure() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// insecure reports whether TLS is disabled. When the OTLP endpoint is a URL,
+// as OTEL_EXPORTER_OTLP_ENDPOINT is, its scheme decides.
+func (c *Config) insecure() bool {
+	if c.exportsTraces(ExporterOTLP) {
+		if u, err := url.Parse(c.tracesEndpoint()); err == nil && u.Host != "" {
+			return u.Scheme == "http"
+		}
+	}
+	return c.Insecure
+}
+
+// tracesExporters splits the comma separated list of span exporters
+func (c Config) tracesExporters() []string {
+	if c.Exporter == "" {
+		return []string{ExporterOTLP}
+	}
+	var names []string
+	for _, name := range strings.Split(c.Exporter, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// exportsTraces reports whether the named span exporter is selected
+func (c Config) exportsTraces(name string) bool {
+	for _, n := range c.tracesExporters() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoint returns the configured endpoint of the named span exporter. The
+// endpoint belongs to the otlp exporter when it is selected, so the others
+// use their defaults next to it.
+func (c Config) endpoint(name string) string {
+	if name != ExporterOTLP && c.exportsTraces(ExporterOTLP) {
+		return ""
+	}
+	return c.Endpoint
+}
+
+// tracesEndpoint returns the endpoint the otlp exporter sends spans to
+func (c Config) tracesEndpoint() string {
+	if c.TracesEndpoint != "" {
+		return c.TracesEndpoint
+	}
+	return c.Endpoint
+}
+
+// otlpEndpoint splits an OTLP endpoint into the host and port that is dialed
+// and the URL path, which is empty unless the endpoint is a URL
+func otlpEndpoint(endpoint string) (host, path string) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint, ""
+	}
+	return u.Host, strings.TrimSuffix(u.Path, "/")
+}
+
+// serviceNameOrDefault returns the service name set by OTEL_SERVICE_NAME or,
+// failing that, by the service.name entry of OTEL_RESOURCE_ATTRIBUTES
+func serviceNameOrDefault(def string) string {
+	if name, ok := ServiceNameFromEnv(); ok {
+		return name
+	}
+	return def
+}
+
+// ServiceNameFromEnv returns the service name set by the environment, and
+// whether it was set
+func ServiceNameFromEnv() (string, bool) {
+	if name, ok := os.LookupEnv("OTEL_SERVICE_NAME"); ok && name != "" {
+		return name, true
+	}
+	for _, entry := range strings.Split(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), ",") {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(key) != string(semconv.ServiceNameKey) {
+			continue
+		}
+		// values are percent encoded, as baggage values are
+		if name, err := url.PathUnescape(strings.TrimSpace(value)); err == nil && name != "" {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// metricsEndpoint returns the host and port metrics are exported to
+func (c Config) metricsEndpoint() (string, error) {
+	return c.grpcEndpoint("metrics", c.MetricsEndpoint)
+}
+
+// logsEndpoint returns the host and port logs are exported to
+func (c Config) logsEndpoint() (string, error) {
+	return c.grpcEndpoint("logs", c.LogsEndpoint)
+}
+
+// grpcEndpoint returns the host and port a signal only exported over OTLP
+// gRPC is sent to: endpoint, its own, when set, or else Endpoint, whatever
+// exports spans. It fails rather than fall back to the local default when
+// Endpoint is set but is no OTLP gRPC endpoint.
+func (c Config) grpcEndpoint(signal, endpoint string) (string, error) {
+	if endpoint == "" {
+		switch {
+		case c.Endpoint == "":
+			return defaultOTLPGRPCEndpoint, nil
+		case !c.exportsTraces(ExporterOTLP) && (c.exportsTraces(ExporterJaeger) || c.exportsTraces(ExporterZipkin)):
+			return "", fmt.Errorf("otlp endpoint %q is the endpoint of the %s span exporter, so %s need an otlp %s endpoint", c.Endpoint, c.Exporter, signal, signal)
+		case c.Protocol == ProtocolHTTP:
+			return "", fmt.Errorf("%s are only exported over OTLP gRPC, so with the %s otlp protocol they need an otlp %s endpoint", signal, ProtocolHTTP, signal)
+		}
+		endpoint = c.Endpoint
+	}
+	host, _ := otlpEndpoint(endpoint)
+	return host, nil
+}
+
+func envBoolOrDefault(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envLevelOrDefault(key string, def slog.Level) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv(key))); err == nil {
+		return level
+	}
+	return def
+}
+
+func envIntOrDefault(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDurationOrDefault(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envMillisOrDefault reads a duration given in milliseconds, as used by the
+// OTEL_* environment variables
+func envMillisOrDefault(key string, def time.Duration) time.Duration {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return time.Duration(v) * time.Millisecond
+	}
+	return def
+}
+
+func envFloatOrDefault(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// probeTimeout bounds how long a connection to an exporter endpoint is
+// attempted for
+const probeTimeout = 2 * time.Second
+
+// errExporterUnavailable fails the exports attempted while the endpoint of
+// an exporter is unreachable
+var errExporterUnavailable = errors.New("exporter endpoint unreachable")
+
+// degradingExporter keeps the process running with its spans dropped while
+// the endpoint of the exporter it wraps is unreachable, rather than having
+// every export wait out its timeout. The endpoint is probed every interval,
+// and exports resume once it accepts connections again. Whether it does is
+// reported by the telemetry.exporter.up gauge.
+type degradingExporter struct {
+	trace.SpanExporter
+	name     string
+	addr     string
+	interval time.Duration
+	up       atomic.Bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newDegradingExporter wraps the named exporter sending to addr. It probes
+// the endpoint once before returning, so spans are not queued for an
+// endpoint known to be down.
+func newDegradingExporter(ctx context.Context, next trace.SpanExporter, name, addr string, interval time.Duration) (*degradingExporter, error) {
+	e := &degradingExporter{
+		SpanExporter: next,
+		name:         name,
+		addr:         addr,
+		interval:     interval,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	// assumed up until probed, so an endpoint down at startup is logged
+	e.up.Store(true)
+	if err := e.instrument(global.Meter("telemetry")); err != nil {
+		return nil, err
+	}
+	e.check(ctx)
+	go e.watch()
+	return e, nil
+}
+
+func (e *degradingExporter) instrument(meter metric.Meter) error {
+	up, err := meter.Int64ObservableGauge("telemetry.exporter.up",
+		instrument.WithDescription("Whether the endpoint of the span exporter accepts connections, 1 when it does and 0 while spans are dropped"),
+	)
+	if err != nil {
+		return fmt.Errorf("create exporter up gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var v int64
+		if e.up.Load() {
+			v = 1
+		}
+		o.ObserveInt64(up, v, exporterKey.String(e.name))
+		return nil
+	}, up)
+	if err != nil {
+		return fmt.Errorf("register exporter up callback: %w", err)
+	}
+	return nil
+}
+
+func (e *degradingExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if !e.up.Load() {
+		return fmt.Errorf("%s exporter at %s: %w", e.name, e.addr, errExporterUnavailable)
+	}
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+func (e *degradingExporter) Shutdown(ctx context.Context) error {
+	close(e.stop)
+	<-e.done
+	return e.SpanExporter.Shutdown(ctx)
+}
+
+// watch probes the endpoint every interval until the exporter is shut down
+func (e *degradingExporter) watch() {
+	defer close(e.done)
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-t.C:
+			e.check(context.Background())
+		}
+	}
+}
+
+// check probes the endpoint, logging when it becomes reachable or
+// unreachable
+func (e *degradingExporter) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.addr)
+	if err == nil {
+		conn.Close()
+	}
+	up := err == nil
+	if e.up.Swap(up) == up {
+		return
+	}
+	if up {
+		slog.Info("exporter endpoint reachable, exporting spans", "exporter", e.name, "addr", e.addr)
+	} else {
+		slog.Warn("exporter endpoint unreachable, dropping spans until it is back", "exporter", e.name, "addr", e.addr, "retry_interval", e.interval, "error", err)
+	}
+}
@@ -0,0 +1,288 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Resource detector names accepted by Config.ResourceDetectors
+const (
+	// DetectorEnv reads OTEL_RESOURCE_ATTRIBUTES
+	DetectorEnv = "env"
+	// DetectorHost describes the host and its operating system
+	DetectorHost = "host"
+	// DetectorProcess describes the process, without its command line
+	// arguments, which may hold secrets
+	DetectorProcess = "process"
+	// DetectorContainer reads the container ID from the cgroup of the
+	// process
+	DetectorContainer = "container"
+	// DetectorK8s reads the pod from the environment variables set by the
+	// Kubernetes downward API
+	DetectorK8s = "k8s"
+	// DetectorEC2, DetectorGCE, and DetectorAzure query the instance
+	// metadata service of the cloud. Away from the cloud they detect
+	// nothing, after a timeout.
+	DetectorEC2   = "ec2"
+	DetectorGCE   = "gce"
+	DetectorAzure = "azure"
+)
+
+// metadataTimeout bounds how long a cloud metadata service is queried for
+const metadataTimeout = time.Second
+
+// Cloud detectors are shared, so the metadata service is queried once
+// however many signals build a resource
+var (
+	ec2Detector   = &onceDetector{detect: detectEC2}
+	gceDetector   = &onceDetector{detect: detectGCE}
+	azureDetector = &onceDetector{detect: detectAzure}
+)
+
+// resourceOptions returns the resource options of the comma separated list
+// of detectors
+func resourceOptions(detectors string) ([]resource.Option, error) {
+	var opts []resource.Option
+	for _, name := range strings.Split(detectors, ",") {
+		switch strings.TrimSpace(name) {
+		case DetectorEnv:
+			opts = append(opts, resource.WithFromEnv())
+		case DetectorHost:
+			opts = append(opts,
+				resource.WithHost(),
+				resource.WithOS(),
+				resource.WithAttributes(semconv.HostArchKey.String(runtime.GOARCH)),
+			)
+		case DetectorProcess:
+			opts = append(opts,
+				resource.WithProcessPID(),
+				resource.WithProcessExecutableName(),
+				resource.WithProcessExecutablePath(),
+				resource.WithProcessOwner(),
+				resource.WithProcessRuntimeName(),
+				resource.WithProcessRuntimeVersion(),
+				resource.WithProcessRuntimeDescription(),
+			)
+		case DetectorContainer:
+			opts = append(opts, resource.WithContainer())
+		case DetectorK8s:
+			opts = append(opts, resource.WithDetectors(k8sDetector{}))
+		case DetectorEC2:
+			opts = append(opts, resource.WithDetectors(ec2Detector))
+		case DetectorGCE:
+			opts = append(opts, resource.WithDetectors(gceDetector))
+		case DetectorAzure:
+			opts = append(opts, resource.WithDetectors(azureDetector))
+		case ExporterNone, "":
+		default:
+			return nil, fmt.Errorf("unknown resource detector %q", name)
+		}
+	}
+	return opts, nil
+}
+
+// k8sDetector describes the pod from the environment variables the
+// deployment sets with the downward API:
+//
+//	env:
+//	- name: K8S_POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: K8S_POD_UID
+//	  valueFrom: {fieldRef: {fieldPath: metadata.uid}}
+//	- name: K8S_NAMESPACE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: K8S_NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//
+// Without them, the pod name falls back to the hostname and the namespace
+// to that of the service account.
+type k8sDetector struct{}
+
+func (k8sDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return resource.Empty(), nil
+	}
+	podName := os.Getenv("K8S_POD_NAME")
+	if podName == "" {
+		podName, _ = os.Hostname()
+	}
+	namespace := os.Getenv("K8S_NAMESPACE_NAME")
+	if namespace == "" {
+		data, _ := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		namespace = strings.TrimSpace(string(data))
+	}
+	return schemaless(
+		semconv.K8SPodNameKey.String(podName),
+		semconv.K8SPodUIDKey.String(os.Getenv("K8S_POD_UID")),
+		semconv.K8SNamespaceNameKey.String(namespace),
+		semconv.K8SNodeNameKey.String(os.Getenv("K8S_NODE_NAME")),
+	), nil
+}
+
+// onceDetector runs detect the first time it is asked and returns the same
+// result after
+type onceDetector struct {
+	detect func(ctx context.Context) (*resource.Resource, error)
+
+	once sync.Once
+	res  *resource.Resource
+	err  error
+}
+
+func (d *onceDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	d.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+		defer cancel()
+		d.res, d.err = d.detect(ctx)
+	})
+	return d.res, d.err
+}
+
+// detectEC2 reads the identity document of the instance through IMDSv2
+func detectEC2(ctx context.Context) (*resource.Resource, error) {
+	const base = "http://169.254.169.254/latest"
+	token, err := queryMetadata(ctx, http.MethodPut, base+"/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil || token == nil {
+		return resource.Empty(), err
+	}
+	data, err := queryMetadata(ctx, http.MethodGet, base+"/dynamic/instance-identity/document", map[string]string{
+		"X-aws-ec2-metadata-token": string(token),
+	})
+	if err != nil || data == nil {
+		return resource.Empty(), err
+	}
+	var doc struct {
+		AccountID        string `json:"accountId"`
+		AvailabilityZone string `json:"availabilityZone"`
+		Region           string `json:"region"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		ImageID          string `json:"imageId"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return resource.Empty(), fmt.Errorf("decode ec2 identity document: %w", err)
+	}
+	return schemaless(
+		semconv.CloudProviderAWS,
+		semconv.CloudPlatformAWSEC2,
+		semconv.CloudAccountIDKey.String(doc.AccountID),
+		semconv.CloudRegionKey.String(doc.Region),
+		semconv.CloudAvailabilityZoneKey.String(doc.AvailabilityZone),
+		semconv.HostIDKey.String(doc.InstanceID),
+		semconv.HostTypeKey.String(doc.InstanceType),
+		semconv.HostImageIDKey.String(doc.ImageID),
+	), nil
+}
+
+// detectGCE reads the project and instance from the metadata server
+func detectGCE(ctx context.Context) (*resource.Resource, error) {
+	const base = "http://metadata.google.internal/computeMetadata/v1/"
+	header := map[string]string{"Metadata-Flavor": "Google"}
+	paths := []string{"project/project-id", "instance/id", "instance/name", "instance/zone", "instance/machine-type"}
+	values := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := queryMetadata(ctx, http.MethodGet, base+path, header)
+		if err != nil || data == nil {
+			return resource.Empty(), err
+		}
+		// zones and machine types are given as full resource names
+		value := string(data)
+		values[path] = value[strings.LastIndex(value, "/")+1:]
+	}
+	zone := values["instance/zone"]
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	return schemaless(
+		semconv.CloudProviderGCP,
+		semconv.CloudPlatformGCPComputeEngine,
+		semconv.CloudAccountIDKey.String(values["project/project-id"]),
+		semconv.CloudRegionKey.String(region),
+		semconv.CloudAvailabilityZoneKey.String(zone),
+		semconv.HostIDKey.String(values["instance/id"]),
+		semconv.HostNameKey.String(values["instance/name"]),
+		semconv.HostTypeKey.String(values["instance/machine-type"]),
+	), nil
+}
+
+// detectAzure reads the virtual machine from the instance metadata service
+func detectAzure(ctx context.Context) (*resource.Resource, error) {
+	data, err := queryMetadata(ctx, http.MethodGet, "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01&format=json", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil || data == nil {
+		return resource.Empty(), err
+	}
+	var compute struct {
+		Location       string `json:"location"`
+		Name           string `json:"name"`
+		VMID           string `json:"vmId"`
+		VMSize         string `json:"vmSize"`
+		SubscriptionID string `json:"subscriptionId"`
+		ResourceGroup  string `json:"resourceGroupName"`
+	}
+	if err := json.Unmarshal(data, &compute); err != nil {
+		return resource.Empty(), fmt.Errorf("decode azure instance metadata: %w", err)
+	}
+	return schemaless(
+		semconv.CloudProviderAzure,
+		semconv.CloudPlatformAzureVM,
+		semconv.CloudAccountIDKey.String(compute.SubscriptionID),
+		semconv.CloudRegionKey.String(compute.Location),
+		semconv.HostIDKey.String(compute.VMID),
+		semconv.HostNameKey.String(compute.Name),
+		semconv.HostTypeKey.String(compute.VMSize),
+		attribute.String("azure.resource_group.name", compute.ResourceGroup),
+	), nil
+}
+
+// queryMetadata sends a request to a metadata service and returns the body
+// of the response. It returns nil without an error when the service cannot
+// be reached, as away from its cloud.
+func queryMetadata(ctx context.Context, method, url string, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	// the default client, so the detection is not traced
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// schemaless creates a resource of the attributes with a value. Detected
+// resources carry no schema URL, so they merge with those of the SDK's
+// detectors, which follow a newer semantic conventions version.
+func schemaless(attrs ...attribute.KeyValue) *resource.Resource {
+	set := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr.Value.AsString() != "" {
+			set = append(set, attr)
+		}
+	}
+	return resource.NewSchemaless(set...)
+}
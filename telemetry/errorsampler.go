@@ -0,0 +1,197 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// maxPendingTraces bounds the number of traces buffered by errorBiasedProcessor.
+// Spans of traces beyond the bound are passed through unsampled.
+const maxPendingTraces = 10000
+
+// pendingTTL is how long the spans of a trace are buffered without its local
+// root ending, as when spans end after their root or a root never ends.
+// Expired traces are decided on their own spans.
+const pendingTTL = time.Minute
+
+// errorBiasedSampler records and samples every span of the traces started
+// here, so that the outcome of a trace is known before errorBiasedProcessor
+// decides whether to keep it. Spans with a parent follow its decision, as
+// with ParentBased, so a trace dropped upstream stays dropped and one kept
+// upstream is kept whole.
+//
+// The decision to keep a trace started here is only made once it ends, so
+// the requests it sends downstream carry sampled=1 even when it is dropped.
+// Downstream services following their parent then export fragments of
+// traces whose root is never exported.
+type errorBiasedSampler struct {
+	ratio float64
+}
+
+func (s errorBiasedSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	parent := oteltrace.SpanContextFromContext(p.ParentContext)
+	decision := trace.RecordAndSample
+	if parent.IsValid() && !parent.IsSampled() {
+		decision = trace.Drop
+	}
+	return trace.SamplingResult{
+		Decision:   decision,
+		Tracestate: parent.TraceState(),
+	}
+}
+
+func (s errorBiasedSampler) Description() string {
+	return fmt.Sprintf("ErrorBiased{%g}", s.ratio)
+}
+
+// errorBiasedProcessor buffers the spans of each trace until its local root
+// span ends. The trace is then forwarded to next if the root span has an error
+// status, if it was sampled upstream, or if the trace ID falls within the
+// configured ratio.
+type errorBiasedProcessor struct {
+	next      trace.SpanProcessor
+	keepRatio trace.Sampler
+
+	mu      sync.Mutex
+	pending map[oteltrace.TraceID]*pendingTrace
+	// swept is when expired traces were last looked for
+	swept time.Time
+}
+
+// pendingTrace is the buffered spans of a trace
+type pendingTrace struct {
+	firstSeen time.Time
+	spans     []trace.ReadOnlySpan
+}
+
+func newErrorBiasedProcessor(next trace.SpanProcessor, keepRatio trace.Sampler) *errorBiasedProcessor {
+	return &errorBiasedProcessor{
+		next:      next,
+		keepRatio: keepRatio,
+		pending:   make(map[oteltrace.TraceID]*pendingTrace),
+		swept:     time.Now(),
+	}
+}
+
+func (p *errorBiasedProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *errorBiasedProcessor) OnEnd(s trace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+
+	now := time.Now()
+
+	p.mu.Lock()
+	expired := p.sweep(now)
+	pt, buffered := p.pending[traceID]
+	if !buffered && len(p.pending) >= maxPendingTraces {
+		p.mu.Unlock()
+		p.decide(expired...)
+		p.next.OnEnd(s)
+		return
+	}
+	if !buffered {
+		pt = &pendingTrace{firstSeen: now}
+	}
+	pt.spans = append(pt.spans, s)
+	if !isLocalRoot(s) {
+		p.pending[traceID] = pt
+		p.mu.Unlock()
+		p.decide(expired...)
+		return
+	}
+	delete(p.pending, traceID)
+	p.mu.Unlock()
+	p.decide(expired...)
+
+	if s.Status().Code != codes.Error && !sampledUpstream(s) && !p.keepSuccess(traceID) {
+		return
+	}
+	for _, span := range pt.spans {
+		p.next.OnEnd(span)
+	}
+}
+
+// sweep removes the traces buffered for longer than pendingTTL and returns
+// them, looking at most once per tenth of pendingTTL. p.mu must be held.
+func (p *errorBiasedProcessor) sweep(now time.Time) []*pendingTrace {
+	if now.Sub(p.swept) < pendingTTL/10 {
+		return nil
+	}
+	p.swept = now
+	var expired []*pendingTrace
+	for traceID, pt := range p.pending {
+		if now.Sub(pt.firstSeen) >= pendingTTL {
+			expired = append(expired, pt)
+			delete(p.pending, traceID)
+		}
+	}
+	return expired
+}
+
+// decide forwards the traces decided before their local root ended that
+// have a span with an error status or sampled upstream, or whose trace ID
+// falls within the ratio
+func (p *errorBiasedProcessor) decide(traces ...*pendingTrace) {
+	for _, pt := range traces {
+		keep := p.keepSuccess(pt.spans[0].SpanContext().TraceID())
+		for _, span := range pt.spans {
+			keep = keep || span.Status().Code == codes.Error || sampledUpstream(span)
+		}
+		if !keep {
+			continue
+		}
+		for _, span := range pt.spans {
+			p.next.OnEnd(span)
+		}
+	}
+}
+
+// Shutdown decides the buffered traces, so the errors of the traces still
+// open are kept, before shutting down next
+func (p *errorBiasedProcessor) Shutdown(ctx context.Context) error {
+	p.flushPending()
+	return p.next.Shutdown(ctx)
+}
+
+// ForceFlush decides the buffered traces before flushing next
+func (p *errorBiasedProcessor) ForceFlush(ctx context.Context) error {
+	p.flushPending()
+	return p.next.ForceFlush(ctx)
+}
+
+// flushPending decides every buffered trace, on the spans that ended so far
+func (p *errorBiasedProcessor) flushPending() {
+	p.mu.Lock()
+	pending := make([]*pendingTrace, 0, len(p.pending))
+	for _, pt := range p.pending {
+		pending = append(pending, pt)
+	}
+	p.pending = make(map[oteltrace.TraceID]*pendingTrace)
+	p.mu.Unlock()
+	p.decide(pending...)
+}
+
+// keepSuccess reports whether a successful trace falls within the ratio
+func (p *errorBiasedProcessor) keepSuccess(traceID oteltrace.TraceID) bool {
+	res := p.keepRatio.ShouldSample(trace.SamplingParameters{TraceID: traceID})
+	return res.Decision == trace.RecordAndSample
+}
+
+// sampledUpstream reports whether the span is the local root of a trace
+// that the service calling this one sampled
+func sampledUpstream(s trace.ReadOnlySpan) bool {
+	return s.Parent().IsRemote() && s.Parent().IsSampled()
+}
+
+// isLocalRoot reports whether the span is the first span of its trace in this process
+func isLocalRoot(s trace.ReadOnlySpan) bool {
+	return !s.Parent().IsValid() || s.Parent().IsRemote()
+}
@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExemplarHistogram records request durations in a Prometheus histogram
+// whose buckets keep a sampled request as an exemplar carrying its trace ID,
+// so a latency spike leads straight to an example trace. The OTel metric SDK
+// does not record exemplars yet, so the histogram sits next to
+// http.server.duration rather than replacing it, and is only scraped by
+// Prometheus asking for the OpenMetrics format.
+type ExemplarHistogram struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewExemplarHistogram registers the histogram with the registry served by
+// MetricsHandler. It returns nil when the prometheus exporter is not
+// selected.
+func NewExemplarHistogram(cfg Config) (*ExemplarHistogram, error) {
+	if !cfg.exportsMetrics(ExporterPrometheus) {
+		return nil, nil
+	}
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_server_request_duration_seconds",
+		Help:    "Duration of inbound HTTP requests, with the trace of an example request per bucket",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"http_method", "http_route", "http_status_code"})
+	if err := prometheus.Register(vec); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return nil, fmt.Errorf("register exemplar histogram: %w", err)
+		}
+		vec = registered.ExistingCollector.(*prometheus.HistogramVec)
+	}
+	return &ExemplarHistogram{vec: vec}, nil
+}
+
+// Observe records the duration of a request. The request becomes the
+// exemplar of its bucket when its trace is sampled, as the traces that are
+// not are never exported.
+func (h *ExemplarHistogram) Observe(sc trace.SpanContext, d time.Duration, method, route string, status int) {
+	observer := h.vec.WithLabelValues(method, route, strconv.Itoa(status))
+	if !sc.IsSampled() {
+		observer.Observe(d.Seconds())
+		return
+	}
+	observer.(prometheus.ExemplarObserver).ObserveWithExemplar(d.Seconds(), prometheus.Labels{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	})
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	defaultOTLPGRPCEndpoint = "localhost:4317"
+	defaultOTLPHTTPEndpoint = "localhost:4318"
+	defaultJaegerEndpoint   = "http://localhost:14268/api/traces"
+	defaultZipkinEndpoint   = "http://localhost:9411/api/v2/spans"
+
+	// otlpTracesPath is where spans are posted over OTLP HTTP
+	otlpTracesPath = "/v1/traces"
+)
+
+// newExporter creates the named span exporter. It returns a nil exporter for
+// none.
+func newExporter(ctx context.Context, cfg Config, name string) (trace.SpanExporter, error) {
+	switch name {
+	case ExporterOTLP:
+		switch cfg.Protocol {
+		case ProtocolGRPC, "":
+			return newOTLPGRPCExporter(ctx, cfg)
+		case ProtocolHTTP:
+			return newOTLPHTTPExporter(ctx, cfg)
+		default:
+			return nil, fmt.Errorf("unknown otlp protocol %q", cfg.Protocol)
+		}
+	case ExporterStdout, "console":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterJaeger:
+		return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpointOrDefault(cfg.endpoint(name), defaultJaegerEndpoint))))
+	case ExporterZipkin:
+		return zipkin.New(endpointOrDefault(cfg.endpoint(name), defaultZipkinEndpoint))
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", name)
+	}
+}
+
+func newOTLPGRPCExporter(ctx context.Context, cfg Config) (trace.SpanExporter, error) {
+	host, _ := otlpEndpoint(endpointOrDefault(cfg.tracesEndpoint(), defaultOTLPGRPCEndpoint))
+	conn, err := dialCollector(ctx, cfg, host)
+	if err != nil {
+		return nil, err
+	}
+	return otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn), otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(cfg.retry())))
+}
+
+// retry returns the retry settings of OTLP exports
+func (c Config) retry() otlptracehttp.RetryConfig {
+	return otlptracehttp.RetryConfig{
+		Enabled:         c.RetryEnabled,
+		InitialInterval: c.RetryInitialInterval,
+		MaxInterval:     c.RetryMaxInterval,
+		MaxElapsedTime:  c.RetryMaxElapsedTime,
+	}
+}
+
+// dialCollector opens a gRPC connection to the collector at endpoint using
+// the TLS and keepalive settings of the config
+func dialCollector(ctx context.Context, cfg Config, endpoint string) (*grpc.ClientConn, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if cfg.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}))
+	}
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial collector: %w", err)
+	}
+	return conn, nil
+}
+
+func newOTLPHTTPExporter(ctx context.Context, cfg Config) (trace.SpanExporter, error) {
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := endpointOrDefault(cfg.tracesEndpoint(), defaultOTLPHTTPEndpoint)
+	host, path := otlpEndpoint(endpoint)
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(host),
+		otlptracehttp.WithRetry(cfg.retry()),
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		// the URL of the spans is used as is, as
+		// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is, while any other URL is the
+		// base of the signal paths, as OTEL_EXPORTER_OTLP_ENDPOINT is
+		if cfg.TracesEndpoint == "" {
+			path += otlpTracesPath
+		} else if path == "" {
+			path = "/"
+		}
+		opts = append(opts, otlptracehttp.WithURLPath(path))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	} else {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+func endpointOrDefault(endpoint, def string) string {
+	if endpoint == "" {
+		return def
+	}
+	return endpoint
+}
@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// filterName is the key of a filter condition on the span name rather than
+// on an attribute
+const filterName = "name"
+
+// filterRule matches the spans meeting all of its conditions
+type filterRule []filterCondition
+
+// filterCondition matches the spans whose name, or attribute key, has a
+// value matching pattern. A pattern ending in * matches every value with
+// its prefix.
+type filterCondition struct {
+	key     string
+	pattern string
+}
+
+// parseFilterRules parses a comma separated list of rules, each a list of
+// KEY=VALUE conditions joined by &. The key name matches the span name,
+// any other key the attribute of that key. For example
+// "name=ping,db.system=redis&name=readyz check*".
+func parseFilterRules(list string) ([]filterRule, error) {
+	var rules []filterRule
+	for _, rule := range strings.Split(list, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		var r filterRule
+		for _, cond := range strings.Split(rule, "&") {
+			key, pattern, ok := strings.Cut(cond, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				return nil, fmt.Errorf("span filter %q: condition %q is not KEY=VALUE", rule, cond)
+			}
+			r = append(r, filterCondition{key: key, pattern: strings.TrimSpace(pattern)})
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r filterRule) matches(s trace.ReadOnlySpan) bool {
+	for _, c := range r {
+		if !c.matches(s) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c filterCondition) matches(s trace.ReadOnlySpan) bool {
+	if c.key == filterName {
+		return matchesKey([]string{c.pattern}, s.Name())
+	}
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == c.key {
+			return matchesKey([]string{c.pattern}, valueString(kv.Value))
+		}
+	}
+	return false
+}
+
+// valueString returns the value as a string, without the brackets Emit
+// puts around slices
+func valueString(v attribute.Value) string {
+	if v.Type() == attribute.STRING {
+		return v.AsString()
+	}
+	return v.Emit()
+}
+
+// filteringProcessor drops the ended spans matching any of its rules, such
+// as redis PINGs and health checks, and hands the others to next. The
+// children of a dropped span are kept, and show up without their parent.
+type filteringProcessor struct {
+	next  trace.SpanProcessor
+	rules []filterRule
+}
+
+func newFilteringProcessor(next trace.SpanProcessor, rules []filterRule) *filteringProcessor {
+	return &filteringProcessor{next: next, rules: rules}
+}
+
+func (p *filteringProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *filteringProcessor) OnEnd(s trace.ReadOnlySpan) {
+	for _, r := range p.rules {
+		if r.matches(s) {
+			return
+		}
+	}
+	p.next.OnEnd(s)
+}
+
+func (p *filteringProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *filteringProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// CheckExporter verifies that the endpoint of each trace exporter accepts
+// connections. Exporters that do not send over the network always pass.
+func CheckExporter(ctx context.Context, cfg Config) error {
+	for _, name := range cfg.tracesExporters() {
+		addr := cfg.exporterAddr(name)
+		if addr == "" {
+			continue
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("connect to %s exporter: %w", name, err)
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// exporterAddr returns the host and port the named exporter connects to, or
+// an empty string for exporters that do not send over the network
+func (c Config) exporterAddr(name string) string {
+	switch name {
+	case ExporterOTLP:
+		if c.Protocol == ProtocolHTTP {
+			return urlHost(endpointOrDefault(c.tracesEndpoint(), defaultOTLPHTTPEndpoint))
+		}
+		return urlHost(endpointOrDefault(c.tracesEndpoint(), defaultOTLPGRPCEndpoint))
+	case ExporterJaeger:
+		return urlHost(endpointOrDefault(c.endpoint(name), defaultJaegerEndpoint))
+	case ExporterZipkin:
+		return urlHost(endpointOrDefault(c.endpoint(name), defaultZipkinEndpoint))
+	default:
+		return ""
+	}
+}
+
+// urlHost returns the host and port of an exporter URL, defaulting the port
+// from the scheme. An endpoint that is not a URL is returned as it is.
+func urlHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ID generator names accepted by Config.IDGenerator
+const (
+	// IDGeneratorRandom makes trace IDs of 16 random bytes, the SDK default
+	IDGeneratorRandom = "random"
+	// IDGeneratorXRay makes trace IDs starting with the time they were made
+	// in epoch seconds, as AWS X-Ray requires. X-Ray rejects the spans of
+	// traces whose IDs do not, so they are needed to export to X-Ray
+	// through the collector.
+	IDGeneratorXRay = "xray"
+)
+
+// newIDGenerator returns the named ID generator, or nil for the SDK default
+func newIDGenerator(name string) (sdktrace.IDGenerator, error) {
+	switch name {
+	case IDGeneratorRandom:
+		return nil, nil
+	case IDGeneratorXRay:
+		return newXRayIDGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", name)
+	}
+}
+
+// xrayIDGenerator makes X-Ray compatible trace IDs: 4 bytes of epoch
+// seconds followed by 12 random bytes. Span IDs are 8 random bytes.
+type xrayIDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newXRayIDGenerator() *xrayIDGenerator {
+	var seed int64
+	_ = binary.Read(crand.Reader, binary.LittleEndian, &seed)
+	return &xrayIDGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (g *xrayIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var tid trace.TraceID
+	binary.BigEndian.PutUint32(tid[:4], uint32(time.Now().Unix()))
+	_, _ = g.rand.Read(tid[4:])
+	var sid trace.SpanID
+	_, _ = g.rand.Read(sid[:])
+	return tid, sid
+}
+
+func (g *xrayIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var sid trace.SpanID
+	_, _ = g.rand.Read(sid[:])
+	return sid
+}
@@ -0,0 +1,327 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	logQueueSize      = 2048
+	logBatchSize      = 512
+	logExportInterval = 5 * time.Second
+	logExportTimeout  = 10 * time.Second
+)
+
+// LoggerProvider owns the structured logger and the exporter that ships its
+// records to the collector
+type LoggerProvider struct {
+	logger   *slog.Logger
+	level    *slog.LevelVar
+	exporter *logExporter
+}
+
+// NewLoggerProvider creates a provider whose logger writes JSON to stderr and,
+// when the otlp logs exporter is selected, exports every record as an OTLP log
+// carrying the same resource as traces and metrics
+func NewLoggerProvider(ctx context.Context, cfg Config) (*LoggerProvider, error) {
+	level := new(slog.LevelVar)
+	level.Set(cfg.LogLevel)
+	h := &logHandler{
+		next: slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}),
+	}
+
+	switch cfg.LogsExporter {
+	case ExporterOTLP, "":
+		endpoint, err := cfg.logsEndpoint()
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialCollector(ctx, cfg, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		res, err := newResource(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		h.exporter = newLogExporter(collogspb.NewLogsServiceClient(conn), res)
+	case ExporterNone:
+	default:
+		return nil, fmt.Errorf("unknown logs exporter %q", cfg.LogsExporter)
+	}
+
+	return &LoggerProvider{
+		logger:   slog.New(h),
+		level:    level,
+		exporter: h.exporter,
+	}, nil
+}
+
+// Logger returns the structured logger
+func (p *LoggerProvider) Logger() *slog.Logger {
+	return p.logger
+}
+
+// SetLevel changes the minimum level of records that are logged
+func (p *LoggerProvider) SetLevel(level slog.Level) {
+	p.level.Set(level)
+}
+
+// Shutdown flushes any buffered log records to the collector
+func (p *LoggerProvider) Shutdown(ctx context.Context) error {
+	if p.exporter == nil {
+		return nil
+	}
+	return p.exporter.shutdown(ctx)
+}
+
+// logHandler stamps records with the trace and span IDs of the context they
+// are logged with before handing them to the next handler and the exporter
+type logHandler struct {
+	next     slog.Handler
+	exporter *logExporter
+	attrs    []*commonpb.KeyValue
+	prefix   string
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	sc := trace.SpanContextFromContext(ctx)
+	if h.exporter != nil {
+		h.exporter.export(h.logRecord(sc, r))
+	}
+	if sc.IsValid() {
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kvs := append([]*commonpb.KeyValue{}, h.attrs...)
+	for _, a := range attrs {
+		kvs = appendAttr(kvs, h.prefix, a)
+	}
+	return &logHandler{
+		next:     h.next.WithAttrs(attrs),
+		exporter: h.exporter,
+		attrs:    kvs,
+		prefix:   h.prefix,
+	}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{
+		next:     h.next.WithGroup(name),
+		exporter: h.exporter,
+		attrs:    h.attrs,
+		prefix:   h.prefix + name + ".",
+	}
+}
+
+func (h *logHandler) logRecord(sc trace.SpanContext, r slog.Record) *logspb.LogRecord {
+	kvs := append([]*commonpb.KeyValue{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		kvs = appendAttr(kvs, h.prefix, a)
+		return true
+	})
+
+	lr := &logspb.LogRecord{
+		TimeUnixNano:         uint64(r.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severityNumber(r.Level),
+		SeverityText:         r.Level.String(),
+		Body:                 stringValue(r.Message),
+		Attributes:           kvs,
+	}
+	if sc.IsValid() {
+		traceID, spanID := sc.TraceID(), sc.SpanID()
+		lr.TraceId = traceID[:]
+		lr.SpanId = spanID[:]
+		lr.Flags = uint32(sc.TraceFlags())
+	}
+	return lr
+}
+
+// severityNumber maps slog levels onto the OTLP severity range, where
+// DEBUG, INFO, WARN, and ERROR start at 5, 9, 13, and 17
+func severityNumber(level slog.Level) logspb.SeverityNumber {
+	n := int(level) + int(logspb.SeverityNumber_SEVERITY_NUMBER_INFO)
+	if n < int(logspb.SeverityNumber_SEVERITY_NUMBER_TRACE) {
+		n = int(logspb.SeverityNumber_SEVERITY_NUMBER_TRACE)
+	}
+	if n > int(logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4) {
+		n = int(logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4)
+	}
+	return logspb.SeverityNumber(n)
+}
+
+// appendAttr converts a slog attribute to OTLP, flattening groups into
+// dotted keys
+func appendAttr(kvs []*commonpb.KeyValue, prefix string, a slog.Attr) []*commonpb.KeyValue {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for _, ga := range v.Group() {
+			kvs = appendAttr(kvs, prefix+a.Key+".", ga)
+		}
+		return kvs
+	}
+	if a.Key == "" {
+		return kvs
+	}
+	return append(kvs, &commonpb.KeyValue{Key: prefix + a.Key, Value: slogValue(v)})
+}
+
+func slogValue(v slog.Value) *commonpb.AnyValue {
+	switch v.Kind() {
+	case slog.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.Bool()}}
+	case slog.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.Int64()}}
+	case slog.KindUint64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.Uint64())}}
+	case slog.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.Float64()}}
+	case slog.KindDuration:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.Duration())}}
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return stringValue(err.Error())
+		}
+	}
+	return stringValue(v.String())
+}
+
+func stringValue(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+// resourceProto converts the SDK resource to its OTLP representation
+func resourceProto(res *resource.Resource) *resourcepb.Resource {
+	var kvs []*commonpb.KeyValue
+	for _, kv := range res.Attributes() {
+		var v *commonpb.AnyValue
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: kv.Value.AsBool()}}
+		case attribute.INT64:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: kv.Value.AsInt64()}}
+		case attribute.FLOAT64:
+			v = &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: kv.Value.AsFloat64()}}
+		default:
+			v = stringValue(kv.Value.Emit())
+		}
+		kvs = append(kvs, &commonpb.KeyValue{Key: string(kv.Key), Value: v})
+	}
+	return &resourcepb.Resource{Attributes: kvs}
+}
+
+// logExporter batches log records and exports them to the collector in the
+// background. Records are dropped rather than blocking the caller when the
+// queue is full.
+type logExporter struct {
+	client   collogspb.LogsServiceClient
+	resource *resourcepb.Resource
+	records  chan *logspb.LogRecord
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newLogExporter(client collogspb.LogsServiceClient, res *resource.Resource) *logExporter {
+	e := &logExporter{
+		client:   client,
+		resource: resourceProto(res),
+		records:  make(chan *logspb.LogRecord, logQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *logExporter) export(r *logspb.LogRecord) {
+	select {
+	case <-e.stop:
+	case e.records <- r:
+	default:
+	}
+}
+
+func (e *logExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(logExportInterval)
+	defer ticker.Stop()
+
+	var batch []*logspb.LogRecord
+	for {
+		select {
+		case r := <-e.records:
+			batch = append(batch, r)
+			if len(batch) >= logBatchSize {
+				e.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.flush(batch)
+			batch = nil
+		case <-e.stop:
+			for {
+				select {
+				case r := <-e.records:
+					batch = append(batch, r)
+				default:
+					e.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *logExporter) flush(batch []*logspb.LogRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), logExportTimeout)
+	defer cancel()
+	_, err := e.client.Export(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: "ordersAPI"},
+				LogRecords: batch,
+			}},
+		}},
+	})
+	if err != nil {
+		otel.Handle(fmt.Errorf("export logs: %w", err))
+	}
+}
+
+func (e *logExporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
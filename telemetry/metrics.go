@@ -0,0 +1,100 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// ExporterPrometheus exposes metrics for scraping rather than pushing them.
+// It is only valid for Config.MetricsExporter.
+const ExporterPrometheus = "prometheus"
+
+// NewMeterProvider creates a meter provider with a reader for each of the
+// metric exporters selected by the config
+func NewMeterProvider(ctx context.Context, cfg Config) (*sdkmetric.MeterProvider, error) {
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+
+	for _, name := range cfg.metricsExporters() {
+		switch name {
+		case ExporterOTLP:
+			endpoint, err := cfg.metricsEndpoint()
+			if err != nil {
+				return nil, err
+			}
+			conn, err := dialCollector(ctx, cfg, endpoint)
+			if err != nil {
+				return nil, err
+			}
+			exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+			if err != nil {
+				return nil, fmt.Errorf("create metric exporter: %w", err)
+			}
+			opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.MetricsInterval))))
+		case ExporterPrometheus:
+			exporter, err := otelprometheus.New()
+			if err != nil {
+				return nil, fmt.Errorf("create prometheus exporter: %w", err)
+			}
+			opts = append(opts, sdkmetric.WithReader(exporter))
+		case ExporterNone:
+		default:
+			return nil, fmt.Errorf("unknown metrics exporter %q", name)
+		}
+	}
+
+	return sdkmetric.NewMeterProvider(opts...), nil
+}
+
+// MetricsHandler returns the handler serving metrics for Prometheus to
+// scrape, or nil when the prometheus exporter is not selected. The
+// OpenMetrics format is served to scrapers asking for it, as only it carries
+// exemplars.
+func MetricsHandler(cfg Config) http.Handler {
+	if !cfg.exportsMetrics(ExporterPrometheus) {
+		return nil
+	}
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// Meter returns a meter from the global meter provider for recording
+// counters and histograms
+func Meter(name string) metric.Meter {
+	return global.Meter(name)
+}
+
+// exportsMetrics reports whether the named metric exporter is selected
+func (c Config) exportsMetrics(name string) bool {
+	for _, n := range c.metricsExporters() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// metricsExporters splits the comma separated list of metric exporters
+func (c Config) metricsExporters() []string {
+	if c.MetricsExporter == "" {
+		return []string{ExporterOTLP}
+	}
+	var names []string
+	for _, name := range strings.Split(c.MetricsExporter, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewTracerProvider creates a tracer provider that samples spans with sampler
+// and batches them to each of the exporters selected by the config, as the
+// config tunes the batching
+func NewTracerProvider(ctx context.Context, cfg Config, sampler *ReloadableSampler) (*trace.TracerProvider, error) {
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := []trace.TracerProviderOption{
+		trace.WithResource(res),
+		trace.WithSampler(sampler),
+	}
+	idGenerator, err := newIDGenerator(cfg.IDGenerator)
+	if err != nil {
+		return nil, err
+	}
+	if idGenerator != nil {
+		opts = append(opts, trace.WithIDGenerator(idGenerator))
+	}
+	if cfg.BaggageKeys != "" {
+		opts = append(opts, trace.WithSpanProcessor(newBaggageProcessor(cfg.BaggageKeys)))
+	}
+	// each exporter is batched on its own, so spans can be sent to a
+	// collector and printed locally at once, and a slow exporter only drops
+	// its own spans
+	var processors multiProcessor
+	for _, name := range cfg.tracesExporters() {
+		exporter, err := newExporter(ctx, cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("create %s exporter: %w", name, err)
+		}
+		if exporter == nil {
+			continue
+		}
+		// an unreachable endpoint only costs the spans meant for it, and is
+		// probed until it is back
+		if addr := cfg.exporterAddr(name); addr != "" {
+			exporter, err = newDegradingExporter(ctx, exporter, name, addr, cfg.ReconnectInterval)
+			if err != nil {
+				return nil, err
+			}
+		}
+		processor, err := newBatchProcessor(exporter, cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+	if len(processors) > 0 {
+		var processor trace.SpanProcessor = processors
+		filters, err := parseFilterRules(cfg.FilterSpans)
+		if err != nil {
+			return nil, err
+		}
+		if len(filters) > 0 {
+			processor = newFilteringProcessor(processor, filters)
+		}
+		if cfg.redacts() {
+			processor = newRedactingProcessor(processor, cfg)
+		}
+		if cfg.Sampler == SamplerErrorBiased {
+			processor = newErrorBiasedProcessor(processor, &sampler.ratio)
+		}
+		opts = append(opts, trace.WithSpanProcessor(processor))
+	}
+	return trace.NewTracerProvider(opts...), nil
+}
@@ -0,0 +1,306 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Receiver is an OTLP gRPC receiver keeping the most recent traces it
+// receives in memory, standing in for a collector and a tracing backend
+// while the example is explored. Metrics and logs are accepted and
+// discarded, so the processes exporting them to it do not fail.
+type Receiver struct {
+	listener net.Listener
+	server   *grpc.Server
+
+	mu sync.Mutex
+	// traces holds the traces by ID, and order their IDs from the first
+	// received to the last
+	traces    map[string]*ReceivedTrace
+	order     []string
+	maxTraces int
+}
+
+// ReceivedTrace is a trace put together from the spans received so far
+type ReceivedTrace struct {
+	ID    string         `json:"trace_id"`
+	Spans []ReceivedSpan `json:"spans"`
+}
+
+// ReceivedSpan is a span as received over OTLP
+type ReceivedSpan struct {
+	TraceID       string          `json:"trace_id"`
+	SpanID        string          `json:"span_id"`
+	ParentSpanID  string          `json:"parent_span_id,omitempty"`
+	Name          string          `json:"name"`
+	Kind          string          `json:"kind"`
+	Service       string          `json:"service"`
+	Start         time.Time       `json:"start"`
+	End           time.Time       `json:"end"`
+	Status        string          `json:"status"`
+	StatusMessage string          `json:"status_message,omitempty"`
+	Attributes    map[string]any  `json:"attributes,omitempty"`
+	Events        []ReceivedEvent `json:"events,omitempty"`
+}
+
+// ReceivedEvent is an event of a received span
+type ReceivedEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Duration is how long the span took
+func (s ReceivedSpan) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// StartReceiver listens on addr and serves OTLP over gRPC until Stop is
+// called, keeping the last maxTraces traces
+func StartReceiver(addr string, maxTraces int) (*Receiver, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for otlp: %w", err)
+	}
+	r := &Receiver{
+		listener:  lis,
+		server:    grpc.NewServer(),
+		traces:    make(map[string]*ReceivedTrace),
+		maxTraces: maxTraces,
+	}
+	coltracepb.RegisterTraceServiceServer(r.server, traceService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(r.server, metricsService{})
+	collogspb.RegisterLogsServiceServer(r.server, logsService{})
+	go func() {
+		if err := r.server.Serve(lis); err != nil {
+			slog.Error("serve otlp receiver", "error", err)
+		}
+	}()
+	return r, nil
+}
+
+// Addr is the address the receiver listens on
+func (r *Receiver) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Stop stops the receiver once the exports in flight are handled
+func (r *Receiver) Stop() {
+	r.server.GracefulStop()
+}
+
+// UseReceiver exports every signal over OTLP gRPC to the receiver listening
+// on addr, in place of the exporters configured
+func (c *Config) UseReceiver(addr string) {
+	c.Exporter = ExporterOTLP
+	c.Protocol = ProtocolGRPC
+	c.Endpoint = addr
+	c.TracesEndpoint = ""
+	c.MetricsEndpoint = ""
+	c.LogsEndpoint = ""
+	c.Insecure = true
+}
+
+// Traces returns the traces received, the most recent first
+func (r *Receiver) Traces() []ReceivedTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	traces := make([]ReceivedTrace, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		traces = append(traces, r.traces[r.order[i]].copy())
+	}
+	return traces
+}
+
+// Trace returns the trace with the given ID, if it was received and is
+// still kept
+func (r *Receiver) Trace(id string) (ReceivedTrace, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.traces[id]
+	if !ok {
+		return ReceivedTrace{}, false
+	}
+	return t.copy(), true
+}
+
+// add keeps the spans, evicting the oldest traces beyond the limit
+func (r *Receiver) add(spans []ReceivedSpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range spans {
+		t, ok := r.traces[s.TraceID]
+		if !ok {
+			t = &ReceivedTrace{ID: s.TraceID}
+			r.traces[s.TraceID] = t
+			r.order = append(r.order, s.TraceID)
+		}
+		t.Spans = append(t.Spans, s)
+	}
+	for len(r.order) > r.maxTraces {
+		delete(r.traces, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// copy returns the trace with its spans in start order, safe to use once
+// the lock is released
+func (t *ReceivedTrace) copy() ReceivedTrace {
+	spans := append([]ReceivedSpan(nil), t.Spans...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+	return ReceivedTrace{ID: t.ID, Spans: spans}
+}
+
+// Root returns the span of the trace without a parent among its spans, or
+// its earliest span while the root has not been received
+func (t ReceivedTrace) Root() ReceivedSpan {
+	ids := make(map[string]bool, len(t.Spans))
+	for _, s := range t.Spans {
+		ids[s.SpanID] = true
+	}
+	for _, s := range t.Spans {
+		if !ids[s.ParentSpanID] {
+			return s
+		}
+	}
+	return t.Spans[0]
+}
+
+// Services lists the services the spans of the trace come from
+func (t ReceivedTrace) Services() []string {
+	seen := make(map[string]bool)
+	var services []string
+	for _, s := range t.Spans {
+		if !seen[s.Service] {
+			seen[s.Service] = true
+			services = append(services, s.Service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// traceService receives spans
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s traceService) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	var spans []ReceivedSpan
+	for _, rs := range req.ResourceSpans {
+		service := stringAttribute(rs.GetResource().GetAttributes(), string(semconv.ServiceNameKey))
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				spans = append(spans, receivedSpan(span, service))
+			}
+		}
+	}
+	s.r.add(spans)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// metricsService discards metrics
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+}
+
+func (metricsService) Export(context.Context, *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+// logsService discards logs
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+}
+
+func (logsService) Export(context.Context, *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func receivedSpan(span *tracepb.Span, service string) ReceivedSpan {
+	s := ReceivedSpan{
+		TraceID:       hex.EncodeToString(span.TraceId),
+		SpanID:        hex.EncodeToString(span.SpanId),
+		ParentSpanID:  hex.EncodeToString(span.ParentSpanId),
+		Name:          span.Name,
+		Kind:          strings.ToLower(strings.TrimPrefix(span.Kind.String(), "SPAN_KIND_")),
+		Service:       service,
+		Start:         time.Unix(0, int64(span.StartTimeUnixNano)).UTC(),
+		End:           time.Unix(0, int64(span.EndTimeUnixNano)).UTC(),
+		Status:        strings.ToLower(strings.TrimPrefix(span.GetStatus().GetCode().String(), "STATUS_CODE_")),
+		StatusMessage: span.GetStatus().GetMessage(),
+		Attributes:    attributeMap(span.Attributes),
+	}
+	for _, event := range span.Events {
+		s.Events = append(s.Events, ReceivedEvent{
+			Name:       event.Name,
+			Time:       time.Unix(0, int64(event.TimeUnixNano)).UTC(),
+			Attributes: attributeMap(event.Attributes),
+		})
+	}
+	return s
+}
+
+func attributeMap(attrs []*commonpb.KeyValue) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attrs))
+	for _, kv := range attrs {
+		m[kv.Key] = anyValue(kv.Value)
+	}
+	return m
+}
+
+// anyValue converts an OTLP attribute value to the Go value it holds
+func anyValue(v *commonpb.AnyValue) any {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(v.ArrayValue.Values))
+		for _, value := range v.ArrayValue.Values {
+			values = append(values, anyValue(value))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributeMap(v.KvlistValue.Values)
+	default:
+		return nil
+	}
+}
+
+func stringAttribute(attrs []*commonpb.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value.GetStringValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Redaction modes accepted by Config.RedactMode
+const (
+	// RedactMask replaces the value of a redacted attribute
+	RedactMask = "mask"
+	// RedactHash replaces the value of a redacted attribute with its SHA-256
+	// hash, so spans carrying the same value can still be found together
+	RedactHash = "hash"
+)
+
+// redactedValue replaces the values of masked attributes
+const redactedValue = "[REDACTED]"
+
+// redactingProcessor scrubs the attributes of spans and their events before
+// handing the spans to next, so sensitive values never reach an exporter.
+// An attribute is redacted when its key is denied, or when an allow list is
+// set and its key is not allowed. A key pattern ending in * matches every
+// key with its prefix.
+type redactingProcessor struct {
+	next  trace.SpanProcessor
+	deny  []string
+	allow []string
+	hash  bool
+}
+
+func newRedactingProcessor(next trace.SpanProcessor, cfg Config) *redactingProcessor {
+	return &redactingProcessor{
+		next:  next,
+		deny:  splitKeys(cfg.RedactAttributes),
+		allow: splitKeys(cfg.RedactAllowAttributes),
+		hash:  cfg.RedactMode == RedactHash,
+	}
+}
+
+// redacts reports whether the config redacts any attribute
+func (c Config) redacts() bool {
+	return c.RedactAttributes != "" || c.RedactAllowAttributes != ""
+}
+
+func (p *redactingProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *redactingProcessor) OnEnd(s trace.ReadOnlySpan) {
+	attrs, redacted := p.redact(s.Attributes())
+	events := s.Events()
+	var scrubbed []trace.Event
+	for i, event := range events {
+		eventAttrs, eventRedacted := p.redact(event.Attributes)
+		if !eventRedacted {
+			continue
+		}
+		if scrubbed == nil {
+			scrubbed = append([]trace.Event(nil), events...)
+		}
+		scrubbed[i].Attributes = eventAttrs
+	}
+	if !redacted && scrubbed == nil {
+		p.next.OnEnd(s)
+		return
+	}
+	if scrubbed == nil {
+		scrubbed = events
+	}
+	p.next.OnEnd(redactedSpan{ReadOnlySpan: s, attrs: attrs, events: scrubbed})
+}
+
+func (p *redactingProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+func (p *redactingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// redact returns attrs with the values of the redacted keys replaced, and
+// whether any was. attrs is returned as it is when none was.
+func (p *redactingProcessor) redact(attrs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if !p.redacts(string(kv.Key)) {
+			continue
+		}
+		if out == nil {
+			out = append([]attribute.KeyValue(nil), attrs...)
+		}
+		out[i] = kv.Key.String(p.replacement(kv.Value))
+	}
+	if out == nil {
+		return attrs, false
+	}
+	return out, true
+}
+
+func (p *redactingProcessor) redacts(key string) bool {
+	if matchesKey(p.deny, key) {
+		return true
+	}
+	return len(p.allow) > 0 && !matchesKey(p.allow, key)
+}
+
+func (p *redactingProcessor) replacement(v attribute.Value) string {
+	if !p.hash {
+		return redactedValue
+	}
+	sum := sha256.Sum256([]byte(v.Emit()))
+	return hex.EncodeToString(sum[:])
+}
+
+// redactedSpan is an ended span with its attributes and events scrubbed
+type redactedSpan struct {
+	trace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []trace.Event
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+func (s redactedSpan) Events() []trace.Event {
+	return s.events
+}
+
+// splitKeys splits a comma separated list of attribute keys
+func splitKeys(list string) []string {
+	var keys []string
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// matchesKey reports whether key matches any of the patterns
+func matchesKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if pattern == key {
+			return true
+		}
+	}
+	return false
+}
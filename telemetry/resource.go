@@ -0,0 +1,52 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/observiq/tracing/buildinfo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// Resource attributes describing the build, which have no semantic
+// convention
+const (
+	buildCommitKey = attribute.Key("build.commit")
+	buildTimeKey   = attribute.Key("build.time")
+)
+
+// newResource describes this process with the resource detectors selected
+// by the config. It is shared by every telemetry signal so traces and
+// metrics from the same process can be correlated, and carries the build so
+// they can be correlated to deploys. A detector failing only leaves its
+// attributes out.
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	opts, err := resourceOptions(cfg.ResourceDetectors)
+	if err != nil {
+		return nil, err
+	}
+
+	build := buildinfo.Get()
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(build.Version),
+	}
+	if build.Commit != "" {
+		attrs = append(attrs, buildCommitKey.String(build.Commit))
+	}
+	if build.Time != "" {
+		attrs = append(attrs, buildTimeKey.String(build.Time))
+	}
+	// the service comes last, so the config wins over the detectors
+	opts = append(opts, resource.WithAttributes(attrs...))
+
+	res, err := resource.New(ctx, opts...)
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.WarnContext(ctx, "detect resource", "error", err)
+		return res, nil
+	}
+	return res, err
+}
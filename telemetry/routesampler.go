@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// routeRule overrides the sampling of the SERVER spans of the requests
+// matching it
+type routeRule struct {
+	// method is the HTTP method the rule matches, any when empty
+	method string
+	// route is the route the rule matches. A route ending in * matches
+	// every route with its prefix.
+	route   string
+	sampler trace.Sampler
+}
+
+// parseRouteRules parses a comma separated list of rules of the form
+// "[METHOD ]ROUTE=DECISION", where the decision is always, never or the
+// fraction of the matching requests sampled. For example
+// "/v1/orders/:id/watch=never,POST /v1/orders=always,/v1/orders/*=0.1".
+func parseRouteRules(list string) ([]routeRule, error) {
+	var rules []routeRule
+	for _, rule := range strings.Split(list, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		match, decision, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, fmt.Errorf("sampler route rule %q has no decision", rule)
+		}
+		var r routeRule
+		if method, route, ok := strings.Cut(strings.TrimSpace(match), " "); ok {
+			r.method, r.route = strings.ToUpper(method), strings.TrimSpace(route)
+		} else {
+			r.route = method
+		}
+		if r.route == "" {
+			return nil, fmt.Errorf("sampler route rule %q has no route", rule)
+		}
+		switch decision = strings.TrimSpace(decision); decision {
+		case "always":
+			r.sampler = trace.AlwaysSample()
+		case "never":
+			r.sampler = trace.NeverSample()
+		default:
+			ratio, err := strconv.ParseFloat(decision, 64)
+			if err != nil || ratio < 0 || ratio > 1 {
+				return nil, fmt.Errorf("sampler route rule %q decision must be always, never or a fraction in [0, 1]", rule)
+			}
+			r.sampler = trace.TraceIDRatioBased(ratio)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule matches a request to route with method
+func (r routeRule) matches(method, route string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	return matchesKey([]string{r.route}, route)
+}
+
+// routeSampler decides the SERVER spans of the requests matching one of its
+// rules by the first rule they match, whatever their parent decided, so
+// noisy routes can be left out of traces and rare routes kept in all of
+// them. Every other span is decided by next.
+type routeSampler struct {
+	rules []routeRule
+	next  trace.Sampler
+}
+
+func (s routeSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	if p.Kind != oteltrace.SpanKindServer {
+		return s.next.ShouldSample(p)
+	}
+	method, route := requestOf(p.Attributes)
+	if route == "" {
+		return s.next.ShouldSample(p)
+	}
+	for _, r := range s.rules {
+		if r.matches(method, route) {
+			return r.sampler.ShouldSample(p)
+		}
+	}
+	return s.next.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	return fmt.Sprintf("RouteBased{rules:%d,next:%s}", len(s.rules), s.next.Description())
+}
+
+// requestOf returns the method and route of a request described by the
+// attributes of its SERVER span
+func requestOf(attrs []attribute.KeyValue) (method, route string) {
+	for _, kv := range attrs {
+		switch kv.Key {
+		case semconv.HTTPMethodKey:
+			method = kv.Value.AsString()
+		case semconv.HTTPRouteKey:
+			route = kv.Value.AsString()
+		}
+	}
+	return method, route
+}
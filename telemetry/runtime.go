@@ -0,0 +1,20 @@
+package telemetry
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/contrib/instrumentation/host"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+)
+
+// StartProcessMetrics starts collecting Go runtime (GC, goroutines, memory)
+// and host (CPU, memory, network) metrics with the global meter provider
+func StartProcessMetrics(cfg Config) error {
+	if err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(cfg.RuntimeMetricsInterval)); err != nil {
+		return fmt.Errorf("start runtime metrics: %w", err)
+	}
+	if err := host.Start(); err != nil {
+		return fmt.Errorf("start host metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewSampler creates the sampler selected by the config, overridden for the
+// requests matching its route rules
+func NewSampler(cfg Config) (trace.Sampler, error) {
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRouteRules(cfg.SamplerRoutes)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return sampler, nil
+	}
+	return routeSampler{rules: rules, next: sampler}, nil
+}
+
+// newSampler creates the sampler named by the config
+func newSampler(cfg Config) (trace.Sampler, error) {
+	if cfg.SamplerArg < 0 || cfg.SamplerArg > 1 {
+		return nil, fmt.Errorf("sampler arg %v is outside [0, 1]", cfg.SamplerArg)
+	}
+
+	switch cfg.Sampler {
+	case SamplerAlwaysOn:
+		return trace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return trace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return trace.TraceIDRatioBased(cfg.SamplerArg), nil
+	case SamplerParentBasedAlwaysOn, "":
+		return trace.ParentBased(trace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return trace.ParentBased(trace.NeverSample()), nil
+	case SamplerParentBasedTraceIDRatio:
+		return trace.ParentBased(trace.TraceIDRatioBased(cfg.SamplerArg)), nil
+	case SamplerErrorBiased:
+		return errorBiasedSampler{ratio: cfg.SamplerArg}, nil
+	default:
+		return nil, fmt.Errorf("unknown traces sampler %q", cfg.Sampler)
+	}
+}
+
+// ReloadableSampler is the sampler selected by the config. Its sampling ratio
+// can be changed while the process runs.
+type ReloadableSampler struct {
+	name    string
+	current swappableSampler
+	// ratio decides which successful traces the error biased processor keeps
+	ratio swappableSampler
+}
+
+// NewReloadableSampler creates a reloadable sampler from the config
+func NewReloadableSampler(cfg Config) (*ReloadableSampler, error) {
+	s := &ReloadableSampler{name: cfg.Sampler}
+	if err := s.Update(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update applies the sampling ratio and route rules of the config. The
+// sampler itself can only be changed by a restart.
+func (s *ReloadableSampler) Update(cfg Config) error {
+	if cfg.Sampler != s.name {
+		return fmt.Errorf("changing the traces sampler from %q to %q requires a restart", s.name, cfg.Sampler)
+	}
+	sampler, err := NewSampler(cfg)
+	if err != nil {
+		return err
+	}
+	s.current.store(sampler)
+	s.ratio.store(trace.TraceIDRatioBased(cfg.SamplerArg))
+	return nil
+}
+
+func (s *ReloadableSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	return s.current.ShouldSample(p)
+}
+
+func (s *ReloadableSampler) Description() string {
+	return s.current.Description()
+}
+
+// swappableSampler delegates to a sampler that can be replaced atomically
+type swappableSampler struct {
+	p atomic.Pointer[samplerRef]
+}
+
+// samplerRef boxes the interface so it can be stored in an atomic.Pointer
+type samplerRef struct {
+	trace.Sampler
+}
+
+func (s *swappableSampler) store(sampler trace.Sampler) {
+	s.p.Store(&samplerRef{sampler})
+}
+
+func (s *swappableSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	return s.p.Load().ShouldSample(p)
+}
+
+func (s *swappableSampler) Description() string {
+	return s.p.Load().Description()
+}
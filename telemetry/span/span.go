@@ -0,0 +1,142 @@
+// Package span starts spans with the kind their role calls for and the
+// semantic convention attributes that describe it, so every package
+// describes HTTP requests, database calls and messages the same way.
+package span
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler returns the SERVER span of the HTTP request r, so that a handler
+// annotates the span the HTTP instrumentation started rather than a
+// duplicate of it. The span carries the attributes of opts, and ending it is
+// left to the instrumentation. When no instrumentation traces r, a SERVER
+// span with the http.* attributes of r is started instead.
+func Handler(r *http.Request, tracer trace.Tracer, route string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx := r.Context()
+	if s, ok := serverSpan(ctx); ok {
+		cfg := trace.NewSpanStartConfig(opts...)
+		s.SetAttributes(cfg.Attributes()...)
+		return ctx, instrumented{s}
+	}
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...),
+		trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+	)
+	return tracer.Start(ctx, route, opts...)
+}
+
+// RecordHTTPError records err on the SERVER span of a request answered with
+// statusCode. Only server errors mark the span as failed, as the semantic
+// conventions ask, since a client error is the fault of the caller.
+func RecordHTTPError(s trace.Span, statusCode int, err error) {
+	s.RecordError(err)
+	if statusCode >= http.StatusInternalServerError {
+		s.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Server starts a SERVER span handling a request received other than over
+// HTTP, such as a request and reply over NATS
+func Server(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts, trace.WithSpanKind(trace.SpanKindServer))
+	return tracer.Start(ctx, name, opts...)
+}
+
+// Client starts a CLIENT span calling a remote service, for calls the
+// instrumentation of a client library does not already trace
+func Client(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts, trace.WithSpanKind(trace.SpanKindClient))
+	return tracer.Start(ctx, name, opts...)
+}
+
+// redisDatabase is the redis database the clients use, the only one a
+// cluster has
+const redisDatabase = 0
+
+// DB starts a CLIENT span of the redis operation op, for operations made of
+// several commands, whose own spans the redis instrumentation starts as its
+// children. The span is named after op. opts are applied after the defaults,
+// so they may refine db.operation or give another kind, as the PRODUCER and
+// CONSUMER spans of buffered writes do.
+func DB(ctx context.Context, tracer trace.Tracer, op string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append([]trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperationKey.String(op),
+			semconv.DBRedisDBIndexKey.Int(redisDatabase),
+		),
+	}, opts...)
+	return tracer.Start(ctx, op, opts...)
+}
+
+// Messaging describes where a message is sent
+type Messaging struct {
+	// System is the messaging system, such as kafka or redis
+	System string
+	// Destination is the topic, channel, or stream of the message
+	Destination string
+	// Queue is set when each message is delivered to a single consumer,
+	// rather than to every subscriber of a topic
+	Queue bool
+}
+
+func (m Messaging) attrs() []attribute.KeyValue {
+	kind := semconv.MessagingDestinationKindTopic
+	if m.Queue {
+		kind = semconv.MessagingDestinationKindQueue
+	}
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String(m.System),
+		semconv.MessagingDestinationKey.String(m.Destination),
+		kind,
+	}
+}
+
+// Producer starts a PRODUCER span publishing a message to the destination
+// of m, whose trace context the message should carry
+func Producer(ctx context.Context, tracer trace.Tracer, m Messaging, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(m.attrs()...),
+	)
+	return tracer.Start(ctx, m.Destination+" publish", opts...)
+}
+
+// Consumer starts a CONSUMER span processing a message received from the
+// destination of m
+func Consumer(ctx context.Context, tracer trace.Tracer, m Messaging, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(m.attrs()...),
+		trace.WithAttributes(semconv.MessagingOperationProcess),
+	)
+	return tracer.Start(ctx, m.Destination+" process", opts...)
+}
+
+// serverSpan returns the span of ctx if it is a SERVER span that is still
+// being recorded
+func serverSpan(ctx context.Context) (trace.Span, bool) {
+	s := trace.SpanFromContext(ctx)
+	ro, ok := s.(sdktrace.ReadOnlySpan)
+	if !ok || !s.IsRecording() || ro.SpanKind() != trace.SpanKindServer {
+		return nil, false
+	}
+	return s, true
+}
+
+// instrumented is a span that its instrumentation ends
+type instrumented struct {
+	trace.Span
+}
+
+func (instrumented) End(...trace.SpanEndOption) {}
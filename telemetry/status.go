@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporterStatus tracks the spans handed to a span exporter, so whether
+// telemetry itself is healthy shows in metrics and at /debug/telemetry
+type exporterStatus struct {
+	name      string
+	maxQueued int64
+	attrs     []attribute.KeyValue
+
+	queued      atomic.Int64
+	sent        atomic.Int64
+	failed      atomic.Int64
+	dropped     atomic.Int64
+	sentCounter instrument.Int64Counter
+	failCounter instrument.Int64Counter
+	dropCounter instrument.Int64Counter
+
+	mu         sync.Mutex
+	lastExport time.Time
+	lastErr    error
+}
+
+// instrument creates the metrics of the exporter: the spans exported, the
+// spans that failed to be, the spans dropped, and the spans waiting
+func (s *exporterStatus) instrument(meter metric.Meter) error {
+	s.attrs = []attribute.KeyValue{exporterKey.String(s.name)}
+	var err error
+	s.sentCounter, err = meter.Int64Counter("telemetry.spans.exported",
+		instrument.WithUnit("{span}"),
+		instrument.WithDescription("Number of spans the exporter accepted"),
+	)
+	if err != nil {
+		return fmt.Errorf("create exported spans counter: %w", err)
+	}
+	s.failCounter, err = meter.Int64Counter("telemetry.spans.failed",
+		instrument.WithUnit("{span}"),
+		instrument.WithDescription("Number of spans lost because their export failed"),
+	)
+	if err != nil {
+		return fmt.Errorf("create failed spans counter: %w", err)
+	}
+	s.dropCounter, err = meter.Int64Counter("telemetry.spans.dropped",
+		instrument.WithUnit("{span}"),
+		instrument.WithDescription("Number of ended spans dropped because too many were waiting to be exported"),
+	)
+	if err != nil {
+		return fmt.Errorf("create dropped spans counter: %w", err)
+	}
+	queued, err := meter.Int64ObservableGauge("telemetry.spans.queued",
+		instrument.WithUnit("{span}"),
+		instrument.WithDescription("Number of ended spans waiting to be exported"),
+	)
+	if err != nil {
+		return fmt.Errorf("create queued spans gauge: %w", err)
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(queued, s.queued.Load(), s.attrs...)
+		return nil
+	}, queued)
+	if err != nil {
+		return fmt.Errorf("register queued spans callback: %w", err)
+	}
+	return nil
+}
+
+// enqueue counts an ended span as waiting to be exported, or drops it and
+// reports false when maxQueued spans already are
+func (s *exporterStatus) enqueue() bool {
+	if s.queued.Add(1) > s.maxQueued {
+		s.queued.Add(-1)
+		s.dropped.Add(1)
+		s.dropCounter.Add(context.Background(), 1, s.attrs...)
+		return false
+	}
+	return true
+}
+
+// dequeue takes n spans being exported off the spans waiting
+func (s *exporterStatus) dequeue(n int) {
+	s.queued.Add(-int64(n))
+}
+
+// exported records the outcome of exporting n spans
+func (s *exporterStatus) exported(ctx context.Context, n int, err error) {
+	if err != nil {
+		s.failed.Add(int64(n))
+		s.failCounter.Add(ctx, int64(n), s.attrs...)
+	} else {
+		s.sent.Add(int64(n))
+		s.sentCounter.Add(ctx, int64(n), s.attrs...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastExport = time.Now()
+	s.lastErr = err
+}
+
+// ExporterState is the state of a span exporter reported by StatusHandler
+type ExporterState struct {
+	Name      string `json:"name"`
+	Queued    int64  `json:"queued"`
+	MaxQueued int64  `json:"max_queued"`
+	Exported  int64  `json:"exported"`
+	Failed    int64  `json:"failed"`
+	Dropped   int64  `json:"dropped"`
+	// LastExport is when spans were last exported, or nil before the first
+	// export
+	LastExport *time.Time `json:"last_export,omitempty"`
+	// LastError is why the last export failed, or empty when it succeeded
+	LastError string `json:"last_error,omitempty"`
+}
+
+func (s *exporterStatus) state() ExporterState {
+	st := ExporterState{
+		Name:      s.name,
+		Queued:    s.queued.Load(),
+		MaxQueued: s.maxQueued,
+		Exported:  s.sent.Load(),
+		Failed:    s.failed.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.lastExport.IsZero() {
+		last := s.lastExport
+		st.LastExport = &last
+	}
+	if s.lastErr != nil {
+		st.LastError = s.lastErr.Error()
+	}
+	return st
+}
+
+// statuses holds the exporters of the tracer providers created by the
+// process, which usually creates one
+var statuses statusRegistry
+
+type statusRegistry struct {
+	mu        sync.Mutex
+	exporters []*exporterStatus
+}
+
+func (r *statusRegistry) add(s *exporterStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exporters = append(r.exporters, s)
+}
+
+func (r *statusRegistry) states() []ExporterState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]ExporterState, 0, len(r.exporters))
+	for _, s := range r.exporters {
+		states = append(states, s.state())
+	}
+	return states
+}
+
+// StatusHandler serves the current state of the tracer provider as JSON:
+// its sampler, and for each span exporter the spans waiting, exported,
+// failed, and dropped, and how the last export went
+func StatusHandler(cfg Config, sampler trace.Sampler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"service_name": cfg.ServiceName,
+			"sampler":      sampler.Description(),
+			"id_generator": cfg.IDGenerator,
+			"exporters":    statuses.states(),
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// streamBuffer is how many summaries wait for a slow client before the
+// following ones are dropped for it
+const streamBuffer = 64
+
+// streamKeepAlive is how often a comment is sent to an idle client, so
+// proxies keep the connection open
+const streamKeepAlive = 15 * time.Second
+
+// SpanSummary describes a request span as it ends
+type SpanSummary struct {
+	Name    string    `json:"name"`
+	TraceID string    `json:"trace_id"`
+	SpanID  string    `json:"span_id"`
+	Start   time.Time `json:"start"`
+	// DurationMS is how long the span took, in milliseconds
+	DurationMS float64 `json:"duration_ms"`
+	// Status is unset, ok, or error
+	Status        string `json:"status"`
+	StatusMessage string `json:"status_message,omitempty"`
+	// HTTPStatusCode is the status of the response to an HTTP request
+	HTTPStatusCode int64 `json:"http_status_code,omitempty"`
+}
+
+// SpanStream is a span processor that pushes a summary of each request
+// span, a SERVER span, as it ends to the clients of its handler as
+// Server-Sent Events. Clients too slow to keep up miss summaries rather than
+// hold up the requests.
+type SpanStream struct {
+	mu      sync.Mutex
+	clients map[chan SpanSummary]struct{}
+}
+
+// NewSpanStream creates a span stream without clients, to be registered
+// with the tracer provider
+func NewSpanStream() *SpanStream {
+	return &SpanStream{clients: make(map[chan SpanSummary]struct{})}
+}
+
+func (s *SpanStream) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (s *SpanStream) OnEnd(span trace.ReadOnlySpan) {
+	if span.SpanKind() != oteltrace.SpanKindServer {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	summary := summarize(span)
+	for c := range s.clients {
+		select {
+		case c <- summary:
+		default:
+		}
+	}
+}
+
+func (s *SpanStream) Shutdown(context.Context) error   { return nil }
+func (s *SpanStream) ForceFlush(context.Context) error { return nil }
+
+func (s *SpanStream) subscribe() chan SpanSummary {
+	c := make(chan SpanSummary, streamBuffer)
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	return c
+}
+
+func (s *SpanStream) unsubscribe(c chan SpanSummary) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+func summarize(span trace.ReadOnlySpan) SpanSummary {
+	summary := SpanSummary{
+		Name:          span.Name(),
+		TraceID:       span.SpanContext().TraceID().String(),
+		SpanID:        span.SpanContext().SpanID().String(),
+		Start:         span.StartTime().UTC(),
+		DurationMS:    milliseconds(span.EndTime().Sub(span.StartTime())),
+		Status:        statusName(span.Status().Code),
+		StatusMessage: span.Status().Description,
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Key == semconv.HTTPStatusCodeKey {
+			summary.HTTPStatusCode = attr.Value.AsInt64()
+		}
+	}
+	return summary
+}
+
+func statusName(code codes.Code) string {
+	switch code {
+	case codes.Ok:
+		return "ok"
+	case codes.Error:
+		return "error"
+	default:
+		return "unset"
+	}
+}
+
+// ServeHTTP streams the summaries of the request spans ending from now on
+// as span events, until the client disconnects. A browser navigating to it
+// is served a page listing them live.
+func (s *SpanStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := streamPage.Execute(w, r.URL.Path); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := s.subscribe()
+	defer s.unsubscribe(c)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case summary := <-c:
+			data, err := json.Marshal(summary)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: span\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+var streamPage = template.Must(template.New("stream").Parse(`<!DOCTYPE html>
+<html><head><title>Live requests</title>` + pageStyle + `</head><body>
+<h1>Live requests</h1>
+<p id="state">Connecting…</p>
+<table>
+<thead><tr><th>Time</th><th>Request</th><th>Status</th><th>Duration</th><th>Trace</th></tr></thead>
+<tbody id="spans"></tbody>
+</table>
+<script>
+const rows = document.getElementById("spans");
+const state = document.getElementById("state");
+const source = new EventSource({{.}});
+source.onopen = () => { state.textContent = "Streaming the requests as they end, newest first."; };
+source.onerror = () => { state.textContent = "Disconnected, reconnecting…"; };
+source.addEventListener("span", (e) => {
+	const s = JSON.parse(e.data);
+	const row = rows.insertRow(0);
+	if (s.status === "error") row.className = "error";
+	const cells = [
+		new Date(s.start).toLocaleTimeString(),
+		s.name,
+		(s.http_status_code || s.status) + (s.status_message ? ": " + s.status_message : ""),
+		s.duration_ms.toFixed(2) + " ms",
+	];
+	for (const text of cells) row.insertCell().textContent = text;
+	const trace = document.createElement("code");
+	trace.textContent = s.trace_id;
+	row.insertCell().appendChild(trace);
+	while (rows.rows.length > 200) rows.deleteRow(-1);
+});
+</script>
+</body></html>`))
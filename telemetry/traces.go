@@ -0,0 +1,256 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TraceSummary describes a received trace in the list of traces
+type TraceSummary struct {
+	ID       string    `json:"trace_id"`
+	Name     string    `json:"name"`
+	Services []string  `json:"services"`
+	Start    time.Time `json:"start"`
+	// DurationMS is how long the root span took, in milliseconds
+	DurationMS float64 `json:"duration_ms"`
+	Spans      int     `json:"spans"`
+	// Error is set when any span of the trace failed
+	Error bool `json:"error"`
+}
+
+func (t ReceivedTrace) summary() TraceSummary {
+	root := t.Root()
+	summary := TraceSummary{
+		ID:         t.ID,
+		Name:       root.Name,
+		Services:   t.Services(),
+		Start:      root.Start,
+		DurationMS: milliseconds(root.Duration()),
+		Spans:      len(t.Spans),
+	}
+	for _, s := range t.Spans {
+		if s.Status == "error" {
+			summary.Error = true
+		}
+	}
+	return summary
+}
+
+// TracesHandler serves the traces kept by the receiver: the list of traces
+// at its root, the most recent first, and the spans of a trace at its ID.
+// Both are JSON, or HTML for a browser, or when the format query parameter
+// is html, a trace then drawn as a waterfall of its spans. It is meant to be mounted with its prefix stripped.
+func TracesHandler(receiver *Receiver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(r.URL.Path, "/")
+		if id == "" {
+			traces := receiver.Traces()
+			summaries := make([]TraceSummary, 0, len(traces))
+			for _, t := range traces {
+				summaries = append(summaries, t.summary())
+			}
+			list := map[string]any{"traces": summaries}
+			respond(w, r, list, traceListPage, list)
+			return
+		}
+		t, ok := receiver.Trace(id)
+		if !ok {
+			http.Error(w, "trace not found, it may have been evicted", http.StatusNotFound)
+			return
+		}
+		respond(w, r, t, tracePage, newWaterfall(t))
+	})
+}
+
+// respond writes v as JSON, or data rendered by page when the client asks
+// for HTML
+func respond(w http.ResponseWriter, r *http.Request, v any, page *template.Template, data any) {
+	if !wantsHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// wantsHTML reports whether the client asked for HTML, as browsers do
+func wantsHTML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		return true
+	case "json":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// waterfall lays the spans of a trace out as rows in the order of its span
+// tree, each child under its parent, with a bar spanning the time the span
+// took within the trace
+type waterfall struct {
+	ID       string
+	Start    time.Time
+	Duration time.Duration
+	Services []string
+	Rows     []waterfallRow
+}
+
+type waterfallRow struct {
+	ReceivedSpan
+	// Depth is how many ancestors of the span were received
+	Depth int
+	// Offset is when the span started, from the start of the trace
+	Offset time.Duration
+	// Left and Width place the bar of the span, in percent of the trace
+	Left, Width float64
+	// Color tells the services of the spans apart
+	Color  string
+	Events []waterfallEvent
+}
+
+// Indent is how far the name of the span is indented, in em
+func (r waterfallRow) Indent() float64 {
+	return 0.8 + 1.2*float64(r.Depth)
+}
+
+type waterfallEvent struct {
+	ReceivedEvent
+	Offset time.Duration
+}
+
+// serviceColors are the colors of the bars of the spans, by service
+var serviceColors = []string{"#4e79a7", "#f28e2b", "#59a14f", "#b07aa1", "#76b7b2", "#edc948", "#9c755f", "#bab0ac"}
+
+// newWaterfall lays out t, whose spans are in start order. Spans whose
+// parent was not received are shown at the top level.
+func newWaterfall(t ReceivedTrace) waterfall {
+	w := waterfall{ID: t.ID, Services: t.Services()}
+	if len(t.Spans) == 0 {
+		return w
+	}
+	w.Start = t.Spans[0].Start
+	end := t.Spans[0].End
+	ids := make(map[string]bool, len(t.Spans))
+	for _, s := range t.Spans {
+		ids[s.SpanID] = true
+		if s.End.After(end) {
+			end = s.End
+		}
+	}
+	w.Duration = end.Sub(w.Start)
+
+	children := make(map[string][]ReceivedSpan)
+	var roots []ReceivedSpan
+	for _, s := range t.Spans {
+		if ids[s.ParentSpanID] && s.ParentSpanID != s.SpanID {
+			children[s.ParentSpanID] = append(children[s.ParentSpanID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	colors := make(map[string]string, len(w.Services))
+	for i, service := range w.Services {
+		colors[service] = serviceColors[i%len(serviceColors)]
+	}
+	var add func(s ReceivedSpan, depth int)
+	add = func(s ReceivedSpan, depth int) {
+		row := waterfallRow{
+			ReceivedSpan: s,
+			Depth:        depth,
+			Offset:       s.Start.Sub(w.Start),
+			Color:        colors[s.Service],
+		}
+		if w.Duration > 0 {
+			row.Left = 100 * float64(row.Offset) / float64(w.Duration)
+			row.Width = 100 * float64(s.Duration()) / float64(w.Duration)
+		}
+		for _, e := range s.Events {
+			row.Events = append(row.Events, waterfallEvent{ReceivedEvent: e, Offset: e.Time.Sub(w.Start)})
+		}
+		w.Rows = append(w.Rows, row)
+		for _, child := range children[s.SpanID] {
+			add(child, depth+1)
+		}
+	}
+	for _, s := range roots {
+		add(s, 0)
+	}
+	return w
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+var pageFuncs = template.FuncMap{
+	"ms": func(d time.Duration) string {
+		return d.Round(time.Microsecond).String()
+	},
+	"join": strings.Join,
+}
+
+const pageStyle = `<style>
+body { font: 14px sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.error { color: #c00; }
+code { font-size: 12px; }
+</style>`
+
+var traceListPage = template.Must(template.New("traces").Funcs(pageFuncs).Parse(`<!DOCTYPE html>
+<html><head><title>Traces</title>` + pageStyle + `</head><body>
+<h1>Traces</h1>
+<p>The most recent traces received, newest first.</p>
+<table>
+<tr><th>Trace</th><th>Services</th><th>Start</th><th>Duration</th><th>Spans</th></tr>
+{{range .traces}}<tr{{if .Error}} class="error"{{end}}>
+<td><a href="/debug/traces/{{.ID}}">{{.Name}}</a><br><code>{{.ID}}</code></td>
+<td>{{join .Services ", "}}</td>
+<td>{{.Start.Format "15:04:05.000"}}</td>
+<td>{{printf "%.2f" .DurationMS}} ms</td>
+<td>{{.Spans}}</td>
+</tr>{{else}}<tr><td colspan="5">No traces received yet.</td></tr>{{end}}
+</table>
+</body></html>`))
+
+var tracePage = template.Must(template.New("trace").Funcs(pageFuncs).Parse(`<!DOCTYPE html>
+<html><head><title>Trace {{.ID}}</title>` + pageStyle + `<style>
+.waterfall { width: 100%; }
+.waterfall td.timeline { width: 50%; }
+.track { position: relative; height: 1.1em; background: #f4f4f4; }
+.bar { position: absolute; top: 0; bottom: 0; min-width: 2px; }
+.error .bar { outline: 2px solid #c00; }
+summary { cursor: pointer; }
+details table { margin: 0.3em 0 0.3em 1em; }
+details td { border: none; padding: 0.1em 0.6em 0.1em 0; }
+</style></head><body>
+<p><a href="/debug/traces">All traces</a> · <a href="/debug/traces/{{.ID}}?format=json">JSON</a></p>
+<h1>Trace <code>{{.ID}}</code></h1>
+<p>{{len .Rows}} spans from {{join .Services ", "}}, started {{.Start.Format "15:04:05.000"}}, took {{ms .Duration}}.</p>
+<table class="waterfall">
+<tr><th>Span</th><th>Service</th><th>Duration</th><th>{{ms .Duration}}</th></tr>
+{{range .Rows}}<tr{{if eq .Status "error"}} class="error"{{end}}>
+<td style="padding-left: {{printf "%.1f" .Indent}}em">
+<details><summary>{{.Name}}</summary>
+<table>
+<tr><td>span</td><td><code>{{.SpanID}}</code></td></tr>
+<tr><td>kind</td><td>{{.Kind}}</td></tr>
+<tr><td>status</td><td>{{.Status}}{{if .StatusMessage}}: {{.StatusMessage}}{{end}}</td></tr>
+<tr><td>start</td><td>+{{ms .Offset}}</td></tr>
+{{range $key, $value := .Attributes}}<tr><td>{{$key}}</td><td><code>{{$value}}</code></td></tr>
+{{end}}{{range .Events}}<tr><td>event at +{{ms .Offset}}</td><td>{{.Name}}{{range $key, $value := .Attributes}}<br><code>{{$key}}={{$value}}</code>{{end}}</td></tr>
+{{end}}</table>
+</details>
+</td>
+<td>{{.Service}}</td>
+<td>{{ms .Duration}}</td>
+<td class="timeline"><div class="track"><div class="bar" style="left: {{printf "%.3f" .Left}}%; width: {{printf "%.3f" .Width}}%; background: {{.Color}}" title="{{.Name}}: {{ms .Duration}}"></div></div></td>
+</tr>
+{{end}}</table>
+</body></html>`))
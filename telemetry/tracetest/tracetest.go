@@ -0,0 +1,138 @@
+// Package tracetest asserts on the spans a test records, so a service can
+// check its instrumentation the way this example checks its own: install an
+// in-memory exporter, exercise the code, then require the spans it should
+// have produced.
+package tracetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Install returns a tracer provider exporting every span synchronously to the
+// returned in-memory exporter. The provider is also the global one until the
+// test ends, for code that traces through otel.Tracer.
+func Install(t testing.TB) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return tp, exporter
+}
+
+// RequireSpan returns the first span named name that has every attribute of
+// attrs, failing the test when no span does
+func RequireSpan(t testing.TB, exporter *tracetest.InMemoryExporter, name string, attrs ...attribute.KeyValue) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	for _, span := range spans {
+		if span.Name == name && hasAttributes(span, attrs) {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q with attributes %v among %s", name, attrs, names(spans))
+	return tracetest.SpanStub{}
+}
+
+// RequireNoSpan fails the test when a span named name that has every
+// attribute of attrs was recorded
+func RequireNoSpan(t testing.TB, exporter *tracetest.InMemoryExporter, name string, attrs ...attribute.KeyValue) {
+	t.Helper()
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name && hasAttributes(span, attrs) {
+			t.Fatalf("unexpected span named %q with attributes %v", name, span.Attributes)
+		}
+	}
+}
+
+// RequireParentChild fails the test unless child is a direct child of parent
+func RequireParentChild(t testing.TB, parent, child tracetest.SpanStub) {
+	t.Helper()
+	if child.Parent.TraceID() != parent.SpanContext.TraceID() || child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Fatalf("span %q has parent %s, want %q %s", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+// RequireDescendant fails the test unless span descends from ancestor
+// through the spans recorded by exporter
+func RequireDescendant(t testing.TB, exporter *tracetest.InMemoryExporter, ancestor, span tracetest.SpanStub) {
+	t.Helper()
+	byID := make(map[trace.SpanID]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		byID[s.SpanContext.SpanID()] = s
+	}
+	for parent := span.Parent; parent.IsValid(); {
+		if parent.SpanID() == ancestor.SpanContext.SpanID() {
+			return
+		}
+		next, ok := byID[parent.SpanID()]
+		if !ok {
+			break
+		}
+		parent = next.Parent
+	}
+	t.Fatalf("span %q does not descend from %q", span.Name, ancestor.Name)
+}
+
+// RequireStatus fails the test unless the status code of span is code
+func RequireStatus(t testing.TB, span tracetest.SpanStub, code codes.Code) {
+	t.Helper()
+	if span.Status.Code != code {
+		t.Fatalf("span %q has status %s %q, want %s", span.Name, span.Status.Code, span.Status.Description, code)
+	}
+}
+
+// RequireEvent returns the first event of span named name, failing the test
+// when there is none
+func RequireEvent(t testing.TB, span tracetest.SpanStub, name string) sdktrace.Event {
+	t.Helper()
+	for _, event := range span.Events {
+		if event.Name == name {
+			return event
+		}
+	}
+	t.Fatalf("span %q has no %q event", span.Name, name)
+	return sdktrace.Event{}
+}
+
+// Attribute returns the value of the attribute key of span
+func Attribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func hasAttributes(span tracetest.SpanStub, attrs []attribute.KeyValue) bool {
+	for _, want := range attrs {
+		got, ok := Attribute(span, want.Key)
+		if !ok || got != want.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// names lists the names of the spans for failure messages
+func names(spans tracetest.SpanStubs) string {
+	list := make([]string, len(spans))
+	for i, span := range spans {
+		list[i] = span.Name
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
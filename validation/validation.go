@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	minQuantity = 1
+	maxQuantity = 1000
+)
+
+// skuPattern matches SKUs such as ABC-1234: an uppercase prefix followed by
+// a dash and an alphanumeric code
+var skuPattern = regexp.MustCompile(`^[A-Z]{2,6}-[A-Z0-9]{2,12}$`)
+
+// currencies are the ISO 4217 codes orders may be placed in
+var currencies = map[string]bool{
+	"AUD": true, "CAD": true, "CHF": true, "EUR": true,
+	"GBP": true, "JPY": true, "NZD": true, "USD": true,
+}
+
+// FieldError describes why a single field failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Register adds the custom sku, currency, and quantity rules to gin's
+// validator and reports fields by their JSON names, or by their query
+// parameter names for query strings
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("gin validator is not go-playground/validator")
+	}
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		tag := f.Tag.Get("json")
+		if tag == "" {
+			tag = f.Tag.Get("form")
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	if err := v.RegisterValidation("sku", func(fl validator.FieldLevel) bool {
+		return skuPattern.MatchString(fl.Field().String())
+	}); err != nil {
+		return fmt.Errorf("register sku: %w", err)
+	}
+	if err := v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return currencies[fl.Field().String()]
+	}); err != nil {
+		return fmt.Errorf("register currency: %w", err)
+	}
+	if err := v.RegisterValidation("quantity", func(fl validator.FieldLevel) bool {
+		q := fl.Field().Int()
+		return q >= minQuantity && q <= maxQuantity
+	}); err != nil {
+		return fmt.Errorf("register quantity: %w", err)
+	}
+	return nil
+}
+
+// Struct validates v with the same rules gin applies when binding request
+// bodies, for callers that do not decode through gin
+func Struct(v any) error {
+	return binding.Validator.ValidateStruct(v)
+}
+
+// FieldErrors extracts the per-field failures from a binding error. It
+// returns nil if err is not a validation error, e.g. malformed JSON.
+func FieldErrors(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return fields
+}
+
+// fieldPath drops the top level struct name from a validator namespace
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "sku":
+		return "must be a SKU such as ABC-1234"
+	case "currency":
+		return "must be a supported ISO 4217 currency code"
+	case "quantity":
+		return fmt.Sprintf("must be between %d and %d", minQuantity, maxQuantity)
+	case "min":
+		return fmt.Sprintf("must have at least %s entries", fe.Param())
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "excluded_with":
+		return "cannot be combined with the other filters"
+	case "datetime":
+		return "must be formatted as " + fe.Param()
+	case "gt", "gte":
+		return fmt.Sprintf("must be %s %s", map[string]string{"gt": "greater than", "gte": "at least"}[fe.Tag()], fe.Param())
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/observiq/tracing/db"
+	"github.com/observiq/tracing/events"
+	"github.com/observiq/tracing/httpclient"
+	"github.com/observiq/tracing/jobs"
+)
+
+// work consumes the order events the API publishes to redis, so the traces
+// of requests changing orders continue in a second service. It also
+// fulfills the orders the API queues once they are paid, by shipping them
+// through the REST API.
+func work(args []string) error {
+	var apiURL, apiKey string
+	workerOpts := jobs.WorkerOptions{Consumer: hostname()}
+	cfg, err := loadConfig("worker", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&apiURL, "api-url", envOrDefault("API_URL", "http://localhost:9911"), "base URL of the REST API orders are fulfilled through")
+		fs.StringVar(&apiKey, "api-key", envOrDefault("API_KEY", ""), "API key granted orders:write, needed when the API enforces RBAC")
+		fs.StringVar(&workerOpts.Group, "jobs-group", envOrDefault("JOBS_GROUP", "fulfillment"), "consumer group the worker reads jobs with")
+		fs.StringVar(&workerOpts.Consumer, "jobs-consumer", workerOpts.Consumer, "name of the worker in its consumer group, unique within it")
+		fs.IntVar(&workerOpts.MaxAttempts, "jobs-max-attempts", 5, "attempts at a job before it is dead lettered")
+		fs.DurationVar(&workerOpts.ClaimAfter, "jobs-claim-after", time.Minute, "time a job may stay unacknowledged before another worker takes it over")
+		fs.DurationVar(&workerOpts.Block, "jobs-block", 5*time.Second, "time a read waits for new jobs")
+		fs.StringVar(&workerOpts.Trace, "jobs-trace", envOrDefault("JOBS_TRACE", jobs.TraceLink), "how a job span relates to the request that queued it: link starts a new trace linked to it, child continues its trace")
+	})
+	if err != nil {
+		return err
+	}
+	if err := workerOpts.Validate(); err != nil {
+		return fmt.Errorf("validate worker options: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	providers, err := setupTelemetry(ctx, cfg.Telemetry)
+	if err != nil {
+		return fmt.Errorf("set up telemetry: %w", err)
+	}
+	defer providers.shutdown(cfg.Telemetry.ShutdownTimeout)
+
+	opts, err := redisOptions(cfg.Redis)
+	if err != nil {
+		return fmt.Errorf("create redis options: %w", err)
+	}
+	opts.Name = "worker"
+	client, err := db.Connect(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("connect to redis: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Error("close redis", "error", err)
+		}
+	}()
+
+	fulfiller := newFulfiller(apiURL, apiKey, httpclient.New(10*time.Second))
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		slog.Info("consuming order events", "channel", cfg.Events.Channel)
+		if err := events.Subscribe(ctx, client, cfg.Events.Channel, handle); err != nil {
+			slog.Error("consume events", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		slog.Info("fulfilling orders", "stream", cfg.Jobs.Stream, "group", workerOpts.Group, "consumer", workerOpts.Consumer)
+		if err := jobs.NewWorker(client, cfg.Jobs.Stream, workerOpts, fulfiller.Fulfill).Run(ctx); err != nil {
+			slog.Error("fulfill orders", "error", err)
+		}
+	}()
+	wg.Wait()
+	return nil
+}
+
+// handle logs the event in the span continuing the trace of the request
+// that changed the order
+func handle(ctx context.Context, e events.Event) error {
+	slog.InfoContext(ctx, "order event", "type", e.Type, "order_id", e.OrderID, "status", e.Status)
+	return nil
+}
+
+// hostname returns the name of the host, which tells the workers of a
+// consumer group apart when each runs on its own host
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "worker"
+	}
+	return name
+}
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}